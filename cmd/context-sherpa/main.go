@@ -3,16 +3,60 @@ package main
 import (
 	_ "embed"
 	"flag"
+	"fmt"
+	"os"
 
 	"github.com/hackafterdark/context-sherpa/internal/mcp"
 )
 
 func main() {
 	projectRoot := flag.String("projectRoot", "", "Project root directory (defaults to current working directory)")
-	verbose := flag.Bool("verbose", false, "Enable verbose logging for debugging")
+	verbose := flag.Bool("verbose", false, "Enable verbose logging for debugging (same as --logLevel=debug)")
+	logLevel := flag.String("logLevel", "info", "Log level: debug, info, warn or error")
+	logFormat := flag.String("logFormat", mcp.LogFormatText, "Log format: text or json")
 	logFile := flag.String("logFile", "", "Path to file where logs will be appended (optional)")
+	quiet := flag.Bool("quiet", false, "Do not log to stderr (logs still go to --logFile)")
 	astGrepPath := flag.String("astGrepPath", "", "Explicit path to ast-grep binary")
+	scanBatchSize := flag.Int("scanBatchSize", 0, "Most files passed to one ast-grep run (defaults to 200)")
+	scanWorkers := flag.Int("scanWorkers", 0, "Most ast-grep runs at once (defaults to the number of CPUs)")
+	timeout := flag.Duration("timeout", mcp.DefaultToolTimeout, "Longest a tool call may run before its subprocesses are killed (0 for no limit)")
+	toolTimeouts := flag.String("toolTimeouts", "", "Per-tool timeouts overriding --timeout, e.g. scan_path=10m,run_rule_tests=1m")
+	goplsPath := flag.String("goplsPath", "", "Explicit path to gopls binary, used by the Go semantic query tools")
+	transport := flag.String("transport", mcp.TransportStdio, "Transport to serve: stdio, http (streamable HTTP) or sse")
+	addr := flag.String("addr", mcp.DefaultHTTPAddr, "Bind address for the http and sse transports")
+	authToken := flag.String("authToken", os.Getenv("CONTEXT_SHERPA_AUTH_TOKEN"), "Bearer token required from http and sse clients (defaults to $CONTEXT_SHERPA_AUTH_TOKEN)")
 	flag.Parse()
 
-	mcp.Start(*projectRoot, *verbose, *logFile, *astGrepPath)
+	if *verbose {
+		*logLevel = "debug"
+	}
+
+	perToolTimeouts, err := mcp.ParseToolTimeouts(*toolTimeouts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --toolTimeouts: %v\n", err)
+		os.Exit(2)
+	}
+	// A zero timeout means no limit, which Options spells as a negative one
+	if *timeout == 0 {
+		*timeout = -1
+	}
+
+	mcp.Start(mcp.Options{
+		ProjectRoot:   *projectRoot,
+		AstGrepPath:   *astGrepPath,
+		GoplsPath:     *goplsPath,
+		ScanBatchSize: *scanBatchSize,
+		ScanWorkers:   *scanWorkers,
+		ToolTimeout:   *timeout,
+		ToolTimeouts:  perToolTimeouts,
+	}, mcp.LogOptions{
+		Level:  *logLevel,
+		Format: *logFormat,
+		File:   *logFile,
+		Quiet:  *quiet,
+	}, mcp.TransportOptions{
+		Transport: *transport,
+		Addr:      *addr,
+		AuthToken: *authToken,
+	})
 }
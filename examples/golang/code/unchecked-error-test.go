@@ -12,4 +12,10 @@ func mightFail() error {
 func main() {
 	// This is a violation: the error is not checked.
 	mightFail()
+
+	// This is not a violation: nothing is returned.
+	logStep("done")
 }
+
+// a function that returns nothing
+func logStep(step string) {}
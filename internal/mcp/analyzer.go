@@ -0,0 +1,277 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AstGrepAnalyzerName is the name of the built-in ast-grep analyzer. It is also the Tool of
+// ast-grep rules in the community rule index.
+const AstGrepAnalyzerName = "ast-grep"
+
+// Project is the project an analyzer runs against
+type Project struct {
+	// Root is the directory holding the project's sgconfig.yml
+	Root string
+	// SgconfigPath is the sgconfig.yml selected for the scan. When files of a sub-project with
+	// a sgconfig.yml of its own are scanned, it is that of the sub-project, under Root.
+	SgconfigPath string
+}
+
+// AnalyzerCapabilities describes what an analyzer supports
+type AnalyzerCapabilities struct {
+	// Languages lists the languages the analyzer checks; empty means any language
+	Languages []string
+	// Snippets is set when the analyzer can check code that is not on disk (scan_code)
+	Snippets bool
+}
+
+// Analyzer is a backend that checks code. The findings of every enabled analyzer are merged
+// into one ScanResult; ast-grep and go-analysis are built in and others are added with
+// Options.Analyzers.
+type Analyzer interface {
+	// Name identifies the analyzer in findings and matches the Tool of the community rules it imports
+	Name() string
+	// Capabilities describes what the analyzer supports
+	Capabilities() AnalyzerCapabilities
+	// DiscoverRules lists the rules the analyzer runs for project
+	DiscoverRules(ctx context.Context, project Project) ([]RuleInfo, error)
+	// ScanFiles checks files on disk. An error means the analyzer could not run at all.
+	ScanFiles(ctx context.Context, project Project, files []string) (*ScanResult, error)
+	// ScanSnippet checks code written in language. It is only called when Capabilities
+	// reports Snippets.
+	ScanSnippet(ctx context.Context, project Project, code, language string) (*ScanResult, error)
+}
+
+// RuleImporter is implemented by analyzers that can install community rules
+type RuleImporter interface {
+	// ImportRule validates a rule file and saves it under fileName in the project's rules,
+	// returning the path written
+	ImportRule(ctx context.Context, project Project, fileName string, content []byte) (string, error)
+}
+
+// analyzers returns the enabled analyzers: ast-grep, run with the binary at sgPath, the
+// go/analysis passes, and those of Options.Analyzers
+func (s *Server) analyzers(sgPath string) []Analyzer {
+	analyzers := []Analyzer{
+		&astGrepAnalyzer{server: s, sgPath: sgPath},
+		&goAnalysisAnalyzer{registered: s.goAnalyzers},
+	}
+	return append(analyzers, s.extraAnalyzers...)
+}
+
+// defaultAnalyzers keeps the analyzers a scan runs when it names none. The go/analysis passes
+// only run by default when goAnalysis.enabled is set in the sgconfig.yml at sgconfigPath.
+func defaultAnalyzers(analyzers []Analyzer, sgconfigPath string) []Analyzer {
+	goAnalysis := false
+	if config, err := readSgConfig(sgconfigPath); err == nil && config.GoAnalysis != nil {
+		goAnalysis = config.GoAnalysis.Enabled
+	}
+
+	var kept []Analyzer
+	for _, analyzer := range analyzers {
+		if analyzer.Name() == GoAnalysisAnalyzerName && !goAnalysis {
+			continue
+		}
+		kept = append(kept, analyzer)
+	}
+	return kept
+}
+
+// analyzerNames returns the names of analyzers, sorted
+func analyzerNames(analyzers []Analyzer) []string {
+	names := make([]string, 0, len(analyzers))
+	for _, analyzer := range analyzers {
+		names = append(names, analyzer.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectAnalyzers keeps the analyzers named in names, or all of them when names is empty
+func selectAnalyzers(analyzers []Analyzer, names []string) ([]Analyzer, error) {
+	if len(names) == 0 {
+		return analyzers, nil
+	}
+
+	byName := make(map[string]Analyzer)
+	for _, analyzer := range analyzers {
+		byName[analyzer.Name()] = analyzer
+	}
+
+	var selected []Analyzer
+	for _, name := range names {
+		analyzer, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("analyzer '%s' is not enabled (enabled: %s)", name, strings.Join(analyzerNames(analyzers), ", "))
+		}
+		selected = append(selected, analyzer)
+	}
+	return selected, nil
+}
+
+// analyzerFiles keeps the files in a language the analyzer checks, telling the languages of
+// the files under projectRoot apart with languages
+func analyzerFiles(analyzer Analyzer, files []string, languages *languageRegistry, projectRoot string) []string {
+	checked := analyzer.Capabilities().Languages
+	if len(checked) == 0 {
+		return files
+	}
+
+	var kept []string
+	for _, file := range files {
+		for _, language := range checked {
+			if languages.matches(relativeToProjectRoot(file, projectRoot), language) {
+				kept = append(kept, file)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// mergeAnalyzerResult adds the findings and diagnostics of one analyzer run to merged. Findings
+// are tagged with the analyzer's name and a failed run becomes an error diagnostic.
+func mergeAnalyzerResult(merged *ScanResult, analyzer Analyzer, result *ScanResult, err error) {
+	if err != nil {
+		merged.Diagnostics = append(merged.Diagnostics, Diagnostic{
+			Level:   DiagnosticError,
+			Source:  analyzer.Name(),
+			Message: err.Error(),
+		})
+		return
+	}
+	for _, finding := range result.Findings {
+		if finding.Analyzer == "" {
+			finding.Analyzer = analyzer.Name()
+		}
+		merged.Findings = append(merged.Findings, finding)
+	}
+	merged.Diagnostics = append(merged.Diagnostics, result.Diagnostics...)
+}
+
+// astGrepAnalyzer runs the ast-grep rules configured in sgconfig.yml
+type astGrepAnalyzer struct {
+	server *Server
+	sgPath string
+	// ruleFile, when set, is scanned on its own instead of the rules configured in sgconfig.yml
+	ruleFile string
+}
+
+func (a *astGrepAnalyzer) Name() string {
+	return AstGrepAnalyzerName
+}
+
+func (a *astGrepAnalyzer) Capabilities() AnalyzerCapabilities {
+	return AnalyzerCapabilities{Snippets: true}
+}
+
+func (a *astGrepAnalyzer) DiscoverRules(ctx context.Context, project Project) ([]RuleInfo, error) {
+	docs, _, err := loadRuleDocuments(project.SgconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return ruleInfos(docs, project.Root, "", ""), nil
+}
+
+// ruleArgs selects the rules to run, either --config <sgconfig> or --rule <file>. A rule file
+// run on its own still gets the project's config, for its utilDirs and custom languages.
+func (a *astGrepAnalyzer) ruleArgs(project Project) []string {
+	if a.ruleFile != "" {
+		return append([]string{"--rule", a.ruleFile}, configArgs(project.SgconfigPath)...)
+	}
+	return []string{"--config", project.SgconfigPath}
+}
+
+// configArgs passes the sgconfig.yml at sgconfigPath to ast-grep alongside --rule, when it
+// exists. ast-grep only knows the utility rules referenced by matches: and the custom
+// languages through it.
+func configArgs(sgconfigPath string) []string {
+	if sgconfigPath == "" {
+		return nil
+	}
+	if info, err := os.Stat(sgconfigPath); err != nil || info.IsDir() {
+		return nil
+	}
+	return []string{"--config", sgconfigPath}
+}
+
+func (a *astGrepAnalyzer) ScanFiles(ctx context.Context, project Project, files []string) (*ScanResult, error) {
+	if len(files) == 0 {
+		return newScanResult(nil, nil), nil
+	}
+
+	// A previewed rule is scanned once, so caching it would only grow the cache
+	var cache *scanCache
+	if a.ruleFile == "" && !a.server.disableScanCache {
+		cache = a.server.loadProjectScanCache(ctx, a.sgPath, project)
+	}
+	return a.scanFiles(ctx, project, files, cache)
+}
+
+// scanArgs returns the ast-grep arguments scanning files
+func (a *astGrepAnalyzer) scanArgs(project Project, files []string) []string {
+	args := append([]string{"scan"}, a.ruleArgs(project)...)
+	args = append(args, files...)
+	return append(args, "--json")
+}
+
+func (a *astGrepAnalyzer) ScanSnippet(ctx context.Context, project Project, code, language string) (*ScanResult, error) {
+	// ast-grep tells the language of the snippet from the extension of its file
+	spec, err := loadLanguages(project.SgconfigPath).resolve(language)
+	if err != nil {
+		return nil, err
+	}
+	if len(spec.Extensions) == 0 {
+		return nil, fmt.Errorf("language '%s' has no file extension to scan a snippet with", spec.Name)
+	}
+	tmpfile, err := os.CreateTemp("", "ast-grep-scan.*."+spec.Extensions[0])
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(code)); err != nil {
+		return nil, fmt.Errorf("error writing to temporary file: %v", err)
+	}
+
+	if err := tmpfile.Close(); err != nil {
+		return nil, fmt.Errorf("error closing temporary file: %v", err)
+	}
+
+	// Run ast-grep from the project root
+	args := append([]string{"scan"}, a.ruleArgs(project)...)
+	findings, diagnostics := a.server.runAstGrepScan(ctx, a.sgPath, project.Root, append(args, tmpfile.Name(), "--json"))
+
+	// The temporary file name is meaningless to the caller
+	for i := range findings {
+		findings[i].File = snippetFileName
+	}
+
+	return newScanResult(findings, diagnostics), nil
+}
+
+func (a *astGrepAnalyzer) ImportRule(ctx context.Context, project Project, fileName string, content []byte) (string, error) {
+	// Validate the YAML content before writing to disk
+	if err := a.server.validateRule(ctx, project.SgconfigPath, string(content)); err != nil {
+		return "", fmt.Errorf("invalid rule file: %v", err)
+	}
+
+	ruleDir, err := ruleDirFor(project.SgconfigPath, "")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(ruleDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating rule directory: %v", err)
+	}
+	ruleFile := filepath.Join(ruleDir, fileName)
+	if err := os.WriteFile(ruleFile, content, 0644); err != nil {
+		return "", fmt.Errorf("error writing rule file: %v", err)
+	}
+	return ruleFile, nil
+}
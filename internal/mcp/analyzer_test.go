@@ -0,0 +1,231 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeAnalyzer reports one finding per scanned file and records what it was asked to do
+type fakeAnalyzer struct {
+	name      string
+	languages []string
+	err       error
+
+	scanned  []string
+	imported map[string]string
+}
+
+func (a *fakeAnalyzer) Name() string {
+	return a.name
+}
+
+func (a *fakeAnalyzer) Capabilities() AnalyzerCapabilities {
+	return AnalyzerCapabilities{Languages: a.languages}
+}
+
+func (a *fakeAnalyzer) DiscoverRules(ctx context.Context, project Project) ([]RuleInfo, error) {
+	return []RuleInfo{{ID: a.name + "-rule", Language: "go", Severity: "warning"}}, nil
+}
+
+func (a *fakeAnalyzer) ScanFiles(ctx context.Context, project Project, files []string) (*ScanResult, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	var findings []Finding
+	for _, file := range files {
+		a.scanned = append(a.scanned, filepath.Base(file))
+		findings = append(findings, Finding{RuleID: a.name + "-rule", Severity: "warning", File: relativeToProjectRoot(file, project.Root), StartLine: 1})
+	}
+	return newScanResult(findings, nil), nil
+}
+
+func (a *fakeAnalyzer) ScanSnippet(ctx context.Context, project Project, code, language string) (*ScanResult, error) {
+	return nil, errors.New("snippets are not supported")
+}
+
+func (a *fakeAnalyzer) ImportRule(ctx context.Context, project Project, fileName string, content []byte) (string, error) {
+	if a.imported == nil {
+		a.imported = make(map[string]string)
+	}
+	a.imported[fileName] = string(content)
+	return filepath.Join(project.Root, fileName), nil
+}
+
+// writeAnalyzerProject creates a project with one rule, a Go file and a Python file, and a fake
+// ast-grep that touches the returned marker file whenever it runs
+func writeAnalyzerProject(t *testing.T) (projectRoot, sgPath, marker string) {
+	t.Helper()
+	projectRoot = writeRuleProject(t, "no-panic")
+	os.WriteFile(filepath.Join(projectRoot, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(projectRoot, "app.py"), []byte("print(1)\n"), 0644)
+
+	binDir := t.TempDir()
+	marker = filepath.Join(binDir, "ran")
+	sgPath = writeFakeAstGrep(t, binDir, "#!/bin/sh\ntouch '"+marker+"'\necho '[]'\n")
+	return projectRoot, sgPath, marker
+}
+
+func TestScanPathMergesAnalyzers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot, sgPath, marker := writeAnalyzerProject(t)
+	vet := &fakeAnalyzer{name: "go-vet", languages: []string{"go"}}
+	broken := &fakeAnalyzer{name: "broken", err: errors.New("not installed")}
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath, Analyzers: []Analyzer{vet, broken}})
+
+	t.Run("All analyzers", func(t *testing.T) {
+		result, err := s.ScanPath(context.Background(), ScanPathOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if _, err := os.Stat(marker); err != nil {
+			t.Error("Expected ast-grep to run")
+		}
+		if strings.Join(vet.scanned, ",") != "main.go" {
+			t.Errorf("Expected only the Go file to reach go-vet, got %v", vet.scanned)
+		}
+		if len(result.Findings) != 1 || result.Findings[0].Analyzer != "go-vet" || result.Findings[0].File != "main.go" {
+			t.Errorf("Expected the go-vet finding tagged with its analyzer, got %+v", result.Findings)
+		}
+		if len(result.Diagnostics) != 1 || result.Diagnostics[0].Source != "broken" || result.Diagnostics[0].Level != DiagnosticError {
+			t.Errorf("Expected the failing analyzer to be reported as a diagnostic, got %+v", result.Diagnostics)
+		}
+	})
+
+	t.Run("Selected analyzer", func(t *testing.T) {
+		os.Remove(marker)
+		vet.scanned = nil
+		result, err := s.ScanPath(context.Background(), ScanPathOptions{Analyzers: []string{"go-vet"}})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Error("Expected ast-grep not to run")
+		}
+		if len(result.Findings) != 1 || len(result.Diagnostics) != 0 {
+			t.Errorf("Expected only the go-vet results, got %+v", result)
+		}
+	})
+
+	t.Run("Unknown analyzer", func(t *testing.T) {
+		_, err := s.ScanPath(context.Background(), ScanPathOptions{Analyzers: []string{"semgrep"}})
+		if err == nil || !strings.Contains(err.Error(), "analyzer 'semgrep' is not enabled (enabled: ast-grep, broken, go-analysis, go-vet)") {
+			t.Errorf("Expected the unknown analyzer to be rejected, got: %v", err)
+		}
+	})
+
+	t.Run("Analyzers argument", func(t *testing.T) {
+		result, err := s.RunTool(context.Background(), "scan_path", map[string]interface{}{"path": ".", "analyzers": "go-vet, ast-grep"})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var scan ScanResult
+		if err := json.Unmarshal([]byte(toolResultText(t, result)), &scan); err != nil {
+			t.Fatalf("Expected a findings document, got: %v", err)
+		}
+		if len(scan.Findings) != 1 || scan.Findings[0].Analyzer != "go-vet" {
+			t.Errorf("Expected the go-vet finding, got %+v", scan.Findings)
+		}
+	})
+}
+
+func TestListRulesIncludesAnalyzers(t *testing.T) {
+	s := NewServer(Options{
+		ProjectRoot: writeRuleProject(t, "no-panic"),
+		Analyzers:   []Analyzer{&fakeAnalyzer{name: "go-vet"}},
+	})
+
+	list, err := s.ListRules(context.Background(), "go", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(list.Rules) != 2 || list.Rules[0].Analyzer != AstGrepAnalyzerName || list.Rules[1].ID != "go-vet-rule" || list.Rules[1].Analyzer != "go-vet" {
+		t.Errorf("Expected the rules of both analyzers, got %+v", list.Rules)
+	}
+
+	list, err = s.ListRules(context.Background(), "", "warning")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(list.Rules) != 1 || list.Rules[0].ID != "go-vet-rule" {
+		t.Errorf("Expected the severity filter to apply to every analyzer, got %+v", list.Rules)
+	}
+}
+
+func TestImportCommunityRuleSelectsAnalyzer(t *testing.T) {
+	index := CommunityRuleIndex{Version: 1, Rules: []CommunityRule{
+		{ID: "vet-printf", Tool: "go-vet", Path: "rules/go-vet/printf.json"},
+		{ID: "semgrep-rule", Tool: "semgrep", Path: "rules/semgrep/rule.yml"},
+	}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.json" {
+			json.NewEncoder(w).Encode(index)
+			return
+		}
+		w.Write([]byte(`{"enable": ["printf"]}`))
+	}))
+	defer ts.Close()
+
+	vet := &fakeAnalyzer{name: "go-vet"}
+	s := NewServer(Options{
+		ProjectRoot:       writeRuleProject(t, "no-panic"),
+		CommunityIndexURL: ts.URL + "/index.json",
+		Analyzers:         []Analyzer{vet},
+	})
+
+	importRule := func(ruleID string) *mcp.CallToolResult {
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]interface{}{"rule_id": ruleID}
+		result, err := s.importCommunityRuleHandler(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return result
+	}
+
+	if result := importRule("vet-printf"); result.IsError {
+		t.Fatalf("Expected the rule to be imported, got: %s", toolResultText(t, result))
+	}
+	if vet.imported["printf.json"] != `{"enable": ["printf"]}` {
+		t.Errorf("Expected go-vet to import the rule content, got %v", vet.imported)
+	}
+
+	result := importRule("semgrep-rule")
+	if !result.IsError || !strings.Contains(toolResultText(t, result), "'semgrep', which is not an enabled analyzer") {
+		t.Errorf("Expected a rule for a disabled analyzer to be rejected, got: %s", toolResultText(t, result))
+	}
+}
+
+func TestAstGrepImportRuleCreatesRuleDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot := t.TempDir()
+	writeTree(t, projectRoot, map[string]string{"sgconfig.yml": "ruleDirs:\n  - rules\n"})
+	sgPath := writeFakeAstGrep(t, t.TempDir(), "#!/bin/sh\necho '[]'\n")
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath})
+
+	analyzer := &astGrepAnalyzer{server: s, sgPath: sgPath}
+	project := Project{Root: projectRoot, SgconfigPath: filepath.Join(projectRoot, "sgconfig.yml")}
+	ruleFile, err := analyzer.ImportRule(context.Background(), project, "no-panic.yml", []byte("id: no-panic\nlanguage: go\nrule:\n  pattern: panic($$$)\n"))
+	if err != nil {
+		t.Fatalf("Expected the rule to be imported, got: %v", err)
+	}
+	if ruleFile != filepath.Join(projectRoot, "rules", "no-panic.yml") {
+		t.Errorf("Expected the rule in the missing rule directory, got %s", ruleFile)
+	}
+	if _, err := os.Stat(ruleFile); err != nil {
+		t.Errorf("Expected the rule to be written: %v", err)
+	}
+}
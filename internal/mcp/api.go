@@ -0,0 +1,129 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// RuleSpec is a rule to save with AddRule
+type RuleSpec struct {
+	// ID names the rule file, <ID>.yml. An existing rule with that id is updated where it is.
+	ID string
+	// YAML is the ast-grep rule
+	YAML string
+	// ValidExamples and InvalidExamples, when given, are written as the rule's ast-grep test case
+	ValidExamples   []string
+	InvalidExamples []string
+	// RuleDir is the ruleDirs entry of sgconfig.yml to save a new rule in; empty means the first
+	RuleDir string
+	// Scope is a file or directory of a sub-project, relative to the project root. The rule is
+	// saved with the sgconfig.yml nearest to it; empty means the project's own sgconfig.yml.
+	Scope string
+}
+
+// toolResultError converts the tool result describing why an operation could not run into an error
+func toolResultError(result *mcp.CallToolResult) error {
+	var messages []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			messages = append(messages, strings.TrimPrefix(text.Text, "Error: "))
+		}
+	}
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// ScanPath scans the files selected by opts with the project's rules, like the scan_path tool.
+// Path defaults to the whole project and Sgconfig to the project's sgconfig.yml. When ctx is
+// done before every file is scanned, the partial result is returned with an error wrapping
+// ErrScanIncomplete.
+func (s *Server) ScanPath(ctx context.Context, opts ScanPathOptions) (*ScanResult, error) {
+	if opts.Path == "" {
+		opts.Path = "."
+	}
+	if opts.Sgconfig == "" {
+		opts.Sgconfig = "sgconfig.yml"
+	}
+	opts.LanguageFilter = strings.ToLower(opts.LanguageFilter)
+
+	outcome, errResult := s.runScanPath(ctx, opts)
+	if errResult != nil {
+		return nil, toolResultError(errResult)
+	}
+	if unscanned := len(outcome.Result.Unscanned); unscanned > 0 {
+		return outcome.Result, fmt.Errorf("%w: %d file(s) were not scanned: %w", ErrScanIncomplete, unscanned, ctx.Err())
+	}
+	return outcome.Result, nil
+}
+
+// ScanCode scans a snippet of code written in language with the project's rules, like the
+// scan_code tool
+func (s *Server) ScanCode(ctx context.Context, code, language string) (*ScanResult, error) {
+	result, _, errResult := s.scanCode(ctx, code, language, "sgconfig.yml")
+	if errResult != nil {
+		return nil, toolResultError(errResult)
+	}
+	return result, nil
+}
+
+// AddRule validates and saves a rule, like the add_or_update_rule tool
+func (s *Server) AddRule(ctx context.Context, spec RuleSpec) error {
+	if spec.ID == "" {
+		return errors.New("rule ID is required")
+	}
+	if _, errResult := s.addRule(ctx, spec); errResult != nil {
+		return toolResultError(errResult)
+	}
+	return nil
+}
+
+// RemoveRule deletes a rule of the project's own sgconfig.yml and its test cases, like the
+// remove_rule tool
+func (s *Server) RemoveRule(ctx context.Context, ruleID string) error {
+	removed, errResult := s.removeRule(ruleID, "")
+	if errResult != nil {
+		return toolResultError(errResult)
+	}
+	if !removed {
+		return fmt.Errorf("rule '%s' not found", ruleID)
+	}
+	return nil
+}
+
+// ListRules returns the project's rules, like the list_rules tool. Empty filters match every rule.
+func (s *Server) ListRules(ctx context.Context, language, severity string) (*RuleList, error) {
+	list, errResult := s.listRules(ctx, "sgconfig.yml", strings.ToLower(language), strings.ToLower(severity))
+	if errResult != nil {
+		return nil, toolResultError(errResult)
+	}
+	return list, nil
+}
+
+// GetConfig returns the project's resolved sgconfig.yml, like the get_config tool. Sgconfig
+// defaults to the project's sgconfig.yml.
+func (s *Server) GetConfig(ctx context.Context, sgconfig string) (*ProjectConfig, error) {
+	if sgconfig == "" {
+		sgconfig = "sgconfig.yml"
+	}
+	projectRoot, sgconfigPath, errResult := s.ruleSet(sgconfig)
+	if errResult != nil {
+		return nil, toolResultError(errResult)
+	}
+	return s.projectConfig(projectRoot, sgconfigPath)
+}
+
+// RunTool runs one of the server's MCP tools directly, without a transport
+func (s *Server) RunTool(ctx context.Context, name string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	tool := s.newMCPServer().GetTool(name)
+	if tool == nil {
+		return nil, fmt.Errorf("tool '%s' not found", name)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = args
+	return tool.Handler(ctx, req)
+}
@@ -0,0 +1,97 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeRuleProject creates a project with one rule
+func writeRuleProject(t *testing.T, ruleID string) string {
+	t.Helper()
+	projectRoot := t.TempDir()
+	os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n"), 0644)
+	os.MkdirAll(filepath.Join(projectRoot, "rules"), 0755)
+	os.WriteFile(filepath.Join(projectRoot, "rules", ruleID+".yml"), []byte("id: "+ruleID+"\nlanguage: go\nrule:\n  pattern: panic($$$)\n"), 0644)
+	return projectRoot
+}
+
+func TestServersAreIndependent(t *testing.T) {
+	first := NewServer(Options{ProjectRoot: writeRuleProject(t, "first-rule")})
+	second := NewServer(Options{ProjectRoot: writeRuleProject(t, "second-rule")})
+
+	for server, expected := range map[*Server]string{first: "first-rule", second: "second-rule"} {
+		list, err := server.ListRules(context.Background(), "", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(list.Rules) != 1 || list.Rules[0].ID != expected {
+			t.Errorf("Expected only %s, got %+v", expected, list.Rules)
+		}
+	}
+}
+
+func TestAddAndRemoveRule(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot := writeRuleProject(t, "existing")
+	s := NewServer(Options{
+		ProjectRoot: projectRoot,
+		AstGrepPath: writeFakeAstGrep(t, t.TempDir(), "#!/bin/sh\necho '[]'\n"),
+	})
+	ctx := context.Background()
+
+	if err := s.AddRule(ctx, RuleSpec{ID: "typo", YAML: "id: typo\nlanguage: go\nrule:\n  patern: x\n"}); err == nil || !strings.Contains(err.Error(), "unknown rule key 'patern'") {
+		t.Errorf("Expected the invalid rule to be rejected, got: %v", err)
+	}
+
+	spec := RuleSpec{
+		ID:              "no-fmt-println",
+		YAML:            "id: no-fmt-println\nlanguage: go\nrule:\n  pattern: fmt.Println($$$)\n",
+		InvalidExamples: []string{"fmt.Println(x)"},
+	}
+	if err := s.AddRule(ctx, spec); err != nil {
+		t.Fatalf("Expected the rule to be added, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, "rules", "no-fmt-println.yml")); err != nil {
+		t.Errorf("Expected the rule file to be written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, "rule-tests", "no-fmt-println-test.yml")); err != nil {
+		t.Errorf("Expected the test case to be written: %v", err)
+	}
+
+	if err := s.RemoveRule(ctx, "no-fmt-println"); err != nil {
+		t.Fatalf("Expected the rule to be removed, got: %v", err)
+	}
+	if err := s.RemoveRule(ctx, "no-fmt-println"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, got: %v", err)
+	}
+}
+
+func TestScanPathWithoutConfig(t *testing.T) {
+	s := NewServer(Options{ProjectRoot: t.TempDir()})
+	_, err := s.ScanPath(context.Background(), ScanPathOptions{})
+	if err == nil || !strings.HasPrefix(err.Error(), "sgconfig.yml not found") {
+		t.Errorf("Expected the missing configuration to be reported, got: %v", err)
+	}
+}
+
+func TestRunTool(t *testing.T) {
+	s := NewServer(Options{ProjectRoot: writeRuleProject(t, "only-rule")})
+
+	result, err := s.RunTool(context.Background(), "get_rule", map[string]interface{}{"rule_id": "only-rule"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if text := toolResultText(t, result); !strings.Contains(text, "pattern: panic($$$)") {
+		t.Errorf("Expected the rule YAML, got: %s", text)
+	}
+
+	if _, err := s.RunTool(context.Background(), "no_such_tool", nil); err == nil {
+		t.Error("Expected an unknown tool to be rejected")
+	}
+}
@@ -0,0 +1,321 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultBaselineFile is the baseline file name, relative to the project root.
+// It is meant to be committed alongside sgconfig.yml.
+const defaultBaselineFile = "sherpa-baseline.json"
+
+// baselineVersion is the version of the baseline file format
+const baselineVersion = 1
+
+// Baseline is a snapshot of accepted findings. Findings matching an entry are not reported
+// when a scan runs in baseline mode.
+type Baseline struct {
+	Version int             `json:"version"`
+	Entries []BaselineEntry `json:"entries"`
+}
+
+// BaselineEntry is a group of identical findings in one file.
+// The fingerprint covers the rule id, the file and a hash of the normalized matched code,
+// so entries survive lines being added or removed elsewhere in the file.
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	RuleID      string `json:"rule_id"`
+	File        string `json:"file"`
+	CodeHash    string `json:"code_hash"`
+	Count       int    `json:"count"`
+	Message     string `json:"message,omitempty"`
+}
+
+// normalizedCodeHash hashes the matched text with all whitespace collapsed,
+// so re-indenting or re-wrapping code does not invalidate a baseline entry
+func normalizedCodeHash(text string) string {
+	normalized := strings.Join(strings.Fields(text), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// findingFingerprint returns the baseline fingerprint of a finding
+func findingFingerprint(finding Finding) string {
+	sum := sha256.Sum256([]byte(finding.RuleID + "\x00" + finding.File + "\x00" + normalizedCodeHash(finding.Text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// newBaseline builds a baseline from the given findings
+func newBaseline(findings []Finding) *Baseline {
+	byFingerprint := make(map[string]*BaselineEntry)
+	for _, finding := range findings {
+		fingerprint := findingFingerprint(finding)
+		if entry, ok := byFingerprint[fingerprint]; ok {
+			entry.Count++
+			continue
+		}
+		byFingerprint[fingerprint] = &BaselineEntry{
+			Fingerprint: fingerprint,
+			RuleID:      finding.RuleID,
+			File:        finding.File,
+			CodeHash:    normalizedCodeHash(finding.Text),
+			Count:       1,
+			Message:     finding.Message,
+		}
+	}
+
+	baseline := &Baseline{Version: baselineVersion, Entries: []BaselineEntry{}}
+	for _, entry := range byFingerprint {
+		baseline.Entries = append(baseline.Entries, *entry)
+	}
+	sortBaselineEntries(baseline.Entries)
+	return baseline
+}
+
+// sortBaselineEntries orders entries by file, rule id and fingerprint so the file diffs cleanly
+func sortBaselineEntries(entries []BaselineEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].File != entries[j].File {
+			return entries[i].File < entries[j].File
+		}
+		if entries[i].RuleID != entries[j].RuleID {
+			return entries[i].RuleID < entries[j].RuleID
+		}
+		return entries[i].Fingerprint < entries[j].Fingerprint
+	})
+}
+
+// loadBaseline reads a baseline file
+func loadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("error parsing baseline file: %v", err)
+	}
+	if baseline.Version != baselineVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d (expected %d)", baseline.Version, baselineVersion)
+	}
+
+	return &baseline, nil
+}
+
+// writeBaseline writes a baseline file
+func writeBaseline(path string, baseline *Baseline) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding baseline: %v", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// filterBaselined drops findings covered by the baseline and returns the remaining ones
+// together with the number of findings dropped. When ignoreFile is set, entries match on
+// rule id and code alone, which is what scan_code needs since snippets have no file.
+func filterBaselined(findings []Finding, baseline *Baseline, ignoreFile bool) ([]Finding, int) {
+	remaining := make(map[string]int)
+	for _, entry := range baseline.Entries {
+		remaining[baselineKey(entry.Fingerprint, entry.RuleID, entry.CodeHash, ignoreFile)] += entry.Count
+	}
+
+	kept := make([]Finding, 0, len(findings))
+	matched := 0
+	for _, finding := range findings {
+		key := baselineKey(findingFingerprint(finding), finding.RuleID, normalizedCodeHash(finding.Text), ignoreFile)
+		if remaining[key] > 0 {
+			remaining[key]--
+			matched++
+			continue
+		}
+		kept = append(kept, finding)
+	}
+
+	return kept, matched
+}
+
+// baselineKey returns the key used to match findings against baseline entries
+func baselineKey(fingerprint, ruleID, codeHash string, ignoreFile bool) string {
+	if ignoreFile {
+		return ruleID + "\x00" + codeHash
+	}
+	return fingerprint
+}
+
+// pruneBaseline removes entries that no longer match a finding. Only entries for scanned
+// files (or files that no longer exist) are considered, so pruning a subdirectory leaves
+// the rest of the baseline untouched. It returns the number of findings removed.
+func pruneBaseline(baseline *Baseline, findings []Finding, scannedFiles []string, projectRoot string) int {
+	scanned := make(map[string]bool, len(scannedFiles))
+	for _, file := range scannedFiles {
+		scanned[file] = true
+	}
+
+	current := make(map[string]int)
+	for _, finding := range findings {
+		current[findingFingerprint(finding)]++
+	}
+
+	removed := 0
+	entries := make([]BaselineEntry, 0, len(baseline.Entries))
+	for _, entry := range baseline.Entries {
+		if !scanned[entry.File] {
+			if _, err := os.Stat(resolvePathRelativeToProjectRoot(entry.File, projectRoot)); err == nil {
+				entries = append(entries, entry)
+				continue
+			}
+		}
+
+		count := entry.Count
+		if current[entry.Fingerprint] < count {
+			count = current[entry.Fingerprint]
+		}
+		removed += entry.Count - count
+		if count > 0 {
+			entry.Count = count
+			entries = append(entries, entry)
+		}
+	}
+
+	baseline.Entries = entries
+	return removed
+}
+
+// mergeBaseline replaces the entries of the scanned files with those of fresh, keeping the
+// entries of every other file, so snapshotting a subdirectory leaves the rest of the baseline
+// untouched
+func mergeBaseline(baseline, fresh *Baseline, scannedFiles []string) {
+	scanned := make(map[string]bool, len(scannedFiles))
+	for _, file := range scannedFiles {
+		scanned[file] = true
+	}
+
+	entries := make([]BaselineEntry, 0, len(baseline.Entries)+len(fresh.Entries))
+	for _, entry := range baseline.Entries {
+		if !scanned[entry.File] {
+			entries = append(entries, entry)
+		}
+	}
+	entries = append(entries, fresh.Entries...)
+	sortBaselineEntries(entries)
+	baseline.Entries = entries
+}
+
+// baselinePathFromRequest resolves the baseline_file argument against the project root
+func baselinePathFromRequest(req mcp.CallToolRequest, projectRoot string) string {
+	baselineFile := defaultBaselineFile
+	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
+		if file, ok := args["baseline_file"].(string); ok && file != "" {
+			baselineFile = file
+		}
+	}
+	return resolvePathRelativeToProjectRoot(baselineFile, projectRoot)
+}
+
+// baselineModeRequested reports whether a scan request asked for baseline mode
+func baselineModeRequested(req mcp.CallToolRequest) bool {
+	return req.GetBool("baseline", false)
+}
+
+// applyBaseline filters a scan result through the baseline file selected by the request
+func applyBaseline(req mcp.CallToolRequest, result *ScanResult, projectRoot string, ignoreFile bool) *mcp.CallToolResult {
+	baselinePath := baselinePathFromRequest(req, projectRoot)
+	baseline, err := loadBaseline(baselinePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return mcp.NewToolResultError(fmt.Sprintf("Baseline file '%s' not found. Run the 'create_baseline' tool first.", baselinePath))
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Error loading baseline: %v", err))
+	}
+
+	findings, matched := filterBaselined(result.Findings, baseline, ignoreFile)
+	result.Findings = findings
+	if matched > 0 {
+		result.Diagnostics = append(result.Diagnostics, Diagnostic{
+			Level:   DiagnosticInfo,
+			Source:  "baseline",
+			Message: fmt.Sprintf("%d finding(s) hidden because they are recorded in the baseline", matched),
+		})
+	}
+
+	return nil
+}
+
+// createBaselineHandler handles the create_baseline tool
+func (s *Server) createBaselineHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts, err := scanPathOptionsFromRequest(req, ".")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	outcome, errResult := s.runScanPath(ctx, opts)
+	if errResult != nil {
+		return errResult, nil
+	}
+	// A baseline of a partial scan would be missing the findings of the unscanned files
+	if errResult := incompleteScanError(ctx, outcome.Result); errResult != nil {
+		return errResult, nil
+	}
+
+	baselinePath := baselinePathFromRequest(req, outcome.ProjectRoot)
+	baseline, err := loadBaseline(baselinePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return mcp.NewToolResultError(fmt.Sprintf("Error loading baseline: %v", err)), nil
+		}
+		baseline = newBaseline(nil)
+	}
+	mergeBaseline(baseline, newBaseline(outcome.Result.Findings), outcome.Files)
+	if err := writeBaseline(baselinePath, baseline); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error writing baseline file: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Baseline written to %s with %d finding(s) in %d entries. Commit this file and pass baseline=true to scan_path or scan_code to report only new findings.", baselinePath, len(outcome.Result.Findings), len(baseline.Entries))), nil
+}
+
+// pruneBaselineHandler handles the prune_baseline tool
+func (s *Server) pruneBaselineHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts, err := scanPathOptionsFromRequest(req, ".")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	outcome, errResult := s.runScanPath(ctx, opts)
+	if errResult != nil {
+		return errResult, nil
+	}
+	// The entries of unscanned files would look stale
+	if errResult := incompleteScanError(ctx, outcome.Result); errResult != nil {
+		return errResult, nil
+	}
+
+	baselinePath := baselinePathFromRequest(req, outcome.ProjectRoot)
+	baseline, err := loadBaseline(baselinePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return mcp.NewToolResultText(fmt.Sprintf("Baseline file '%s' not found. Nothing to prune.", baselinePath)), nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Error loading baseline: %v", err)), nil
+	}
+
+	removed := pruneBaseline(baseline, outcome.Result.Findings, outcome.Files, outcome.ProjectRoot)
+	if removed == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("Baseline %s is up to date; no stale entries found.", baselinePath)), nil
+	}
+
+	if err := writeBaseline(baselinePath, baseline); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error writing baseline file: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Pruned %d stale finding(s) from baseline %s; %d entries remain.", removed, baselinePath, len(baseline.Entries))), nil
+}
@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func baselineTestFindings() []Finding {
+	return []Finding{
+		{RuleID: "unchecked-error", File: "main.go", StartLine: 10, Text: "os.Remove(tmp)"},
+		{RuleID: "unchecked-error", File: "main.go", StartLine: 20, Text: "os.Remove(tmp)"},
+		{RuleID: "no-fmt-println", File: "main.go", StartLine: 30, Text: `fmt.Println("x")`},
+		{RuleID: "no-fmt-println", File: "util/log.go", StartLine: 5, Text: `fmt.Println("y")`},
+	}
+}
+
+func TestNewBaseline(t *testing.T) {
+	baseline := newBaseline(baselineTestFindings())
+
+	if baseline.Version != baselineVersion {
+		t.Errorf("Expected version %d, got %d", baselineVersion, baseline.Version)
+	}
+	if len(baseline.Entries) != 3 {
+		t.Fatalf("Expected 3 entries (identical findings grouped), got %d", len(baseline.Entries))
+	}
+
+	// Entries are sorted by file, then rule id
+	if baseline.Entries[0].File != "main.go" || baseline.Entries[0].RuleID != "no-fmt-println" {
+		t.Errorf("Unexpected first entry: %+v", baseline.Entries[0])
+	}
+	if baseline.Entries[1].RuleID != "unchecked-error" || baseline.Entries[1].Count != 2 {
+		t.Errorf("Expected grouped unchecked-error entry with count 2, got %+v", baseline.Entries[1])
+	}
+}
+
+func TestFilterBaselined(t *testing.T) {
+	baseline := newBaseline(baselineTestFindings())
+
+	t.Run("Line shifts and whitespace do not invalidate entries", func(t *testing.T) {
+		findings := []Finding{
+			{RuleID: "unchecked-error", File: "main.go", StartLine: 42, Text: "os.Remove(tmp)"},
+			{RuleID: "no-fmt-println", File: "main.go", StartLine: 99, Text: "fmt.Println(\"x\")  "},
+		}
+
+		kept, matched := filterBaselined(findings, baseline, false)
+		if len(kept) != 0 || matched != 2 {
+			t.Errorf("Expected all findings to be baselined, got %d kept and %d matched", len(kept), matched)
+		}
+	})
+
+	t.Run("New findings are reported", func(t *testing.T) {
+		findings := []Finding{
+			{RuleID: "unchecked-error", File: "main.go", Text: "os.Remove(tmp)"},
+			{RuleID: "unchecked-error", File: "main.go", Text: "os.Remove(tmp)"},
+			{RuleID: "unchecked-error", File: "main.go", Text: "os.Remove(tmp)"},
+			{RuleID: "unchecked-error", File: "other.go", Text: "os.Remove(tmp)"},
+		}
+
+		kept, matched := filterBaselined(findings, baseline, false)
+		if matched != 2 || len(kept) != 2 {
+			t.Errorf("Expected 2 baselined and 2 new findings, got %d matched and %d kept", matched, len(kept))
+		}
+	})
+
+	t.Run("Ignoring the file matches snippets", func(t *testing.T) {
+		findings := []Finding{
+			{RuleID: "no-fmt-println", File: snippetFileName, Text: `fmt.Println("y")`},
+		}
+
+		kept, matched := filterBaselined(findings, baseline, true)
+		if len(kept) != 0 || matched != 1 {
+			t.Errorf("Expected snippet finding to be baselined, got %d kept and %d matched", len(kept), matched)
+		}
+	})
+}
+
+func TestNormalizedCodeHash(t *testing.T) {
+	if normalizedCodeHash("foo(a,\n\t b)") != normalizedCodeHash("foo(a, b)") {
+		t.Error("Expected whitespace differences to produce the same hash")
+	}
+	if normalizedCodeHash("foo(a)") == normalizedCodeHash("foo(b)") {
+		t.Error("Expected different code to produce different hashes")
+	}
+}
+
+func TestPruneBaseline(t *testing.T) {
+	projectRoot := t.TempDir()
+	os.WriteFile(filepath.Join(projectRoot, "main.go"), []byte("package main"), 0644)
+	os.MkdirAll(filepath.Join(projectRoot, "util"), 0755)
+	os.WriteFile(filepath.Join(projectRoot, "util", "log.go"), []byte("package util"), 0644)
+
+	baseline := newBaseline(append(baselineTestFindings(),
+		Finding{RuleID: "no-fmt-println", File: "deleted.go", Text: "fmt.Println()"},
+	))
+
+	// One of the two os.Remove calls was fixed and fmt.Println was removed from main.go.
+	// util/log.go was not scanned, so its entry must survive.
+	current := []Finding{
+		{RuleID: "unchecked-error", File: "main.go", Text: "os.Remove(tmp)"},
+	}
+
+	removed := pruneBaseline(baseline, current, []string{"main.go"}, projectRoot)
+
+	if removed != 3 {
+		t.Errorf("Expected 3 stale findings to be removed, got %d", removed)
+	}
+	if len(baseline.Entries) != 2 {
+		t.Fatalf("Expected 2 entries to remain, got %d: %+v", len(baseline.Entries), baseline.Entries)
+	}
+	for _, entry := range baseline.Entries {
+		if entry.File == "main.go" && entry.Count != 1 {
+			t.Errorf("Expected main.go entry count to drop to 1, got %d", entry.Count)
+		}
+		if entry.File == "deleted.go" {
+			t.Error("Expected entry for a deleted file to be pruned")
+		}
+	}
+}
+
+func TestMergeBaseline(t *testing.T) {
+	baseline := newBaseline(baselineTestFindings())
+
+	// main.go was snapshotted again after its os.Remove calls were fixed; util/log.go was not scanned
+	fresh := newBaseline([]Finding{
+		{RuleID: "no-fmt-println", File: "main.go", Text: `fmt.Println("x")`},
+		{RuleID: "no-fmt-println", File: "main.go", Text: `fmt.Println("z")`},
+	})
+	mergeBaseline(baseline, fresh, []string{"main.go"})
+
+	if len(baseline.Entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d: %+v", len(baseline.Entries), baseline.Entries)
+	}
+	for _, entry := range baseline.Entries {
+		if entry.RuleID == "unchecked-error" {
+			t.Error("Expected the entries of the scanned file to be replaced")
+		}
+	}
+	if last := baseline.Entries[2]; last.File != "util/log.go" {
+		t.Errorf("Expected the entry of the unscanned file to be kept, got %+v", last)
+	}
+}
+
+func TestBaselineRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), defaultBaselineFile)
+	baseline := newBaseline(baselineTestFindings())
+
+	if err := writeBaseline(path, baseline); err != nil {
+		t.Fatalf("Failed to write baseline: %v", err)
+	}
+
+	loaded, err := loadBaseline(path)
+	if err != nil {
+		t.Fatalf("Failed to load baseline: %v", err)
+	}
+	if len(loaded.Entries) != len(baseline.Entries) {
+		t.Errorf("Expected %d entries, got %d", len(baseline.Entries), len(loaded.Entries))
+	}
+
+	os.WriteFile(path, []byte(`{"version": 99, "entries": []}`), 0644)
+	if _, err := loadBaseline(path); err == nil {
+		t.Error("Expected an error for an unsupported baseline version")
+	}
+}
@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// defaultScanBatchSize is the number of files passed to one ast-grep run when
+// Options.ScanBatchSize is not set
+const defaultScanBatchSize = 200
+
+// maxScanBatchArgBytes caps the length of the file arguments of one ast-grep run, whatever the
+// batch size, so command lines stay under the 32767 character limit of Windows and far below
+// ARG_MAX elsewhere
+const maxScanBatchArgBytes = 30000
+
+// astGrepBatch is one ast-grep run over part of the scanned files
+type astGrepBatch struct {
+	files []string
+	// matches are the matches printed by ast-grep, keyed by path relative to the project root
+	matches map[string][]json.RawMessage
+	// failed is set when ast-grep could not run or printed no usable output, and cancelled
+	// when that is because ctx was done, so the files were not scanned
+	failed      bool
+	cancelled   bool
+	diagnostics []Diagnostic
+}
+
+// splitScanBatches splits files, in order, into batches of at most batchSize files whose
+// paths together stay under maxScanBatchArgBytes. Every batch holds at least one file.
+func splitScanBatches(files []string, batchSize int) [][]string {
+	if batchSize <= 0 {
+		batchSize = defaultScanBatchSize
+	}
+
+	var batches [][]string
+	var batch []string
+	argBytes := 0
+	for _, file := range files {
+		if len(batch) > 0 && (len(batch) == batchSize || argBytes+len(file)+1 > maxScanBatchArgBytes) {
+			batches = append(batches, batch)
+			batch = nil
+			argBytes = 0
+		}
+		batch = append(batch, file)
+		argBytes += len(file) + 1
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// scanWorkers returns how many ast-grep runs may execute at once
+func (s *Server) scanWorkers() int {
+	if s.scanWorkerCount > 0 {
+		return s.scanWorkerCount
+	}
+	return runtime.NumCPU()
+}
+
+// runScanBatches scans files with ast-grep in batches, running up to scanWorkers batches at
+// once. Batches are returned in the order of files whatever order they finish in. A batch that
+// fails only loses its own files: its diagnostics name them and the other batches are kept.
+// Once ctx is done, running batches are killed and the others are not started.
+func (a *astGrepAnalyzer) runScanBatches(ctx context.Context, project Project, files []string) []astGrepBatch {
+	s := a.server
+	split := splitScanBatches(files, s.scanBatchSize)
+	batches := make([]astGrepBatch, len(split))
+
+	workers := s.scanWorkers()
+	if workers > len(split) {
+		workers = len(split)
+	}
+	s.logger.Debug("Scanning in batches", "files", len(files), "batches", len(split), "workers", workers)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					batches[i] = astGrepBatch{files: split[i], failed: true, cancelled: true}
+					continue
+				}
+				batches[i] = a.runScanBatch(ctx, project, split[i])
+			}
+		}()
+	}
+	for i := range split {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if len(batches) > 1 {
+		for i := range batches {
+			batches[i].describeErrors(i, len(batches), project.Root)
+		}
+	}
+	return batches
+}
+
+// runScanBatch runs ast-grep once over files
+func (a *astGrepAnalyzer) runScanBatch(ctx context.Context, project Project, files []string) astGrepBatch {
+	batch := astGrepBatch{files: files}
+	output, diagnostics := a.server.runAstGrep(ctx, a.sgPath, project.Root, a.scanArgs(project, files))
+	// A killed ast-grep says nothing about the files; they are reported as not scanned instead
+	if ctx.Err() != nil {
+		batch.failed = true
+		batch.cancelled = true
+		return batch
+	}
+	batch.diagnostics = diagnostics
+	if output == nil {
+		batch.failed = true
+		return batch
+	}
+
+	matches, err := splitAstGrepMatches(output, project.Root)
+	if err != nil {
+		batch.failed = true
+		batch.diagnostics = append(batch.diagnostics, Diagnostic{
+			Level:   DiagnosticError,
+			Source:  "context-sherpa",
+			Message: err.Error(),
+		})
+		return batch
+	}
+	batch.matches = matches
+	return batch
+}
+
+// describeErrors prefixes the error diagnostics of the batch with the batch and its files, so a
+// failure in a scan split into batches can be traced to the files it lost
+func (b *astGrepBatch) describeErrors(index, count int, projectRoot string) {
+	for i, diagnostic := range b.diagnostics {
+		if diagnostic.Level != DiagnosticError {
+			continue
+		}
+		b.diagnostics[i].Message = fmt.Sprintf("batch %d of %d (%d files from %s): %s",
+			index+1, count, len(b.files), relativeToProjectRoot(b.files[0], projectRoot), diagnostic.Message)
+	}
+}
@@ -0,0 +1,83 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSplitScanBatches(t *testing.T) {
+	t.Run("Batch size", func(t *testing.T) {
+		batches := splitScanBatches([]string{"a", "b", "c", "d", "e"}, 2)
+		if fmt.Sprint(batches) != "[[a b] [c d] [e]]" {
+			t.Errorf("Expected batches of two files in order, got %v", batches)
+		}
+	})
+
+	t.Run("Default batch size", func(t *testing.T) {
+		files := make([]string, defaultScanBatchSize+1)
+		for i := range files {
+			files[i] = "f.go"
+		}
+		if batches := splitScanBatches(files, 0); len(batches) != 2 || len(batches[0]) != defaultScanBatchSize {
+			t.Errorf("Expected batches of %d files, got %d batches", defaultScanBatchSize, len(batches))
+		}
+	})
+
+	t.Run("Argument length", func(t *testing.T) {
+		long := strings.Repeat("x", maxScanBatchArgBytes/2)
+		batches := splitScanBatches([]string{long, long, strings.Repeat("y", maxScanBatchArgBytes*2)}, 100)
+		if len(batches) != 3 {
+			t.Errorf("Expected long paths to be split into separate batches, got %d batches", len(batches))
+		}
+	})
+}
+
+func TestScanBatches(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+
+	projectRoot := writeRuleProject(t, "no-panic")
+	for i := 0; i < 10; i++ {
+		os.WriteFile(filepath.Join(projectRoot, fmt.Sprintf("f%d.go", i)), []byte("package main\n\nfunc f() { panic() }\n"), 0644)
+	}
+	sgPath := writeScanningFakeAstGrep(t, t.TempDir(), fakeAstGrepOptions{CrashOn: "CRASH"})
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath, DisableScanCache: true, ScanBatchSize: 3, ScanWorkers: 4})
+
+	t.Run("Findings are merged in file order", func(t *testing.T) {
+		result, err := s.ScanPath(context.Background(), ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(result.Findings) != 10 || len(result.Diagnostics) != 0 {
+			t.Fatalf("Expected a finding per file, got %+v", result)
+		}
+		for i, finding := range result.Findings {
+			if finding.File != fmt.Sprintf("f%d.go", i) {
+				t.Errorf("Expected f%d.go at position %d, got %s", i, i, finding.File)
+			}
+		}
+	})
+
+	t.Run("A crashing batch only loses its own files", func(t *testing.T) {
+		os.WriteFile(filepath.Join(projectRoot, "f4.go"), []byte("package main\n\n// CRASH\n"), 0644)
+
+		result, err := s.ScanPath(context.Background(), ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(result.Findings) != 7 {
+			t.Errorf("Expected the findings of the other batches, got %+v", result.Findings)
+		}
+		if len(result.Diagnostics) != 1 || result.Diagnostics[0].Level != DiagnosticError ||
+			!strings.Contains(result.Diagnostics[0].Message, "batch 2 of 4 (3 files from f3.go)") ||
+			!strings.Contains(result.Diagnostics[0].Message, "panicked") {
+			t.Errorf("Expected an error naming the crashed batch, got %+v", result.Diagnostics)
+		}
+	})
+}
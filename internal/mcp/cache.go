@@ -0,0 +1,336 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stateDirName is the directory in the project root holding context-sherpa's own files. It is
+// never scanned.
+const stateDirName = ".context-sherpa"
+
+// scanCacheFileName is the ast-grep scan cache, inside stateDirName
+const scanCacheFileName = "scan-cache.json"
+
+// scanCacheVersion changes whenever the layout of the cache, or what ast-grep is run with,
+// changes, so caches written by older versions are discarded
+const scanCacheVersion = 1
+
+// scanCache holds the ast-grep matches of each file for one rule set. Matches are kept as
+// ast-grep printed them, so cached and fresh output are parsed the same way.
+type scanCache struct {
+	Version int `json:"version"`
+	// RuleSet is the hash of the rules, sgconfig.yml and ast-grep binary the matches come from
+	RuleSet string `json:"rule_set"`
+	// Files maps paths relative to the project root to their cached matches
+	Files map[string]scanCacheEntry `json:"files"`
+}
+
+// scanCacheEntry is the ast-grep output for one version of a file
+type scanCacheEntry struct {
+	// Hash is the SHA-256 of the file content
+	Hash    string            `json:"hash"`
+	Matches []json.RawMessage `json:"matches"`
+}
+
+// scanCachePath returns the cache file of project. A sgconfig.yml outside the project root,
+// such as that of a sub-project, gets a cache file of its own, so that scanning the
+// sub-projects of a monorepo in turn does not discard each other's caches.
+func scanCachePath(project Project) string {
+	name := scanCacheFileName
+	if configDir := filepath.Dir(project.SgconfigPath); project.SgconfigPath != "" && configDir != filepath.Clean(project.Root) {
+		sum := sha256.Sum256([]byte(relativeToProjectRoot(configDir, project.Root)))
+		name = strings.TrimSuffix(scanCacheFileName, ".json") + "-" + hex.EncodeToString(sum[:8]) + ".json"
+	}
+	return filepath.Join(project.Root, stateDirName, name)
+}
+
+// loadScanCache reads the cache of project, returning an empty cache for ruleSet when there is
+// none or it was written for other rules
+func loadScanCache(project Project, ruleSet string) *scanCache {
+	empty := &scanCache{Version: scanCacheVersion, RuleSet: ruleSet, Files: make(map[string]scanCacheEntry)}
+	data, err := os.ReadFile(scanCachePath(project))
+	if err != nil {
+		return empty
+	}
+	var cache scanCache
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Version != scanCacheVersion || cache.RuleSet != ruleSet || cache.Files == nil {
+		return empty
+	}
+	return &cache
+}
+
+// save writes the cache atomically, dropping the entries of files that no longer exist
+func (c *scanCache) save(project Project) error {
+	projectRoot := project.Root
+	for file := range c.Files {
+		if _, err := os.Stat(filepath.Join(projectRoot, filepath.FromSlash(file))); err != nil {
+			delete(c.Files, file)
+		}
+	}
+
+	dir := filepath.Join(projectRoot, stateDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// The directory only holds generated files, so it keeps itself out of version control
+	gitignore := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(gitignore); os.IsNotExist(err) {
+		os.WriteFile(gitignore, []byte("*\n"), 0644)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, scanCacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), scanCachePath(project))
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ruleSetHash identifies everything ast-grep's output depends on besides the scanned file: the
+// sgconfig.yml, every file under its ruleDirs and utilDirs and the ast-grep binary
+func (s *Server) ruleSetHash(ctx context.Context, sgPath, sgconfigPath string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "version %d\n", scanCacheVersion)
+
+	binary, err := s.astGrepIdentity(ctx, sgPath)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "ast-grep %s\n", binary)
+
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		return "", err
+	}
+	configData, err := os.ReadFile(sgconfigPath)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "sgconfig %d\n", len(configData))
+	h.Write(configData)
+
+	configDir := filepath.Dir(sgconfigPath)
+	var ruleFiles []string
+	for _, ruleDir := range resolveConfigDirs(configDir, append(config.RuleDirs, config.UtilDirs...)) {
+		err := filepath.Walk(ruleDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				ruleFiles = append(ruleFiles, path)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	sort.Strings(ruleFiles)
+	for _, path := range ruleFiles {
+		fileHash, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "rule %s %s\n", filepath.ToSlash(relativeToProjectRoot(path, configDir)), fileHash)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// astGrepIdentity describes the ast-grep binary at sgPath by its version and, so that a binary
+// replaced in place is noticed, its size and modification time. The version is only asked once
+// per binary.
+func (s *Server) astGrepIdentity(ctx context.Context, sgPath string) (string, error) {
+	info, err := os.Stat(sgPath)
+	if err != nil {
+		if resolved, lookErr := exec.LookPath(sgPath); lookErr == nil {
+			info, err = os.Stat(resolved)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	key := fmt.Sprintf("%s %d %d", sgPath, info.Size(), info.ModTime().UnixNano())
+
+	s.scanCacheMu.Lock()
+	defer s.scanCacheMu.Unlock()
+	if version, ok := s.astGrepVersions[key]; ok {
+		return key + " " + version, nil
+	}
+	output, err := exec.CommandContext(ctx, sgPath, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("could not get the ast-grep version: %v", err)
+	}
+	version := strings.TrimSpace(string(output))
+	if s.astGrepVersions == nil {
+		s.astGrepVersions = make(map[string]string)
+	}
+	s.astGrepVersions[key] = version
+	return key + " " + version, nil
+}
+
+// splitAstGrepMatches groups ast-grep JSON output by the file of each match, keyed by path
+// relative to projectRoot
+func splitAstGrepMatches(output []byte, projectRoot string) (map[string][]json.RawMessage, error) {
+	byFile := make(map[string][]json.RawMessage)
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) == 0 {
+		return byFile, nil
+	}
+
+	var matches []json.RawMessage
+	if err := json.Unmarshal(trimmed, &matches); err != nil {
+		return nil, fmt.Errorf("could not parse ast-grep JSON output: %v", err)
+	}
+	for _, raw := range matches {
+		var match struct {
+			File string `json:"file"`
+		}
+		if err := json.Unmarshal(raw, &match); err != nil {
+			return nil, fmt.Errorf("could not parse ast-grep JSON output: %v", err)
+		}
+		file := relativeToProjectRoot(match.File, projectRoot)
+		byFile[file] = append(byFile[file], raw)
+	}
+	return byFile, nil
+}
+
+// loadProjectScanCache returns the scan cache of project for its current rule set, or nil when
+// the rule set cannot be identified and nothing can be cached
+func (s *Server) loadProjectScanCache(ctx context.Context, sgPath string, project Project) *scanCache {
+	ruleSet, err := s.ruleSetHash(ctx, sgPath, project.SgconfigPath)
+	if err != nil {
+		s.logger.Debug("Scan cache disabled", "error", err)
+		return nil
+	}
+	return loadScanCache(project, ruleSet)
+}
+
+// scanFiles scans files with ast-grep. With a cache, the cached matches of the files whose
+// content is unchanged since they were cached for the same rule set are reused, and only the
+// other files are passed to ast-grep. Batches reporting diagnostics are not cached, so their
+// warnings are not lost.
+func (a *astGrepAnalyzer) scanFiles(ctx context.Context, project Project, files []string, cache *scanCache) (*ScanResult, error) {
+	s := a.server
+	matchesByFile := make(map[string][]json.RawMessage)
+	misses := files
+	hashes := make(map[string]string)
+	if cache != nil {
+		misses = nil
+		for _, file := range files {
+			rel := relativeToProjectRoot(file, project.Root)
+			hash, err := hashFile(file)
+			if err != nil {
+				misses = append(misses, file)
+				continue
+			}
+			hashes[rel] = hash
+			if entry, ok := cache.Files[rel]; ok && entry.Hash == hash {
+				matchesByFile[rel] = entry.Matches
+				continue
+			}
+			misses = append(misses, file)
+		}
+		s.logger.Debug("Scan cache", "hits", len(files)-len(misses), "misses", len(misses))
+	}
+
+	var diagnostics []Diagnostic
+	var unscanned []string
+	if len(misses) > 0 {
+		cached := false
+		for _, batch := range a.runScanBatches(ctx, project, misses) {
+			diagnostics = append(diagnostics, batch.diagnostics...)
+			if batch.cancelled {
+				for _, file := range batch.files {
+					unscanned = append(unscanned, relativeToProjectRoot(file, project.Root))
+				}
+			}
+			for file, fileMatches := range batch.matches {
+				matchesByFile[file] = fileMatches
+			}
+			if cache == nil || batch.failed || len(batch.diagnostics) > 0 {
+				continue
+			}
+			for _, file := range batch.files {
+				rel := relativeToProjectRoot(file, project.Root)
+				if hash, ok := hashes[rel]; ok {
+					cache.Files[rel] = scanCacheEntry{Hash: hash, Matches: batch.matches[rel]}
+					cached = true
+				}
+			}
+		}
+
+		if cached {
+			s.scanCacheMu.Lock()
+			err := cache.save(project)
+			s.scanCacheMu.Unlock()
+			if err != nil {
+				s.logger.Warn("Could not save the scan cache", "error", err)
+			}
+		}
+	}
+
+	// Matches are returned in the order of files, as a single ast-grep run would
+	matches := []json.RawMessage{}
+	for _, file := range files {
+		rel := relativeToProjectRoot(file, project.Root)
+		matches = append(matches, matchesByFile[rel]...)
+		delete(matchesByFile, rel)
+	}
+	leftover := make([]string, 0, len(matchesByFile))
+	for file := range matchesByFile {
+		leftover = append(leftover, file)
+	}
+	sort.Strings(leftover)
+	for _, file := range leftover {
+		matches = append(matches, matchesByFile[file]...)
+	}
+
+	output, err := json.Marshal(matches)
+	if err != nil {
+		return nil, err
+	}
+	findings, err := parseAstGrepJSON(output, project.Root)
+	if err != nil {
+		diagnostics = append(diagnostics, Diagnostic{Level: DiagnosticError, Source: "context-sherpa", Message: err.Error()})
+		findings = nil
+	}
+	result := newScanResult(findings, diagnostics)
+	result.Unscanned = unscanned
+	return result, nil
+}
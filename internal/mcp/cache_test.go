@@ -0,0 +1,112 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestScanCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	ctx := context.Background()
+
+	// setup writes a project with two files, one of them panicking
+	setup := func(t *testing.T) (string, string, *Server) {
+		projectRoot := writeRuleProject(t, "no-panic")
+		os.WriteFile(filepath.Join(projectRoot, "a.go"), []byte("package main\n\nfunc a() { panic() }\n"), 0644)
+		os.WriteFile(filepath.Join(projectRoot, "b.go"), []byte("package main\n\nfunc b() {}\n"), 0644)
+		sgPath := writeScanningFakeAstGrep(t, t.TempDir(), fakeAstGrepOptions{WarnOn: "WARN", LogScans: true})
+		return projectRoot, sgPath, NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath})
+	}
+
+	scan := func(t *testing.T, s *Server) *ScanResult {
+		t.Helper()
+		result, err := s.ScanPath(ctx, ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return result
+	}
+
+	t.Run("Unchanged files are served from the cache", func(t *testing.T) {
+		projectRoot, sgPath, s := setup(t)
+
+		first := scan(t, s)
+		second := scan(t, s)
+		if len(first.Findings) != 1 || len(second.Findings) != 1 || second.Findings[0].File != "a.go" || second.Findings[0].RuleID != "no-panic" {
+			t.Fatalf("Expected the same finding from both scans, got %+v and %+v", first.Findings, second.Findings)
+		}
+		if runs := scanLog(t, sgPath); len(runs) != 1 {
+			t.Errorf("Expected ast-grep to run once, got %q", runs)
+		}
+
+		// A new server reads the cache left by the first
+		scan(t, NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath}))
+		if runs := scanLog(t, sgPath); len(runs) != 1 {
+			t.Errorf("Expected the cache to be kept on disk, got %q", runs)
+		}
+		if _, err := os.Stat(filepath.Join(projectRoot, stateDirName, ".gitignore")); err != nil {
+			t.Errorf("Expected the state directory to ignore itself: %v", err)
+		}
+	})
+
+	t.Run("Changed files are rescanned", func(t *testing.T) {
+		projectRoot, sgPath, s := setup(t)
+		scan(t, s)
+
+		os.WriteFile(filepath.Join(projectRoot, "b.go"), []byte("package main\n\nfunc b() { panic() }\n"), 0644)
+		result := scan(t, s)
+		if findingRules(result.Findings) != "no-panic, no-panic" || result.Findings[0].File != "a.go" || result.Findings[1].File != "b.go" {
+			t.Errorf("Expected both files to be reported in order, got %+v", result.Findings)
+		}
+		if runs := scanLog(t, sgPath); len(runs) != 2 || runs[1] != "b.go" {
+			t.Errorf("Expected only b.go to be rescanned, got %q", runs)
+		}
+	})
+
+	t.Run("Rule changes invalidate the cache", func(t *testing.T) {
+		projectRoot, sgPath, s := setup(t)
+		scan(t, s)
+
+		os.WriteFile(filepath.Join(projectRoot, "rules", "no-panic.yml"), []byte("id: no-panic\nlanguage: go\nseverity: warning\nrule:\n  pattern: panic($$$)\n"), 0644)
+		scan(t, s)
+		os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n# changed\n"), 0644)
+		scan(t, s)
+
+		if runs := scanLog(t, sgPath); len(runs) != 3 || runs[1] != "a.go b.go" || runs[2] != "a.go b.go" {
+			t.Errorf("Expected every change to rescan all files, got %q", runs)
+		}
+	})
+
+	t.Run("Runs with diagnostics are not cached", func(t *testing.T) {
+		projectRoot, sgPath, s := setup(t)
+		os.WriteFile(filepath.Join(projectRoot, "b.go"), []byte("package main\n\n// WARN\n"), 0644)
+
+		for i := 0; i < 2; i++ {
+			if result := scan(t, s); len(result.Diagnostics) == 0 {
+				t.Errorf("Expected the warning on every scan, got %+v", result)
+			}
+		}
+		if runs := scanLog(t, sgPath); len(runs) != 2 {
+			t.Errorf("Expected ast-grep to run on every scan, got %q", runs)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		projectRoot, sgPath, _ := setup(t)
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath, DisableScanCache: true})
+		scan(t, s)
+		scan(t, s)
+
+		if runs := scanLog(t, sgPath); len(runs) != 2 {
+			t.Errorf("Expected ast-grep to run on every scan, got %q", runs)
+		}
+		if _, err := os.Stat(filepath.Join(projectRoot, stateDirName)); !os.IsNotExist(err) {
+			t.Errorf("Expected no cache to be written, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// lineRange is an inclusive range of 1-based line numbers
+type lineRange struct {
+	Start int
+	End   int
+}
+
+// changeSet describes the lines changed in the working tree relative to a git ref.
+// Paths are relative to the project root and use forward slashes.
+type changeSet struct {
+	// Hunks maps each changed file to its added or modified line ranges
+	Hunks map[string][]lineRange
+	// WholeFiles holds files that are new to git, where every line counts as changed
+	WholeFiles map[string]bool
+}
+
+// hunkHeaderPattern matches the new-file side of a unified diff hunk header: @@ -a,b +c,d @@
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// runGit runs git in dir and returns its stdout. git is killed when ctx is done.
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "core.quotePath=false"}, args...)...)
+	cmd.WaitDelay = subprocessWaitDelay
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return nil, fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitChangeSet collects the lines changed in the working tree and the staged index relative
+// to base, plus untracked files. Only files under projectRoot are reported.
+func gitChangeSet(ctx context.Context, projectRoot, base string) (*changeSet, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git not found in PATH")
+	}
+
+	if _, err := runGit(ctx, projectRoot, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil, fmt.Errorf("%s is not inside a git repository", projectRoot)
+	}
+
+	changes := &changeSet{
+		Hunks:      make(map[string][]lineRange),
+		WholeFiles: make(map[string]bool),
+	}
+
+	if _, err := runGit(ctx, projectRoot, "rev-parse", "--verify", "--quiet", base+"^{commit}"); err != nil {
+		if base != "HEAD" {
+			return nil, fmt.Errorf("unknown git ref '%s'", base)
+		}
+		// A repository without commits: everything that is staged counts as new
+		staged, err := runGit(ctx, projectRoot, "ls-files", "--cached")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range splitLines(staged) {
+			changes.WholeFiles[file] = true
+		}
+	} else {
+		// Comparing the working tree against base covers both staged and unstaged edits. The
+		// prefixes are set explicitly, since diff.noprefix or diff.mnemonicPrefix change them.
+		diff, err := runGit(ctx, projectRoot, "diff", "--relative", "--unified=0", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "--diff-filter=d", base, "--")
+		if err != nil {
+			return nil, err
+		}
+		changes.Hunks = parseUnifiedDiff(diff)
+	}
+
+	untracked, err := runGit(ctx, projectRoot, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range splitLines(untracked) {
+		changes.WholeFiles[file] = true
+	}
+
+	return changes, nil
+}
+
+// splitLines splits command output into non-empty lines
+func splitLines(output []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, filepath.ToSlash(line))
+		}
+	}
+	return lines
+}
+
+// parseUnifiedDiff extracts the added or modified line ranges of each file from a
+// `git diff --unified=0` output. Pure deletions leave no lines behind and are ignored.
+func parseUnifiedDiff(diff []byte) map[string][]lineRange {
+	hunks := make(map[string][]lineRange)
+	var current string
+
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "+++ ") {
+			// git ends the line with a tab when the path holds a space
+			path := strings.TrimSuffix(strings.TrimPrefix(line, "+++ "), "\t")
+			if path == "/dev/null" {
+				current = ""
+				continue
+			}
+			current = strings.TrimPrefix(path, "b/")
+			continue
+		}
+
+		if current == "" {
+			continue
+		}
+
+		match := hunkHeaderPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		start, _ := strconv.Atoi(match[1])
+		count := 1
+		if match[2] != "" {
+			count, _ = strconv.Atoi(match[2])
+		}
+		if count == 0 {
+			continue
+		}
+		hunks[current] = append(hunks[current], lineRange{Start: start, End: start + count - 1})
+	}
+
+	return hunks
+}
+
+// Files returns every changed file, sorted
+func (c *changeSet) Files() []string {
+	var files []string
+	for file := range c.Hunks {
+		files = append(files, file)
+	}
+	for file := range c.WholeFiles {
+		if _, ok := c.Hunks[file]; !ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Contains reports whether a finding overlaps a changed line
+func (c *changeSet) Contains(finding Finding) bool {
+	if c.WholeFiles[finding.File] {
+		return true
+	}
+	for _, r := range c.Hunks[finding.File] {
+		if finding.StartLine <= r.End && finding.EndLine >= r.Start {
+			return true
+		}
+	}
+	return false
+}
+
+// filterToChanges keeps only the findings that overlap changed lines
+func filterToChanges(findings []Finding, changes *changeSet) []Finding {
+	kept := make([]Finding, 0, len(findings))
+	for _, finding := range findings {
+		if changes.Contains(finding) {
+			kept = append(kept, finding)
+		}
+	}
+	return kept
+}
+
+// scanChangesHandler handles the scan_changes tool
+func (s *Server) scanChangesHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	base := "HEAD"
+	sgconfigStr := "sgconfig.yml" // Default value
+	var languageFilter string
+	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
+		if b, ok := args["base"].(string); ok && b != "" {
+			base = b
+		}
+		if sgconfig, ok := args["sgconfig"].(string); ok && sgconfig != "" {
+			sgconfigStr = sgconfig
+		}
+		if lang, ok := args["language"].(string); ok && lang != "" {
+			languageFilter = strings.ToLower(lang)
+		}
+	}
+
+	s.logger.Debug("Scanning changes", "base", base)
+
+	setup, errResult := s.prepareScan(sgconfigStr)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	changes, err := gitChangeSet(ctx, setup.ProjectRoot, base)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error reading git changes: %v", err)), nil
+	}
+
+	// Run the changed files through discoverFiles so the usual filters apply
+	filter, err := newFileFilter(setup.ProjectRoot, setup.Languages, ScanPathOptions{LanguageFilter: languageFilter})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	var files []string
+	for _, file := range changes.Files() {
+		discovered, err := discoverFiles(resolvePathRelativeToProjectRoot(file, setup.ProjectRoot), languageFilter, setup.ProjectRoot, filter)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error discovering files: %v", err)), nil
+		}
+		files = append(files, discovered...)
+	}
+
+	s.logger.Debug("Changed files to scan", "files", len(files))
+
+	outcome, errResult := s.scanConfigGroups(ctx, setup, files, nil)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	outcome.Result.Findings = filterToChanges(outcome.Result.Findings, changes)
+
+	return scanResultToToolResult(outcome.Result), nil
+}
@@ -0,0 +1,184 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -3 +3 @@ func main() {
+-	old()
++	new()
+@@ -10,0 +11,3 @@ func other() {
++	a()
++	b()
++	c()
+@@ -20,2 +23,0 @@ func removed() {
+-	x()
+-	y()
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package main
++
+diff --git a/my file.go b/my file.go
+index 1111111..2222222 100644
+--- a/my file.go	
++++ b/my file.go	
+@@ -5 +5 @@ func f() {
+-	old()
++	new()
+`
+	hunks := parseUnifiedDiff([]byte(diff))
+
+	expected := map[string][]lineRange{
+		"main.go":    {{Start: 3, End: 3}, {Start: 11, End: 13}},
+		"new.go":     {{Start: 1, End: 2}},
+		"my file.go": {{Start: 5, End: 5}},
+	}
+	if !reflect.DeepEqual(hunks, expected) {
+		t.Errorf("parseUnifiedDiff() = %+v, expected %+v", hunks, expected)
+	}
+}
+
+func TestChangeSetContains(t *testing.T) {
+	changes := &changeSet{
+		Hunks:      map[string][]lineRange{"main.go": {{Start: 10, End: 12}}},
+		WholeFiles: map[string]bool{"untracked.go": true},
+	}
+
+	tests := []struct {
+		name     string
+		finding  Finding
+		expected bool
+	}{
+		{"Inside hunk", Finding{File: "main.go", StartLine: 11, EndLine: 11}, true},
+		{"Spanning hunk start", Finding{File: "main.go", StartLine: 8, EndLine: 10}, true},
+		{"Before hunk", Finding{File: "main.go", StartLine: 1, EndLine: 9}, false},
+		{"After hunk", Finding{File: "main.go", StartLine: 13, EndLine: 13}, false},
+		{"Untracked file", Finding{File: "untracked.go", StartLine: 100, EndLine: 100}, true},
+		{"Unchanged file", Finding{File: "other.go", StartLine: 11, EndLine: 11}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changes.Contains(tt.finding); got != tt.expected {
+				t.Errorf("Contains(%+v) = %v, expected %v", tt.finding, got, tt.expected)
+			}
+		})
+	}
+
+	if files := changes.Files(); !reflect.DeepEqual(files, []string{"main.go", "untracked.go"}) {
+		t.Errorf("Files() = %v", files)
+	}
+}
+
+// initGitRepo creates a local git repository without a remote
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+		{"config", "commit.gpgsign", "false"},
+		// Changes the prefixes of diff paths, which the parsing must not depend on
+		{"config", "diff.mnemonicPrefix", "true"},
+	} {
+		if _, err := runGit(context.Background(), dir, args...); err != nil {
+			t.Fatalf("Failed to set up git repository: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestGitChangeSet(t *testing.T) {
+	dir := initGitRepo(t)
+
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "staged.go"), []byte("package main\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "b"), 0755)
+	os.WriteFile(filepath.Join(dir, "b", "lib.go"), []byte("package b\n"), 0644)
+
+	t.Run("Repository without commits", func(t *testing.T) {
+		runGit(context.Background(), dir, "add", "main.go")
+		changes, err := gitChangeSet(context.Background(), dir, "HEAD")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !changes.WholeFiles["main.go"] || !changes.WholeFiles["staged.go"] {
+			t.Errorf("Expected staged and untracked files to count as new, got %+v", changes)
+		}
+	})
+
+	if _, err := runGit(context.Background(), dir, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(context.Background(), dir, "commit", "-q", "-m", "initial"); err != nil {
+		t.Fatal(err)
+	}
+
+	// One unstaged edit, one staged edit and one untracked file
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n\tdoThing()\n}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "staged.go"), []byte("package main\n\nvar x = 1\n"), 0644)
+	runGit(context.Background(), dir, "add", "staged.go")
+	os.WriteFile(filepath.Join(dir, "new.go"), []byte("package main\n"), 0644)
+
+	t.Run("Working tree and index", func(t *testing.T) {
+		changes, err := gitChangeSet(context.Background(), dir, "HEAD")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		if !reflect.DeepEqual(changes.Hunks["main.go"], []lineRange{{Start: 4, End: 4}}) {
+			t.Errorf("Unexpected hunks for main.go: %+v", changes.Hunks["main.go"])
+		}
+		if len(changes.Hunks["staged.go"]) != 1 {
+			t.Errorf("Expected staged changes to be included, got %+v", changes.Hunks)
+		}
+		if !changes.WholeFiles["new.go"] {
+			t.Error("Expected untracked file to be included")
+		}
+	})
+
+	t.Run("Diff without prefixes", func(t *testing.T) {
+		runGit(context.Background(), dir, "config", "diff.noprefix", "true")
+		defer runGit(context.Background(), dir, "config", "--unset", "diff.noprefix")
+		// A top-level b directory must keep its name
+		os.WriteFile(filepath.Join(dir, "b", "lib.go"), []byte("package b\n\nvar y = 2\n"), 0644)
+
+		changes, err := gitChangeSet(context.Background(), dir, "HEAD")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !reflect.DeepEqual(changes.Hunks["main.go"], []lineRange{{Start: 4, End: 4}}) || len(changes.Hunks["b/lib.go"]) != 1 {
+			t.Errorf("Unexpected hunks: %+v", changes.Hunks)
+		}
+	})
+
+	t.Run("Unknown ref", func(t *testing.T) {
+		if _, err := gitChangeSet(context.Background(), dir, "does-not-exist"); err == nil {
+			t.Error("Expected an error for an unknown ref")
+		}
+	})
+
+	t.Run("Not a repository", func(t *testing.T) {
+		if _, err := gitChangeSet(context.Background(), t.TempDir(), "HEAD"); err == nil {
+			t.Error("Expected an error outside a git repository")
+		}
+	})
+}
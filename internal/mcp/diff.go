@@ -0,0 +1,234 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change
+const diffContextLines = 3
+
+// diffOp is a single line of an edit script: ' ' (unchanged), '-' (removed) or '+' (added).
+// OldPos and NewPos count the old and new lines consumed before this line.
+type diffOp struct {
+	Kind   byte
+	Line   string
+	OldPos int
+	NewPos int
+}
+
+// unifiedDiff renders the difference between two texts as a unified diff.
+// It returns an empty string when the texts are identical.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	ops := diffLines(splitDiffLines(oldText), splitDiffLines(newText))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	i := 0
+	for i < len(ops) {
+		// Find the next change
+		for i < len(ops) && ops[i].Kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		end := i
+		for {
+			for end < len(ops) && ops[end].Kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].Kind == ' ' {
+				next++
+			}
+			if next < len(ops) && next-end <= 2*diffContextLines {
+				end = next
+				continue
+			}
+			end += diffContextLines
+			if end > len(ops) {
+				end = len(ops)
+			}
+			break
+		}
+
+		writeHunk(&sb, ops[start:end])
+		i = end
+	}
+
+	return sb.String()
+}
+
+// writeHunk writes a single hunk, header included
+func writeHunk(sb *strings.Builder, ops []diffOp) {
+	oldLen, newLen := 0, 0
+	for _, op := range ops {
+		if op.Kind != '+' {
+			oldLen++
+		}
+		if op.Kind != '-' {
+			newLen++
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(ops[0].OldPos, oldLen), hunkRange(ops[0].NewPos, newLen))
+	for _, op := range ops {
+		sb.WriteByte(op.Kind)
+		sb.WriteString(op.Line)
+		if !strings.HasSuffix(op.Line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats one side of a hunk header. Empty ranges point at the preceding line.
+func hunkRange(pos, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", pos)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", pos+1)
+	}
+	return fmt.Sprintf("%d,%d", pos+1, length)
+}
+
+// splitDiffLines splits text into lines, keeping the line terminators
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script between a and b using Myers' algorithm.
+// Common prefixes and suffixes are stripped first, since fixes usually touch few lines.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{Kind: ' ', Line: a[i], OldPos: i, NewPos: i})
+	}
+
+	for _, op := range myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		op.OldPos += prefix
+		op.NewPos += prefix
+		ops = append(ops, op)
+	}
+
+	for i := 0; i < suffix; i++ {
+		oldIdx, newIdx := len(a)-suffix+i, len(b)-suffix+i
+		ops = append(ops, diffOp{Kind: ' ', Line: a[oldIdx], OldPos: oldIdx, NewPos: newIdx})
+	}
+
+	return ops
+}
+
+// myersDiff is the core of Myers' O(ND) difference algorithm
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD == 0 {
+		return nil
+	}
+
+	offset := maxD
+	v := make([]int, 2*maxD+2)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // move down: insertion
+			} else {
+				x = v[offset+k-1] + 1 // move right: deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return myersBacktrack(trace, a, b, offset)
+			}
+		}
+	}
+
+	return nil
+}
+
+// myersBacktrack walks the recorded frontiers back from the end to build the edit script
+func myersBacktrack(trace [][]int, a, b []string, offset int) []diffOp {
+	var reversed []diffOp
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffOp{Kind: ' ', Line: a[x], OldPos: x, NewPos: y})
+		}
+
+		if prevK == k+1 {
+			y--
+			reversed = append(reversed, diffOp{Kind: '+', Line: b[y], OldPos: x, NewPos: y})
+		} else {
+			x--
+			reversed = append(reversed, diffOp{Kind: '-', Line: a[x], OldPos: x, NewPos: y})
+		}
+	}
+
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, diffOp{Kind: ' ', Line: a[x], OldPos: x, NewPos: y})
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
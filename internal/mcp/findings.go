@@ -0,0 +1,284 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// FindingsSchemaVersion is the version of the JSON document returned by every scan tool.
+// Bump it whenever a field is removed or its meaning changes.
+const FindingsSchemaVersion = 1
+
+// snippetFileName is reported as the file of findings produced by scan_code
+const snippetFileName = "<snippet>"
+
+// Diagnostic levels used in ScanResult.Diagnostics
+const (
+	DiagnosticError   = "error"
+	DiagnosticWarning = "warning"
+	DiagnosticInfo    = "info"
+)
+
+// Finding is a single rule violation reported by a scan.
+// Lines and columns are 1-based so they can be shown to users and fed into editors directly.
+type Finding struct {
+	RuleID      string `json:"rule_id"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message"`
+	Note        string `json:"note,omitempty"`
+	File        string `json:"file"`
+	StartLine   int    `json:"start_line"`
+	StartColumn int    `json:"start_column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+	Text        string `json:"text"`
+	Replacement string `json:"replacement,omitempty"`
+	// Analyzer is the analyzer that reported the finding
+	Analyzer string `json:"analyzer,omitempty"`
+
+	// fixStart and fixEnd are the byte offsets replaced by Replacement (used by apply_fixes)
+	fixStart int
+	fixEnd   int
+	// matchStart and matchEnd are the byte offsets of the match, and metaVariables those of the
+	// nodes captured by single metavariables (used by semantic constraints)
+	matchStart    int
+	matchEnd      int
+	metaVariables map[string]astGrepByteRange
+}
+
+// Diagnostic is a problem encountered while producing findings, such as ast-grep writing
+// to stderr or its output failing to parse. Diagnostics never describe rule violations.
+type Diagnostic struct {
+	Level   string `json:"level"`
+	Source  string `json:"source"`
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+}
+
+// ScanResult is the versioned JSON document returned by the scan tools.
+type ScanResult struct {
+	SchemaVersion int          `json:"schema_version"`
+	Findings      []Finding    `json:"findings"`
+	Diagnostics   []Diagnostic `json:"diagnostics"`
+	// Unscanned lists the files, relative to the project root, that were not scanned because
+	// the scan was cancelled or timed out. The findings only cover the other files.
+	Unscanned []string `json:"unscanned_files,omitempty"`
+}
+
+// astGrepPosition mirrors a position in ast-grep's --json output (0-based)
+type astGrepPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// astGrepByteRange mirrors a byte offset range in ast-grep's --json output
+type astGrepByteRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// astGrepMatch mirrors a single match in ast-grep's --json output
+type astGrepMatch struct {
+	Text  string `json:"text"`
+	File  string `json:"file"`
+	Range struct {
+		ByteOffset astGrepByteRange `json:"byteOffset"`
+		Start      astGrepPosition  `json:"start"`
+		End        astGrepPosition  `json:"end"`
+	} `json:"range"`
+	Replacement        *string           `json:"replacement"`
+	ReplacementOffsets *astGrepByteRange `json:"replacementOffsets"`
+	RuleID             string            `json:"ruleId"`
+	Severity           string            `json:"severity"`
+	Message            string            `json:"message"`
+	Note               *string           `json:"note"`
+	MetaVariables      struct {
+		Single map[string]struct {
+			Range struct {
+				ByteOffset astGrepByteRange `json:"byteOffset"`
+			} `json:"range"`
+		} `json:"single"`
+	} `json:"metaVariables"`
+}
+
+// newScanResult builds a ScanResult, making sure both slices serialize as arrays rather than null.
+func newScanResult(findings []Finding, diagnostics []Diagnostic) *ScanResult {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	return &ScanResult{
+		SchemaVersion: FindingsSchemaVersion,
+		Findings:      findings,
+		Diagnostics:   diagnostics,
+	}
+}
+
+// scanResultToToolResult serializes a ScanResult into a tool result. The result of a partial
+// scan is an error result that still holds the document, so the findings are not lost.
+func scanResultToToolResult(result *ScanResult) *mcp.CallToolResult {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error encoding scan result: %v", err))
+	}
+	toolResult := mcp.NewToolResultText(string(data))
+	toolResult.IsError = len(result.Unscanned) > 0
+	return toolResult
+}
+
+// parseAstGrepJSON converts the stdout of `ast-grep scan --json` into findings.
+// File paths are made relative to projectRoot (using forward slashes) when possible.
+func parseAstGrepJSON(output []byte, projectRoot string) ([]Finding, error) {
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) == 0 {
+		return []Finding{}, nil
+	}
+
+	var matches []astGrepMatch
+	if err := json.Unmarshal(trimmed, &matches); err != nil {
+		return nil, fmt.Errorf("could not parse ast-grep JSON output: %v", err)
+	}
+
+	findings := make([]Finding, 0, len(matches))
+	for _, m := range matches {
+		finding := Finding{
+			RuleID:      m.RuleID,
+			Severity:    strings.ToLower(m.Severity),
+			Message:     m.Message,
+			File:        relativeToProjectRoot(m.File, projectRoot),
+			StartLine:   m.Range.Start.Line + 1,
+			StartColumn: m.Range.Start.Column + 1,
+			EndLine:     m.Range.End.Line + 1,
+			EndColumn:   m.Range.End.Column + 1,
+			Text:        m.Text,
+			matchStart:  m.Range.ByteOffset.Start,
+			matchEnd:    m.Range.ByteOffset.End,
+		}
+		if len(m.MetaVariables.Single) > 0 {
+			finding.metaVariables = make(map[string]astGrepByteRange, len(m.MetaVariables.Single))
+			for name, variable := range m.MetaVariables.Single {
+				finding.metaVariables[name] = variable.Range.ByteOffset
+			}
+		}
+		if m.Note != nil {
+			finding.Note = *m.Note
+		}
+		if m.Replacement != nil {
+			finding.Replacement = *m.Replacement
+			// The replaced range can be wider than the match when the fix expands it
+			finding.fixStart, finding.fixEnd = m.Range.ByteOffset.Start, m.Range.ByteOffset.End
+			if m.ReplacementOffsets != nil {
+				finding.fixStart, finding.fixEnd = m.ReplacementOffsets.Start, m.ReplacementOffsets.End
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+// relativeToProjectRoot returns path relative to projectRoot with forward slashes.
+// Paths outside the project root (or when no root is known) are returned unchanged.
+func relativeToProjectRoot(path, projectRoot string) string {
+	if projectRoot == "" || !filepath.IsAbs(path) {
+		return filepath.ToSlash(path)
+	}
+	rel, err := filepath.Rel(projectRoot, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// runAstGrepScan executes ast-grep with the given arguments and returns the parsed findings.
+// stdout and stderr are captured separately so that warnings printed by ast-grep never corrupt
+// the JSON; anything on stderr and any parse failure is reported as a diagnostic instead.
+func (s *Server) runAstGrepScan(ctx context.Context, sgPath, projectRoot string, args []string) ([]Finding, []Diagnostic) {
+	output, diagnostics := s.runAstGrep(ctx, sgPath, projectRoot, args)
+	if output == nil {
+		return nil, diagnostics
+	}
+
+	findings, err := parseAstGrepJSON(output, projectRoot)
+	if err != nil {
+		diagnostics = append(diagnostics, Diagnostic{
+			Level:   DiagnosticError,
+			Source:  "context-sherpa",
+			Message: err.Error(),
+		})
+		return nil, diagnostics
+	}
+
+	return findings, diagnostics
+}
+
+// runAstGrep executes ast-grep with the given arguments and returns its stdout, which is nil
+// when ast-grep could not run. Anything printed on stderr is reported as a diagnostic.
+func (s *Server) runAstGrep(ctx context.Context, sgPath, projectRoot string, args []string) ([]byte, []Diagnostic) {
+	var stdout, stderr bytes.Buffer
+	var diagnostics []Diagnostic
+
+	cmd := exec.CommandContext(ctx, sgPath, args...)
+	cmd.WaitDelay = subprocessWaitDelay
+	cmd.Dir = projectRoot
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// ast-grep exits with non-zero status code if issues are found.
+		// We still want to parse the output.
+		s.logger.Debug("ast-grep scan exited with error", "error", err)
+		if ctx.Err() != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Level:   DiagnosticError,
+				Source:  "ast-grep",
+				Message: fmt.Sprintf("ast-grep was stopped: %v", ctx.Err()),
+			})
+			return nil, diagnostics
+		}
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			diagnostics = append(diagnostics, Diagnostic{
+				Level:   DiagnosticError,
+				Source:  "ast-grep",
+				Message: fmt.Sprintf("failed to run ast-grep: %v", err),
+			})
+			return nil, diagnostics
+		}
+		// Any other status, or a signal, means ast-grep crashed and its output is incomplete
+		if code := exitErr.ExitCode(); code < 0 || code > 1 {
+			message := fmt.Sprintf("ast-grep crashed: %v", err)
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				message += ": " + msg
+			}
+			diagnostics = append(diagnostics, Diagnostic{
+				Level:   DiagnosticError,
+				Source:  "ast-grep",
+				Message: message,
+			})
+			return nil, diagnostics
+		}
+	}
+
+	// Log the actual ast-grep command output when verbose logging is enabled
+	s.logger.Debug("ast-grep scan output", "stdout", stdout.String())
+
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		s.logger.Debug("ast-grep scan output", "stderr", msg)
+		diagnostics = append(diagnostics, Diagnostic{
+			Level:   DiagnosticWarning,
+			Source:  "ast-grep",
+			Message: msg,
+		})
+	}
+
+	return stdout.Bytes(), diagnostics
+}
@@ -0,0 +1,298 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const sampleAstGrepOutput = `[
+{
+  "text": "fmt.Println(\"hello\")",
+  "range": {
+    "byteOffset": {"start": 30, "end": 50},
+    "start": {"line": 3, "column": 1},
+    "end": {"line": 3, "column": 21}
+  },
+  "file": "%s",
+  "lines": "\tfmt.Println(\"hello\")",
+  "replacement": "log.Println(\"hello\")",
+  "language": "Go",
+  "ruleId": "no-fmt-println",
+  "severity": "warning",
+  "note": "Use the structured logger instead.",
+  "message": "Avoid fmt.Println"
+},
+{
+  "text": "doThing()",
+  "range": {
+    "byteOffset": {"start": 60, "end": 69},
+    "start": {"line": 5, "column": 1},
+    "end": {"line": 5, "column": 10}
+  },
+  "file": "pkg/other.go",
+  "lines": "\tdoThing()",
+  "language": "Go",
+  "ruleId": "unchecked-error",
+  "severity": "Error",
+  "note": null,
+  "message": "The error returned by this function call is not checked."
+}
+]`
+
+func TestParseAstGrepJSON(t *testing.T) {
+	projectRoot := t.TempDir()
+	absFile := filepath.Join(projectRoot, "cmd", "main.go")
+	output, _ := json.Marshal(absFile)
+	fixture := []byte(fmtSample(string(output[1 : len(output)-1])))
+
+	findings, err := parseAstGrepJSON(fixture, projectRoot)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d", len(findings))
+	}
+
+	first := findings[0]
+	if first.RuleID != "no-fmt-println" {
+		t.Errorf("Expected rule id 'no-fmt-println', got '%s'", first.RuleID)
+	}
+	if first.File != "cmd/main.go" {
+		t.Errorf("Expected file relative to project root, got '%s'", first.File)
+	}
+	if first.StartLine != 4 || first.StartColumn != 2 || first.EndLine != 4 || first.EndColumn != 22 {
+		t.Errorf("Expected 1-based range 4:2-4:22, got %d:%d-%d:%d", first.StartLine, first.StartColumn, first.EndLine, first.EndColumn)
+	}
+	if first.Replacement != "log.Println(\"hello\")" {
+		t.Errorf("Expected replacement to be set, got '%s'", first.Replacement)
+	}
+	if first.Note != "Use the structured logger instead." {
+		t.Errorf("Expected note to be set, got '%s'", first.Note)
+	}
+
+	second := findings[1]
+	if second.Severity != "error" {
+		t.Errorf("Expected severity to be normalized to 'error', got '%s'", second.Severity)
+	}
+	if second.Note != "" || second.Replacement != "" {
+		t.Error("Expected empty note and replacement for null values")
+	}
+	if second.File != "pkg/other.go" {
+		t.Errorf("Expected relative file to be kept, got '%s'", second.File)
+	}
+}
+
+func TestParseAstGrepJSONErrors(t *testing.T) {
+	t.Run("Empty output", func(t *testing.T) {
+		findings, err := parseAstGrepJSON([]byte("  \n"), "")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(findings) != 0 {
+			t.Errorf("Expected 0 findings, got %d", len(findings))
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		if _, err := parseAstGrepJSON([]byte("Error: rule parse failed"), ""); err == nil {
+			t.Error("Expected an error for non-JSON output")
+		}
+	})
+}
+
+func TestScanResultToToolResult(t *testing.T) {
+	result := scanResultToToolResult(newScanResult(nil, nil))
+	if result.IsError {
+		t.Fatal("Expected a successful tool result")
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(toolResultText(t, result)), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v", err)
+	}
+
+	if decoded["schema_version"] != float64(FindingsSchemaVersion) {
+		t.Errorf("Expected schema_version %d, got %v", FindingsSchemaVersion, decoded["schema_version"])
+	}
+	if _, ok := decoded["findings"].([]interface{}); !ok {
+		t.Error("Expected findings to be an empty array, not null")
+	}
+	if _, ok := decoded["diagnostics"].([]interface{}); !ok {
+		t.Error("Expected diagnostics to be an empty array, not null")
+	}
+}
+
+func TestRunAstGrepScanSeparatesStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep script requires a POSIX shell")
+	}
+
+	tempDir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"echo 'warning: something noisy' >&2\n" +
+		"echo '[{\"text\":\"x\",\"file\":\"a.go\",\"range\":{\"start\":{\"line\":0,\"column\":0},\"end\":{\"line\":0,\"column\":1}},\"ruleId\":\"r\",\"severity\":\"error\",\"message\":\"m\"}]'\n" +
+		"exit 1\n"
+	fakeAstGrep := writeFakeAstGrep(t, tempDir, script)
+
+	findings, diagnostics := NewServer(Options{}).runAstGrepScan(context.Background(), fakeAstGrep, tempDir, []string{"scan", "--json"})
+
+	if len(findings) != 1 {
+		t.Fatalf("Expected 1 finding, got %d", len(findings))
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Message != "warning: something noisy" {
+		t.Errorf("Expected stderr to be reported as a diagnostic, got %+v", diagnostics)
+	}
+}
+
+func TestRunAstGrepScanInvalidOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep script requires a POSIX shell")
+	}
+
+	tempDir := t.TempDir()
+	fakeAstGrep := writeFakeAstGrep(t, tempDir, "#!/bin/sh\necho 'not json'\n")
+
+	findings, diagnostics := NewServer(Options{}).runAstGrepScan(context.Background(), fakeAstGrep, tempDir, []string{"scan", "--json"})
+
+	if len(findings) != 0 {
+		t.Errorf("Expected no findings, got %d", len(findings))
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Level != DiagnosticError {
+		t.Errorf("Expected a single error diagnostic, got %+v", diagnostics)
+	}
+}
+
+// fmtSample substitutes the file path of the first match in sampleAstGrepOutput
+func fmtSample(file string) string {
+	return strings.Replace(sampleAstGrepOutput, "%s", file, 1)
+}
+
+// toolResultText returns the text of the first content item of a tool result
+func toolResultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	if result == nil || len(result.Content) == 0 {
+		t.Fatal("Expected result content, got nil or empty")
+	}
+	text, ok := mcp.AsTextContent(result.Content[0])
+	if !ok {
+		t.Fatalf("Expected text content, got %T", result.Content[0])
+	}
+	return text.Text
+}
+
+// writeFakeAstGrep writes an executable shell script standing in for the ast-grep binary
+func writeFakeAstGrep(t *testing.T, dir, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, "fake-ast-grep")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake ast-grep: %v", err)
+	}
+	return path
+}
+
+// fakeAstGrepOptions tune the fake ast-grep written by writeScanningFakeAstGrep
+type fakeAstGrepOptions struct {
+	// WarnOn makes the scan warn on stderr about each file containing this text
+	WarnOn string
+	// CrashOn makes the scan crash, like an ast-grep panic, on a file containing this text
+	CrashOn string
+	// DelayOn makes the scan hang for 30 seconds on a file containing this text
+	DelayOn string
+	// LogScans appends the files of each scan to scans.log next to the script; see scanLog
+	LogScans bool
+	// EchoConfig reports a match in every file, whose rule id is the name of the directory
+	// holding the sgconfig.yml passed with --config
+	EchoConfig bool
+}
+
+// writeScanningFakeAstGrep writes a fake ast-grep reporting a no-panic match in every scanned
+// Go file containing panic, behaving as opts asks
+func writeScanningFakeAstGrep(t *testing.T, dir string, opts fakeAstGrepOptions) string {
+	t.Helper()
+	var script strings.Builder
+	script.WriteString(`#!/bin/sh
+if [ "$1" = "--version" ]; then
+	echo "ast-grep 0.39.0"
+	exit 0
+fi
+rule='no-panic'
+match='grep -q panic'
+`)
+	if opts.EchoConfig {
+		script.WriteString(`prev=''
+for arg in "$@"; do
+	if [ "$prev" = "--config" ]; then
+		rule="$(basename "$(dirname "$arg")")"
+	fi
+	prev="$arg"
+done
+match='test -f'
+`)
+	}
+	script.WriteString(`files=''
+sep=''
+printf '['
+for arg in "$@"; do
+	case "$arg" in
+	*.go)
+		files="$files $(basename "$arg")"
+`)
+	if opts.WarnOn != "" {
+		fmt.Fprintf(&script, `		if grep -q '%s' "$arg"; then
+			echo "warning: $arg" >&2
+		fi
+`, opts.WarnOn)
+	}
+	if opts.CrashOn != "" {
+		fmt.Fprintf(&script, `		if grep -q '%s' "$arg"; then
+			echo "thread 'main' panicked" >&2
+			exit 101
+		fi
+`, opts.CrashOn)
+	}
+	if opts.DelayOn != "" {
+		fmt.Fprintf(&script, `		if grep -q '%s' "$arg"; then
+			sleep 30
+		fi
+`, opts.DelayOn)
+	}
+	script.WriteString(`		if $match "$arg"; then
+			printf '%s{"text": "panic()", "range": {"byteOffset": {"start": 0, "end": 7}, "start": {"line": 0, "column": 0}, "end": {"line": 0, "column": 7}}, "file": "%s", "ruleId": "%s", "severity": "error", "message": "Do not panic"}' "$sep" "$arg" "$rule"
+			sep=','
+		fi
+		;;
+	esac
+done
+echo ']'
+`)
+	if opts.LogScans {
+		script.WriteString(`echo "$files" >> "$(dirname "$0")/scans.log"
+`)
+	}
+	return writeFakeAstGrep(t, dir, script.String())
+}
+
+// scanLog returns the files passed to each scan run by the fake ast-grep, one line per run
+func scanLog(t *testing.T, sgPath string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(sgPath), "scans.log"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read scan log: %v", err)
+	}
+	var runs []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line != "" {
+			runs = append(runs, strings.TrimSpace(line))
+		}
+	}
+	return runs
+}
@@ -0,0 +1,188 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fileFix is the rewrite of a single file computed from the fixable findings in it
+type fileFix struct {
+	File     string // relative to the project root
+	Path     string // absolute path on disk
+	Original string
+	Fixed    string
+	Applied  int
+	Skipped  int
+}
+
+// ensureWithinProjectRoot returns an error unless path resolves to a location inside projectRoot.
+// Symlinks are resolved so that a link inside the project cannot point a write elsewhere.
+func ensureWithinProjectRoot(path, projectRoot string) error {
+	root, err := filepath.EvalSymlinks(projectRoot)
+	if err != nil {
+		return fmt.Errorf("could not resolve project root: %v", err)
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s: %v", path, err)
+	}
+	root, _ = filepath.Abs(root)
+	target, _ = filepath.Abs(target)
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("%s is outside the project root %s", path, projectRoot)
+	}
+	return nil
+}
+
+// computeFixes applies the replacements of the fixable findings to the files' current contents.
+// Only findings of the given rules are used when ruleIDs is not empty. When two fixes overlap
+// only the first is applied; the rest can be picked up by running the tool again.
+func computeFixes(findings []Finding, ruleIDs []string, projectRoot string) ([]fileFix, error) {
+	wanted := make(map[string]bool, len(ruleIDs))
+	for _, id := range ruleIDs {
+		wanted[id] = true
+	}
+
+	byFile := make(map[string][]Finding)
+	for _, finding := range findings {
+		if finding.Replacement == "" && finding.fixStart == finding.fixEnd {
+			continue // Rule has no fix
+		}
+		if len(wanted) > 0 && !wanted[finding.RuleID] {
+			continue
+		}
+		byFile[finding.File] = append(byFile[finding.File], finding)
+	}
+
+	files := make([]string, 0, len(byFile))
+	for file := range byFile {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var fixes []fileFix
+	for _, file := range files {
+		path := resolvePathRelativeToProjectRoot(filepath.FromSlash(file), projectRoot)
+		if err := ensureWithinProjectRoot(path, projectRoot); err != nil {
+			return nil, err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", file, err)
+		}
+
+		fix := fileFix{File: file, Path: path, Original: string(content)}
+		fileFindings := byFile[file]
+		sort.SliceStable(fileFindings, func(i, j int) bool {
+			return fileFindings[i].fixStart < fileFindings[j].fixStart
+		})
+
+		var sb strings.Builder
+		last := 0
+		for _, finding := range fileFindings {
+			if finding.fixStart < last || finding.fixEnd > len(content) || finding.fixStart > finding.fixEnd {
+				fix.Skipped++
+				continue
+			}
+			sb.Write(content[last:finding.fixStart])
+			sb.WriteString(finding.Replacement)
+			last = finding.fixEnd
+			fix.Applied++
+		}
+		sb.Write(content[last:])
+		fix.Fixed = sb.String()
+
+		if fix.Fixed != fix.Original {
+			fixes = append(fixes, fix)
+		}
+	}
+
+	return fixes, nil
+}
+
+// applyFixesHandler handles the apply_fixes tool
+func (s *Server) applyFixesHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts, err := scanPathOptionsFromRequest(req, "")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var ruleIDs []string
+	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
+		if ids, ok := args["rule_ids"].(string); ok {
+			ruleIDs = splitCommaList(ids)
+		}
+	}
+	confirm := req.GetBool("confirm", false)
+
+	projectRoot, err := s.findProjectRoot()
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Refuse paths outside the project before scanning anything
+	if _, err := os.Stat(resolvePathRelativeToProjectRoot(opts.Path, projectRoot)); err == nil {
+		if err := ensureWithinProjectRoot(resolvePathRelativeToProjectRoot(opts.Path, projectRoot), projectRoot); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Refusing to apply fixes: %v", err)), nil
+		}
+	}
+
+	outcome, errResult := s.runScanPath(ctx, opts)
+	if errResult != nil {
+		return errResult, nil
+	}
+	if errResult := incompleteScanError(ctx, outcome.Result); errResult != nil {
+		return errResult, nil
+	}
+
+	fixes, err := computeFixes(outcome.Result.Findings, ruleIDs, outcome.ProjectRoot)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Refusing to apply fixes: %v", err)), nil
+	}
+
+	if len(fixes) == 0 {
+		return mcp.NewToolResultText("No fixable findings found."), nil
+	}
+
+	var sb strings.Builder
+	applied, skipped := 0, 0
+	for _, fix := range fixes {
+		applied += fix.Applied
+		skipped += fix.Skipped
+		sb.WriteString(unifiedDiff("a/"+fix.File, "b/"+fix.File, fix.Original, fix.Fixed))
+	}
+	diff := sb.String()
+
+	if !confirm {
+		summary := fmt.Sprintf("Preview of %d fix(es) in %d file(s). No files were changed; call apply_fixes again with confirm=true to write them.", applied, len(fixes))
+		if skipped > 0 {
+			summary += fmt.Sprintf(" %d overlapping fix(es) will be skipped; run the tool again afterwards to apply them.", skipped)
+		}
+		return mcp.NewToolResultText(summary + "\n\n" + diff), nil
+	}
+
+	for _, fix := range fixes {
+		info, err := os.Stat(fix.Path)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading %s: %v", fix.File, err)), nil
+		}
+		if err := os.WriteFile(fix.Path, []byte(fix.Fixed), info.Mode().Perm()); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error writing %s: %v", fix.File, err)), nil
+		}
+	}
+
+	summary := fmt.Sprintf("Applied %d fix(es) to %d file(s).", applied, len(fixes))
+	if skipped > 0 {
+		summary += fmt.Sprintf(" %d overlapping fix(es) were skipped; run the tool again to apply them.", skipped)
+	}
+	return mcp.NewToolResultText(summary + "\n\n" + diff), nil
+}
@@ -0,0 +1,130 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestComputeFixes(t *testing.T) {
+	projectRoot := t.TempDir()
+	content := "package main\n\nfunc main() {\n\tfmt.Println(\"a\")\n\tfmt.Println(\"b\")\n}\n"
+	os.WriteFile(filepath.Join(projectRoot, "main.go"), []byte(content), 0644)
+
+	first := strings.Index(content, `fmt.Println("a")`)
+	second := strings.Index(content, `fmt.Println("b")`)
+	findings := []Finding{
+		{RuleID: "no-fmt-println", File: "main.go", Replacement: `log.Println("b")`, fixStart: second, fixEnd: second + len(`fmt.Println("b")`)},
+		{RuleID: "no-fmt-println", File: "main.go", Replacement: `log.Println("a")`, fixStart: first, fixEnd: first + len(`fmt.Println("a")`)},
+		// Overlaps the first fix and must be skipped
+		{RuleID: "other-rule", File: "main.go", Replacement: "x", fixStart: first + 2, fixEnd: first + 5},
+		// No fix template
+		{RuleID: "unchecked-error", File: "main.go"},
+	}
+
+	t.Run("All rules", func(t *testing.T) {
+		fixes, err := computeFixes(findings, nil, projectRoot)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(fixes) != 1 {
+			t.Fatalf("Expected fixes for 1 file, got %d", len(fixes))
+		}
+
+		fix := fixes[0]
+		expected := "package main\n\nfunc main() {\n\tlog.Println(\"a\")\n\tlog.Println(\"b\")\n}\n"
+		if fix.Fixed != expected {
+			t.Errorf("Unexpected fixed content:\n%s", fix.Fixed)
+		}
+		if fix.Applied != 2 || fix.Skipped != 1 {
+			t.Errorf("Expected 2 applied and 1 skipped fix, got %d and %d", fix.Applied, fix.Skipped)
+		}
+	})
+
+	t.Run("Filtered by rule id", func(t *testing.T) {
+		fixes, err := computeFixes(findings, []string{"other-rule"}, projectRoot)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(fixes) != 1 || fixes[0].Applied != 1 || !strings.Contains(fixes[0].Fixed, "fmxrintln(\"a\")") {
+			t.Errorf("Expected only the other-rule fix to be applied, got %+v", fixes)
+		}
+	})
+}
+
+func TestComputeFixesOutsideProjectRoot(t *testing.T) {
+	projectRoot := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "outside.go")
+	os.WriteFile(outside, []byte("package x\n"), 0644)
+
+	findings := []Finding{{RuleID: "r", File: outside, Replacement: "y", fixStart: 0, fixEnd: 1}}
+	if _, err := computeFixes(findings, nil, projectRoot); err == nil {
+		t.Error("Expected fixes outside the project root to be refused")
+	}
+}
+
+func TestEnsureWithinProjectRoot(t *testing.T) {
+	projectRoot := t.TempDir()
+	inside := filepath.Join(projectRoot, "inside.go")
+	os.WriteFile(inside, []byte("package x\n"), 0644)
+
+	if err := ensureWithinProjectRoot(inside, projectRoot); err != nil {
+		t.Errorf("Expected file inside the project root to be accepted, got: %v", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		outside := filepath.Join(t.TempDir(), "outside.go")
+		os.WriteFile(outside, []byte("package x\n"), 0644)
+		link := filepath.Join(projectRoot, "link.go")
+		if err := os.Symlink(outside, link); err == nil {
+			if err := ensureWithinProjectRoot(link, projectRoot); err == nil {
+				t.Error("Expected a symlink pointing outside the project root to be refused")
+			}
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Run("Identical", func(t *testing.T) {
+		if diff := unifiedDiff("a", "b", "x\n", "x\n"); diff != "" {
+			t.Errorf("Expected empty diff, got %q", diff)
+		}
+	})
+
+	t.Run("Single change with context", func(t *testing.T) {
+		oldText := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+		newText := "1\n2\n3\n4\nFIVE\n6\n7\n8\n9\n"
+		expected := "--- a/f\n+++ b/f\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+FIVE\n 6\n 7\n 8\n"
+		if diff := unifiedDiff("a/f", "b/f", oldText, newText); diff != expected {
+			t.Errorf("Unexpected diff:\n%s\nexpected:\n%s", diff, expected)
+		}
+	})
+
+	t.Run("Separate hunks", func(t *testing.T) {
+		var oldLines, newLines []string
+		for i := 1; i <= 20; i++ {
+			line := string(rune('a'+i-1)) + "\n"
+			oldLines = append(oldLines, line)
+			if i == 2 || i == 18 {
+				line = "changed\n"
+			}
+			newLines = append(newLines, line)
+		}
+		diff := unifiedDiff("a/f", "b/f", strings.Join(oldLines, ""), strings.Join(newLines, ""))
+		if strings.Count(diff, "@@ -") != 2 {
+			t.Errorf("Expected 2 hunks, got:\n%s", diff)
+		}
+		if !strings.Contains(diff, "@@ -1,5 +1,5 @@") || !strings.Contains(diff, "@@ -15,6 +15,6 @@") {
+			t.Errorf("Unexpected hunk headers:\n%s", diff)
+		}
+	})
+
+	t.Run("Insertion and missing newline", func(t *testing.T) {
+		diff := unifiedDiff("a/f", "b/f", "a\nb", "a\nnew\nb")
+		if !strings.Contains(diff, "+new\n") || !strings.Contains(diff, "\\ No newline at end of file") {
+			t.Errorf("Unexpected diff:\n%s", diff)
+		}
+	})
+}
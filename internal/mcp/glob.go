@@ -0,0 +1,310 @@
+package mcp
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pathPattern is one entry of a scan path written as a list of globs, matched against paths
+// relative to the project root. "**" matches any number of directories, braces list
+// alternatives ("*.{ts,tsx}") and a leading "!" excludes the files the pattern matches.
+type pathPattern struct {
+	// raw is the pattern as written, for messages
+	raw string
+	// alternatives holds the segments of each brace expansion of the pattern
+	alternatives [][]string
+	negate       bool
+}
+
+// isGlobPath reports whether a scan path is a list of globs rather than a single file or
+// directory
+func isGlobPath(scanPath string) bool {
+	return strings.ContainsAny(scanPath, "*?[{,") || strings.HasPrefix(strings.TrimSpace(scanPath), "!")
+}
+
+// splitPatternList splits a comma-separated list of globs, leaving commas inside braces alone
+func splitPatternList(list string) []string {
+	var patterns []string
+	depth, start := 0, 0
+	for i := 0; i <= len(list); i++ {
+		if i < len(list) {
+			switch list[i] {
+			case '\\':
+				i++
+				continue
+			case '{':
+				depth++
+				continue
+			case '}':
+				if depth > 0 {
+					depth--
+				}
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if pattern := strings.TrimSpace(list[start:i]); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+		start = i + 1
+	}
+	return patterns
+}
+
+// expandBraces returns every alternative of a pattern holding brace lists, so "*.{ts,tsx}"
+// becomes "*.ts" and "*.tsx". Unbalanced braces are left as they are.
+func expandBraces(pattern string) []string {
+	open := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			prefix, body, suffix := pattern[:open], pattern[open+1:i], pattern[i+1:]
+			var expanded []string
+			for _, choice := range splitPatternList(body) {
+				expanded = append(expanded, expandBraces(prefix+choice+suffix)...)
+			}
+			if strings.TrimSpace(body) == "" {
+				expanded = expandBraces(prefix + suffix)
+			}
+			return expanded
+		}
+	}
+	return []string{pattern}
+}
+
+// parsePathPatterns parses a scan path written as a comma-separated list of globs. Absolute
+// patterns must lie under projectRoot.
+func parsePathPatterns(list, projectRoot string) ([]pathPattern, error) {
+	var patterns []pathPattern
+	for _, raw := range splitPatternList(list) {
+		p := pathPattern{raw: raw}
+		pattern := raw
+		if strings.HasPrefix(pattern, "!") {
+			p.negate = true
+			pattern = strings.TrimSpace(pattern[1:])
+		}
+		if filepath.IsAbs(pattern) && projectRoot != "" {
+			rel, err := filepath.Rel(projectRoot, pattern)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return nil, fmt.Errorf("glob pattern '%s' is outside the project root", raw)
+			}
+			pattern = rel
+		}
+		pattern = path.Clean(filepath.ToSlash(pattern))
+		if pattern == "." || pattern == "/" {
+			pattern = "**"
+		}
+		pattern = strings.TrimPrefix(pattern, "/")
+
+		for _, alternative := range expandBraces(pattern) {
+			segments := strings.Split(alternative, "/")
+			for _, segment := range segments {
+				if _, err := path.Match(segment, ""); err != nil {
+					return nil, fmt.Errorf("invalid glob pattern '%s': %v", raw, err)
+				}
+			}
+			p.alternatives = append(p.alternatives, segments)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// matches reports whether the pattern matches the path made of segments, or one of its parent
+// directories, so that a pattern naming a directory takes in everything below it
+func (p pathPattern) matches(segments []string) bool {
+	for _, alternative := range p.alternatives {
+		for i := 1; i <= len(segments); i++ {
+			if matchSegments(alternative, segments[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// walkBase returns the directory, relative to the project root, that holds every path the
+// alternative can match: its leading segments without glob characters
+func walkBase(alternative []string) string {
+	var base []string
+	for _, segment := range alternative[:len(alternative)-1] {
+		if strings.ContainsAny(segment, `*?[\`) {
+			break
+		}
+		base = append(base, segment)
+	}
+	return strings.Join(base, "/")
+}
+
+// selectsPath reports whether a list of patterns selects the path made of segments: a positive
+// pattern must match it, unless the list only holds negative ones, and no negative one may
+func selectsPath(patterns []pathPattern, segments []string) bool {
+	selected, positive := false, false
+	for _, p := range patterns {
+		if p.negate {
+			if p.matches(segments) {
+				return false
+			}
+			continue
+		}
+		positive = true
+		if !selected && p.matches(segments) {
+			selected = true
+		}
+	}
+	return selected || !positive
+}
+
+// discoverGlobFiles walks the project root, only descending into the directories the positive
+// patterns can match in, and returns the files the patterns select
+func discoverGlobFiles(patterns []pathPattern, languageFilter, projectRoot string, filter *fileFilter) ([]string, error) {
+	searchRoot := projectRoot
+	if searchRoot == "" {
+		searchRoot = "."
+	}
+
+	var bases []string
+	positive := false
+	for _, p := range patterns {
+		if p.negate {
+			continue
+		}
+		positive = true
+		for _, alternative := range p.alternatives {
+			bases = append(bases, walkBase(alternative))
+		}
+	}
+	if !positive {
+		bases = []string{""}
+	}
+	// Walk each base once, leaving out those inside another base
+	sort.Strings(bases)
+	var roots []string
+	for _, base := range bases {
+		if len(roots) > 0 {
+			last := roots[len(roots)-1]
+			if last == "" || base == last || strings.HasPrefix(base, last+"/") {
+				continue
+			}
+		}
+		roots = append(roots, base)
+	}
+
+	var files []string
+	for _, root := range roots {
+		walkRoot := filepath.Join(searchRoot, filepath.FromSlash(root))
+		err := filepath.Walk(walkRoot, func(currentPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(searchRoot, currentPath)
+			if err != nil {
+				return err
+			}
+			segments := strings.Split(filepath.ToSlash(rel), "/")
+
+			// Skip directories, and prune those the filter or a negative pattern leaves out
+			if info.IsDir() {
+				if currentPath == searchRoot {
+					return nil
+				}
+				if filter.skipDir(currentPath) {
+					return filepath.SkipDir
+				}
+				for _, p := range patterns {
+					if p.negate && p.matches(segments) {
+						return filepath.SkipDir
+					}
+				}
+				return nil
+			}
+
+			if !selectsPath(patterns, segments) {
+				return nil
+			}
+			if languageFilter != "" && !filter.inLanguage(currentPath, languageFilter) {
+				return nil
+			}
+			if filter.skipFile(currentPath) {
+				return nil
+			}
+			files = append(files, currentPath)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// unmatchedPathDiagnostics reports the patterns of a scan path that selected none of the
+// discovered files, so an empty scan says why it is empty
+func unmatchedPathDiagnostics(scanPath, projectRoot string, files []string) []Diagnostic {
+	if !isGlobPath(scanPath) {
+		if len(files) > 0 {
+			return nil
+		}
+		return []Diagnostic{{
+			Level:   DiagnosticWarning,
+			Source:  "context-sherpa",
+			Message: fmt.Sprintf("path '%s' matched no files to scan", scanPath),
+		}}
+	}
+
+	patterns, err := parsePathPatterns(scanPath, projectRoot)
+	if err != nil {
+		return nil
+	}
+	var relFiles [][]string
+	for _, file := range files {
+		relFiles = append(relFiles, strings.Split(relativeToProjectRoot(file, projectRoot), "/"))
+	}
+
+	var diagnostics []Diagnostic
+	for _, p := range patterns {
+		if p.negate {
+			continue
+		}
+		matched := false
+		for _, segments := range relFiles {
+			if p.matches(segments) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			diagnostics = append(diagnostics, Diagnostic{
+				Level:   DiagnosticWarning,
+				Source:  "context-sherpa",
+				Message: fmt.Sprintf("glob pattern '%s' matched no files to scan", p.raw),
+			})
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSplitPatternList(t *testing.T) {
+	got := splitPatternList(" **/*.go, web/*.{ts,tsx} ,,!**/*_test.go")
+	want := []string{"**/*.go", "web/*.{ts,tsx}", "!**/*_test.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.go", []string{"*.go"}},
+		{"*.{ts,tsx}", []string{"*.ts", "*.tsx"}},
+		{"{cmd,internal}/**/*.{go,s}", []string{"cmd/**/*.go", "cmd/**/*.s", "internal/**/*.go", "internal/**/*.s"}},
+		{"a{b,{c,d}}", []string{"ab", "ac", "ad"}},
+		{"a{b", []string{"a{b"}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.pattern, tt.want, got)
+		}
+	}
+}
+
+func TestDiscoverGlobFiles(t *testing.T) {
+	projectRoot := t.TempDir()
+	writeTree(t, projectRoot, map[string]string{
+		"main.go":                 "package main\n",
+		"main_test.go":            "package main\n",
+		"internal/a/a.go":         "package a\n",
+		"internal/a/a_test.go":    "package a\n",
+		"internal/b/b.js":         "",
+		"web/app.ts":              "",
+		"web/components/view.tsx": "",
+		"web/components/view.css": "",
+	})
+
+	discover := func(t *testing.T, path string) string {
+		t.Helper()
+		files, err := discoverFiles(path, "", projectRoot, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var rels []string
+		for _, file := range files {
+			rels = append(rels, relativeToProjectRoot(file, projectRoot))
+		}
+		sort.Strings(rels)
+		return strings.Join(rels, " ")
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"**/*.go", "internal/a/a.go internal/a/a_test.go main.go main_test.go"},
+		{"*.go", "main.go main_test.go"},
+		{"internal/**/*.js", "internal/b/b.js"},
+		{"web/**/*.{ts,tsx}", "web/app.ts web/components/view.tsx"},
+		{"**/*.go,!**/*_test.go", "internal/a/a.go main.go"},
+		{"!**/*_test.go,!web", "internal/a/a.go internal/b/b.js main.go"},
+		{"internal/a,web/components/*.css", "internal/a/a.go internal/a/a_test.go web/components/view.css"},
+		{filepath.Join(projectRoot, "internal") + "/**/*.go", "internal/a/a.go internal/a/a_test.go"},
+		{"**/*.rs", ""},
+	}
+	for _, tt := range tests {
+		if got := discover(t, tt.path); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.path, tt.want, got)
+		}
+	}
+
+	if _, err := discoverFiles("src/[a*", "", projectRoot, nil); err == nil {
+		t.Error("Expected an error for an invalid glob")
+	}
+	if _, err := discoverFiles("/elsewhere/**/*.go", "", projectRoot, nil); err == nil {
+		t.Error("Expected an error for a glob outside the project root")
+	}
+}
+
+func TestDiscoverDirectoryFromOtherWorkingDir(t *testing.T) {
+	projectRoot := t.TempDir()
+	writeTree(t, projectRoot, map[string]string{"internal/a/a.go": "package a\n"})
+	// The working directory has a directory of the same name, which must not be scanned
+	workDir := t.TempDir()
+	writeTree(t, workDir, map[string]string{"internal/other.go": "package other\n"})
+
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+
+	for _, path := range []string{"internal", "internal/a"} {
+		files, err := discoverFiles(path, "", projectRoot, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if want := []string{filepath.Join(projectRoot, "internal", "a", "a.go")}; !reflect.DeepEqual(files, want) {
+			t.Errorf("%s: expected %q, got %q", path, want, files)
+		}
+	}
+}
+
+func TestUnmatchedPathDiagnostics(t *testing.T) {
+	projectRoot := t.TempDir()
+	files := []string{filepath.Join(projectRoot, "main.go")}
+
+	diagnostics := unmatchedPathDiagnostics("**/*.go,**/*.rs,!vendor", projectRoot, files)
+	if len(diagnostics) != 1 || diagnostics[0].Level != DiagnosticWarning || diagnostics[0].Message != "glob pattern '**/*.rs' matched no files to scan" {
+		t.Errorf("Expected a warning for the unmatched pattern, got %+v", diagnostics)
+	}
+	if diagnostics := unmatchedPathDiagnostics("main.go", projectRoot, files); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %+v", diagnostics)
+	}
+	if diagnostics := unmatchedPathDiagnostics("missing.go", projectRoot, nil); len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "'missing.go' matched no files") {
+		t.Errorf("Expected a warning for the missing path, got %+v", diagnostics)
+	}
+}
@@ -0,0 +1,328 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/analysis/passes/appends"
+	"golang.org/x/tools/go/analysis/passes/asmdecl"
+	"golang.org/x/tools/go/analysis/passes/assign"
+	"golang.org/x/tools/go/analysis/passes/atomic"
+	"golang.org/x/tools/go/analysis/passes/bools"
+	"golang.org/x/tools/go/analysis/passes/buildtag"
+	"golang.org/x/tools/go/analysis/passes/cgocall"
+	"golang.org/x/tools/go/analysis/passes/composite"
+	"golang.org/x/tools/go/analysis/passes/copylock"
+	"golang.org/x/tools/go/analysis/passes/deepequalerrors"
+	"golang.org/x/tools/go/analysis/passes/defers"
+	"golang.org/x/tools/go/analysis/passes/directive"
+	"golang.org/x/tools/go/analysis/passes/errorsas"
+	"golang.org/x/tools/go/analysis/passes/framepointer"
+	"golang.org/x/tools/go/analysis/passes/hostport"
+	"golang.org/x/tools/go/analysis/passes/httpresponse"
+	"golang.org/x/tools/go/analysis/passes/ifaceassert"
+	"golang.org/x/tools/go/analysis/passes/loopclosure"
+	"golang.org/x/tools/go/analysis/passes/lostcancel"
+	"golang.org/x/tools/go/analysis/passes/nilfunc"
+	"golang.org/x/tools/go/analysis/passes/nilness"
+	"golang.org/x/tools/go/analysis/passes/printf"
+	"golang.org/x/tools/go/analysis/passes/reflectvaluecompare"
+	"golang.org/x/tools/go/analysis/passes/shadow"
+	"golang.org/x/tools/go/analysis/passes/shift"
+	"golang.org/x/tools/go/analysis/passes/sigchanyzer"
+	"golang.org/x/tools/go/analysis/passes/slog"
+	"golang.org/x/tools/go/analysis/passes/sortslice"
+	"golang.org/x/tools/go/analysis/passes/stdmethods"
+	"golang.org/x/tools/go/analysis/passes/stdversion"
+	"golang.org/x/tools/go/analysis/passes/stringintconv"
+	"golang.org/x/tools/go/analysis/passes/structtag"
+	"golang.org/x/tools/go/analysis/passes/testinggoroutine"
+	"golang.org/x/tools/go/analysis/passes/tests"
+	"golang.org/x/tools/go/analysis/passes/timeformat"
+	"golang.org/x/tools/go/analysis/passes/unmarshal"
+	"golang.org/x/tools/go/analysis/passes/unreachable"
+	"golang.org/x/tools/go/analysis/passes/unsafeptr"
+	"golang.org/x/tools/go/analysis/passes/unusedresult"
+	"golang.org/x/tools/go/analysis/passes/unusedwrite"
+	"golang.org/x/tools/go/analysis/passes/waitgroup"
+	"golang.org/x/tools/go/packages"
+)
+
+// GoAnalysisAnalyzerName is the name of the built-in analyzer that runs go/analysis passes
+// in-process
+const GoAnalysisAnalyzerName = "go-analysis"
+
+// goAnalysisSeverity is the severity of the findings of go/analysis passes, which have none
+const goAnalysisSeverity = "warning"
+
+// vetAnalyzers are the passes of go vet, run unless the project config names others
+var vetAnalyzers = []*analysis.Analyzer{
+	appends.Analyzer,
+	asmdecl.Analyzer,
+	assign.Analyzer,
+	atomic.Analyzer,
+	bools.Analyzer,
+	buildtag.Analyzer,
+	cgocall.Analyzer,
+	composite.Analyzer,
+	copylock.Analyzer,
+	defers.Analyzer,
+	directive.Analyzer,
+	errorsas.Analyzer,
+	framepointer.Analyzer,
+	hostport.Analyzer,
+	httpresponse.Analyzer,
+	ifaceassert.Analyzer,
+	loopclosure.Analyzer,
+	lostcancel.Analyzer,
+	nilfunc.Analyzer,
+	printf.Analyzer,
+	shift.Analyzer,
+	sigchanyzer.Analyzer,
+	slog.Analyzer,
+	stdmethods.Analyzer,
+	stdversion.Analyzer,
+	stringintconv.Analyzer,
+	structtag.Analyzer,
+	testinggoroutine.Analyzer,
+	tests.Analyzer,
+	timeformat.Analyzer,
+	unmarshal.Analyzer,
+	unreachable.Analyzer,
+	unsafeptr.Analyzer,
+	unusedresult.Analyzer,
+	waitgroup.Analyzer,
+}
+
+// optionalGoAnalyzers are passes outside go vet that only run when the project config names them
+var optionalGoAnalyzers = []*analysis.Analyzer{
+	deepequalerrors.Analyzer,
+	nilness.Analyzer,
+	reflectvaluecompare.Analyzer,
+	shadow.Analyzer,
+	sortslice.Analyzer,
+	unusedwrite.Analyzer,
+}
+
+// GoAnalysisConfig is the goAnalysis section of sgconfig.yml. ast-grep ignores it.
+type GoAnalysisConfig struct {
+	// Enabled runs the passes in every scan; otherwise they only run when a scan selects the
+	// go-analysis analyzer
+	Enabled bool `yaml:"enabled"`
+	// Analyzers names the passes to run. Empty runs the go vet suite and the passes registered
+	// with Options.GoAnalyzers.
+	Analyzers []string `yaml:"analyzers,omitempty"`
+	// Disable names passes that never run
+	Disable []string `yaml:"disable,omitempty"`
+}
+
+// goAnalysisAnalyzer type-checks the scanned files with their packages and runs go/analysis
+// passes over them
+type goAnalysisAnalyzer struct {
+	// registered are the passes of Options.GoAnalyzers
+	registered []*analysis.Analyzer
+}
+
+func (a *goAnalysisAnalyzer) Name() string {
+	return GoAnalysisAnalyzerName
+}
+
+func (a *goAnalysisAnalyzer) Capabilities() AnalyzerCapabilities {
+	return AnalyzerCapabilities{Languages: []string{"go"}}
+}
+
+// passes returns the passes the project config selects, sorted by name
+func (a *goAnalysisAnalyzer) passes(project Project) ([]*analysis.Analyzer, error) {
+	var config GoAnalysisConfig
+	if sgConfig, err := readSgConfig(project.SgconfigPath); err == nil && sgConfig.GoAnalysis != nil {
+		config = *sgConfig.GoAnalysis
+	}
+
+	available := make(map[string]*analysis.Analyzer)
+	for _, pass := range append(append(vetAnalyzers, optionalGoAnalyzers...), a.registered...) {
+		available[pass.Name] = pass
+	}
+
+	selected := make(map[string]*analysis.Analyzer)
+	if len(config.Analyzers) == 0 {
+		for _, pass := range append(vetAnalyzers, a.registered...) {
+			selected[pass.Name] = pass
+		}
+	}
+	for _, name := range config.Analyzers {
+		pass, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown go/analysis pass '%s' in %s", name, filepath.Base(project.SgconfigPath))
+		}
+		selected[name] = pass
+	}
+	for _, name := range config.Disable {
+		delete(selected, name)
+	}
+
+	passes := make([]*analysis.Analyzer, 0, len(selected))
+	for _, pass := range selected {
+		passes = append(passes, pass)
+	}
+	sort.Slice(passes, func(i, j int) bool { return passes[i].Name < passes[j].Name })
+	return passes, nil
+}
+
+func (a *goAnalysisAnalyzer) DiscoverRules(ctx context.Context, project Project) ([]RuleInfo, error) {
+	passes, err := a.passes(project)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]RuleInfo, 0, len(passes))
+	for _, pass := range passes {
+		summary, _, _ := strings.Cut(pass.Doc, "\n")
+		rules = append(rules, RuleInfo{ID: pass.Name, Language: "go", Severity: goAnalysisSeverity, Message: summary})
+	}
+	return rules, nil
+}
+
+func (a *goAnalysisAnalyzer) ScanFiles(ctx context.Context, project Project, files []string) (*ScanResult, error) {
+	passes, err := a.passes(project)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(files))
+	for _, file := range files {
+		wanted[filepath.Clean(file)] = true
+	}
+	patterns := packageDirPatterns(files)
+
+	// Test files are loaded with their package, so the package and its test variant both hold
+	// the non-test files; findings are deduplicated below
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packages.LoadAllSyntax,
+		Dir:     project.Root,
+		Tests:   true,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("could not load packages: %v", err)
+	}
+
+	var diagnostics []Diagnostic
+	reported := make(map[string]bool)
+	report := func(diagnostic Diagnostic) {
+		key := diagnostic.File + "\x00" + diagnostic.Message
+		if !reported[key] {
+			reported[key] = true
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			report(Diagnostic{Level: DiagnosticWarning, Source: GoAnalysisAnalyzerName, Message: pkgErr.Error()})
+		}
+	}
+
+	graph, err := checker.Analyze(passes, pkgs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string][]byte)
+	var findings []Finding
+	seen := make(map[string]bool)
+	for _, act := range graph.Roots {
+		if act.Err != nil {
+			report(Diagnostic{Level: DiagnosticWarning, Source: GoAnalysisAnalyzerName, Message: fmt.Sprintf("%s: %v", act.Analyzer.Name, act.Err)})
+			continue
+		}
+		for _, d := range act.Diagnostics {
+			start := act.Package.Fset.Position(d.Pos)
+			path := filepath.Clean(start.Filename)
+			if !wanted[path] {
+				continue
+			}
+			if _, ok := sources[path]; !ok {
+				sources[path], _ = os.ReadFile(path)
+			}
+			finding := goAnalysisFinding(act.Analyzer, d, act.Package.Fset, sources[path], relativeToProjectRoot(path, project.Root))
+			key := fmt.Sprintf("%s:%d:%d:%s:%s", finding.File, finding.StartLine, finding.StartColumn, finding.RuleID, finding.Message)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			findings = append(findings, finding)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		if findings[i].StartLine != findings[j].StartLine {
+			return findings[i].StartLine < findings[j].StartLine
+		}
+		return findings[i].StartColumn < findings[j].StartColumn
+	})
+	return newScanResult(findings, diagnostics), nil
+}
+
+func (a *goAnalysisAnalyzer) ScanSnippet(ctx context.Context, project Project, code, language string) (*ScanResult, error) {
+	return nil, fmt.Errorf("%s does not scan snippets", GoAnalysisAnalyzerName)
+}
+
+// goAnalysisFinding converts a diagnostic of pass in a file with the given source into a
+// finding. Columns count characters like those of ast-grep, and a suggested fix made of a single
+// edit becomes the finding's replacement.
+func goAnalysisFinding(pass *analysis.Analyzer, d analysis.Diagnostic, fset *token.FileSet, src []byte, file string) Finding {
+	start := fset.Position(d.Pos)
+	end := start
+	if d.End.IsValid() {
+		end = fset.Position(d.End)
+	}
+
+	finding := Finding{
+		RuleID:      pass.Name,
+		Severity:    goAnalysisSeverity,
+		Message:     d.Message,
+		File:        file,
+		StartLine:   start.Line,
+		StartColumn: charColumn(src, start.Offset, start.Column),
+		EndLine:     end.Line,
+		EndColumn:   charColumn(src, end.Offset, end.Column),
+		Analyzer:    GoAnalysisAnalyzerName,
+	}
+	if start.Offset <= end.Offset && end.Offset <= len(src) {
+		finding.Text = string(src[start.Offset:end.Offset])
+	}
+
+	if len(d.SuggestedFixes) == 1 && len(d.SuggestedFixes[0].TextEdits) == 1 {
+		edit := d.SuggestedFixes[0].TextEdits[0]
+		editStart, editEnd := fset.Position(edit.Pos), fset.Position(edit.End)
+		if !edit.End.IsValid() {
+			editEnd = editStart
+		}
+		if editStart.Filename == start.Filename && editEnd.Filename == start.Filename {
+			finding.Replacement = string(edit.NewText)
+			finding.fixStart, finding.fixEnd = editStart.Offset, editEnd.Offset
+		}
+	}
+	return finding
+}
+
+// charColumn converts the 1-based byte column of the byte at offset into a 1-based character
+// column
+func charColumn(src []byte, offset, column int) int {
+	lineStart := offset - (column - 1)
+	if lineStart < 0 || offset > len(src) {
+		return column
+	}
+	return utf8.RuneCount(src[lineStart:offset]) + 1
+}
@@ -0,0 +1,175 @@
+package mcp
+
+import (
+	"context"
+	"go/ast"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const goAnalysisSample = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Printf("%d é\n", "not a number")
+	legacyName()
+}
+
+func legacyName() {}
+`
+
+// legacyNameAnalyzer is a project pass reporting calls to legacyName with a fix renaming them
+var legacyNameAnalyzer = &analysis.Analyzer{
+	Name: "legacyname",
+	Doc:  "reports calls to legacyName\n\nThe function is being renamed.",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, file := range pass.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok && ident.Name == "legacyName" && pass.TypesInfo.Uses[ident] != nil {
+					pass.Report(analysis.Diagnostic{
+						Pos:     ident.Pos(),
+						End:     ident.End(),
+						Message: "legacyName is deprecated",
+						SuggestedFixes: []analysis.SuggestedFix{{
+							Message:   "Rename",
+							TextEdits: []analysis.TextEdit{{Pos: ident.Pos(), End: ident.End(), NewText: []byte("newName")}},
+						}},
+					})
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+// writeGoAnalysisProject creates a Go module with the sample and the given goAnalysis section,
+// and a fake ast-grep that finds nothing
+func writeGoAnalysisProject(t *testing.T, goAnalysis string) (projectRoot, sgPath string) {
+	t.Helper()
+	projectRoot = writeRuleProject(t, "no-panic")
+	os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n"+goAnalysis), 0644)
+	os.WriteFile(filepath.Join(projectRoot, "go.mod"), []byte("module example.com/sample\n\ngo 1.24\n"), 0644)
+	os.WriteFile(filepath.Join(projectRoot, "main.go"), []byte(goAnalysisSample), 0644)
+	return projectRoot, writeFakeAstGrep(t, t.TempDir(), "#!/bin/sh\necho '[]'\n")
+}
+
+// findingRules lists the rule id of each finding
+func findingRules(findings []Finding) string {
+	var rules []string
+	for _, finding := range findings {
+		rules = append(rules, finding.RuleID)
+	}
+	return strings.Join(rules, ", ")
+}
+
+func TestGoAnalysisAnalyzer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is needed to load packages")
+	}
+	ctx := context.Background()
+
+	t.Run("Enabled in the project config", func(t *testing.T) {
+		projectRoot, sgPath := writeGoAnalysisProject(t, "goAnalysis:\n  enabled: true\n")
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath, GoAnalyzers: []*analysis.Analyzer{legacyNameAnalyzer}})
+
+		result, err := s.ScanPath(ctx, ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if findingRules(result.Findings) != "printf, legacyname" || len(result.Diagnostics) != 0 {
+			t.Fatalf("Expected the vet and project passes to report, got %+v", result)
+		}
+
+		printf := result.Findings[0]
+		if printf.Analyzer != GoAnalysisAnalyzerName || printf.File != "main.go" || printf.StartLine != 6 || printf.StartColumn != 14 || printf.Text != "%d" || printf.Severity != "warning" {
+			t.Errorf("Unexpected printf finding: %+v", printf)
+		}
+		legacy := result.Findings[1]
+		if legacy.StartLine != 7 || legacy.Text != "legacyName" || legacy.Replacement != "newName" {
+			t.Errorf("Expected the suggested fix as the replacement, got %+v", legacy)
+		}
+
+		list, err := s.ListRules(ctx, "", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var passes []string
+		for _, rule := range list.Rules {
+			if rule.Analyzer == GoAnalysisAnalyzerName {
+				passes = append(passes, rule.ID)
+				if rule.ID == "legacyname" && rule.Message != "reports calls to legacyName" {
+					t.Errorf("Expected the first line of the doc as the message, got %q", rule.Message)
+				}
+			}
+		}
+		if len(passes) != len(vetAnalyzers)+1 {
+			t.Errorf("Expected the vet suite and the project pass to be listed, got %v", passes)
+		}
+	})
+
+	t.Run("Selected per scan", func(t *testing.T) {
+		projectRoot, sgPath := writeGoAnalysisProject(t, "")
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath})
+
+		result, err := s.ScanPath(ctx, ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(result.Findings) != 0 {
+			t.Errorf("Expected the passes not to run by default, got %+v", result.Findings)
+		}
+
+		result, err = s.ScanPath(ctx, ScanPathOptions{Path: ".", Analyzers: []string{GoAnalysisAnalyzerName}})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if findingRules(result.Findings) != "printf" {
+			t.Errorf("Expected the selected passes to run, got %+v", result.Findings)
+		}
+	})
+
+	t.Run("Configured passes", func(t *testing.T) {
+		projectRoot, sgPath := writeGoAnalysisProject(t, "goAnalysis:\n  enabled: true\n  analyzers: [printf, legacyname, nilness]\n  disable: [printf]\n")
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath, GoAnalyzers: []*analysis.Analyzer{legacyNameAnalyzer}})
+
+		result, err := s.ScanPath(ctx, ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if findingRules(result.Findings) != "legacyname" {
+			t.Errorf("Expected only the configured passes, got %+v", result)
+		}
+	})
+
+	t.Run("Unknown pass", func(t *testing.T) {
+		projectRoot, sgPath := writeGoAnalysisProject(t, "goAnalysis:\n  enabled: true\n  analyzers: [staticcheck]\n")
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath})
+
+		result, err := s.ScanPath(ctx, ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(result.Diagnostics) != 1 || result.Diagnostics[0].Source != GoAnalysisAnalyzerName || !strings.Contains(result.Diagnostics[0].Message, "unknown go/analysis pass 'staticcheck'") {
+			t.Errorf("Expected the unknown pass to be reported, got %+v", result.Diagnostics)
+		}
+	})
+}
+
+func TestCharColumn(t *testing.T) {
+	src := []byte("\tx := \"é\" + y\n")
+	// y is at byte column 13 but character column 12
+	if column := charColumn(src, 12, 13); column != 12 {
+		t.Errorf("Expected column 12, got %d", column)
+	}
+}
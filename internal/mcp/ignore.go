@@ -0,0 +1,314 @@
+package mcp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sherpaIgnoreFileName is the project-level ignore file, in .gitignore syntax, read from the
+// project root next to the .gitignore files
+const sherpaIgnoreFileName = ".sherpaignore"
+
+// defaultIgnorePatterns are ignored before any ignore file is read, so .sherpaignore can
+// re-include them with a negated pattern such as !vendor/
+var defaultIgnorePatterns = []string{"node_modules/", "vendor/"}
+
+// generatedCodePattern matches the standard comment marking generated Go files
+// (https://go.dev/s/generatedcode)
+var generatedCodePattern = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// globPattern is a .gitignore-style pattern. A pattern without a slash, other than a trailing
+// one, matches a name at any depth; otherwise it matches paths from the directory it was read
+// in. "**" matches any number of directories.
+type globPattern struct {
+	segments []string
+	// anchored is set when the pattern holds a slash, so it matches whole paths
+	anchored bool
+	// dirOnly is set by a trailing slash, so the pattern only matches directories
+	dirOnly bool
+	// negate is set by a leading "!", so a match re-includes the path
+	negate bool
+}
+
+// parseGlobPattern parses one .gitignore line, returning false for blank lines and comments
+func parseGlobPattern(line string) (globPattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return globPattern{}, false
+	}
+
+	var p globPattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// \# and \! escape a leading # or !
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return globPattern{}, false
+	}
+	p.segments = strings.Split(line, "/")
+	return p, true
+}
+
+// parseGlobPatterns parses the include and exclude arguments of a scan, reporting patterns
+// that are not valid globs
+func parseGlobPatterns(patterns []string) ([]globPattern, error) {
+	var parsed []globPattern
+	for _, pattern := range patterns {
+		p, ok := parseGlobPattern(strings.TrimSpace(pattern))
+		if !ok {
+			continue
+		}
+		for _, segment := range p.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob pattern '%s': %v", pattern, err)
+			}
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// matches reports whether the path made of segments, relative to the directory the pattern was
+// read in, matches the pattern
+func (p globPattern) matches(segments []string, isDir bool) bool {
+	if p.dirOnly && !isDir || len(segments) == 0 {
+		return false
+	}
+	if !p.anchored {
+		ok, _ := path.Match(p.segments[0], segments[len(segments)-1])
+		return ok
+	}
+	return matchSegments(p.segments, segments)
+}
+
+// matchSegments matches path segments against glob segments, "**" matching any number of them
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// readIgnoreFile reads the patterns of a .gitignore-style file; a missing file has none
+func readIgnoreFile(path string) []globPattern {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var patterns []globPattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := parseGlobPattern(scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// fileFilter decides which files under the project root a scan reads: it honors .gitignore
+// files at any depth, the project's .sherpaignore, the include and exclude globs of the scan
+// and, unless asked otherwise, skips generated Go files
+type fileFilter struct {
+	projectRoot      string
+	include          []globPattern
+	exclude          []globPattern
+	includeGenerated bool
+	// languages resolves the language filter and the language of each file
+	languages *languageRegistry
+	// ignores holds the patterns read in each directory, by slash-separated path relative to
+	// the project root ("" for the root)
+	ignores map[string][]globPattern
+}
+
+// newFileFilter creates the filter of a scan of the project rooted at projectRoot, whose files
+// are told apart by languages. An unknown language filter is an error.
+func newFileFilter(projectRoot string, languages *languageRegistry, opts ScanPathOptions) (*fileFilter, error) {
+	if opts.LanguageFilter != "" {
+		if _, err := languages.resolve(opts.LanguageFilter); err != nil {
+			return nil, err
+		}
+	}
+	include, err := parseGlobPatterns(opts.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := parseGlobPatterns(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &fileFilter{
+		projectRoot:      projectRoot,
+		include:          include,
+		exclude:          exclude,
+		includeGenerated: opts.IncludeGenerated,
+		languages:        languages,
+		ignores:          make(map[string][]globPattern),
+	}, nil
+}
+
+// dirPatterns returns the ignore patterns read in the directory at rel, loading them on first use
+func (f *fileFilter) dirPatterns(rel string) []globPattern {
+	if patterns, ok := f.ignores[rel]; ok {
+		return patterns
+	}
+
+	dir := filepath.Join(f.projectRoot, filepath.FromSlash(rel))
+	var patterns []globPattern
+	if rel == "" {
+		for _, line := range defaultIgnorePatterns {
+			p, _ := parseGlobPattern(line)
+			patterns = append(patterns, p)
+		}
+	}
+	patterns = append(patterns, readIgnoreFile(filepath.Join(dir, ".gitignore"))...)
+	if rel == "" {
+		patterns = append(patterns, readIgnoreFile(filepath.Join(dir, sherpaIgnoreFileName))...)
+	}
+	f.ignores[rel] = patterns
+	return patterns
+}
+
+// relativeSegments splits the path of a file under the project root into its segments, or
+// returns nil for the root itself and paths outside it
+func (f *fileFilter) relativeSegments(filePath string) []string {
+	rel, err := filepath.Rel(f.projectRoot, resolvePathRelativeToProjectRoot(filePath, f.projectRoot))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+// ignoredBy reports whether the ignore files exclude the path made of segments. Patterns of
+// deeper directories are applied last, so they take precedence, like git does.
+func (f *fileFilter) ignoredBy(segments []string, isDir bool) bool {
+	ignored := false
+	for depth := 0; depth < len(segments); depth++ {
+		for _, p := range f.dirPatterns(strings.Join(segments[:depth], "/")) {
+			if p.matches(segments[depth:], isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// excluded reports whether the path made of segments matches an exclude glob
+func (f *fileFilter) excluded(segments []string, isDir bool) bool {
+	for _, p := range f.exclude {
+		if p.matches(segments, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipDir reports whether the walk should not descend into the directory at dirPath
+func (f *fileFilter) skipDir(dirPath string) bool {
+	name := filepath.Base(dirPath)
+	if name == ".git" || name == stateDirName {
+		return true
+	}
+	if f == nil {
+		return false
+	}
+	segments := f.relativeSegments(dirPath)
+	if segments == nil {
+		return false
+	}
+	return f.ignoredBy(segments, true) || f.excluded(segments, true)
+}
+
+// skipFile reports whether the file at filePath is left out of the scan. A file inside an
+// ignored directory is skipped too, since git cannot re-include it either.
+func (f *fileFilter) skipFile(filePath string) bool {
+	if f == nil {
+		return false
+	}
+	if segments := f.relativeSegments(filePath); segments != nil {
+		for i := 1; i < len(segments); i++ {
+			if f.ignoredBy(segments[:i], true) || f.excluded(segments[:i], true) {
+				return true
+			}
+		}
+		if f.ignoredBy(segments, false) || f.excluded(segments, false) {
+			return true
+		}
+		if len(f.include) > 0 && !f.included(segments) {
+			return true
+		}
+	}
+	return !f.includeGenerated && strings.EqualFold(filepath.Ext(filePath), ".go") && isGeneratedGoFile(filePath)
+}
+
+// inLanguage reports whether the file at filePath is written in language, telling languages
+// apart with the project's registry, or the built-in languages with a nil filter
+func (f *fileFilter) inLanguage(filePath, language string) bool {
+	if f == nil {
+		return defaultLanguages.matches(filePath, language)
+	}
+	return f.languages.matches(relativeToProjectRoot(filePath, f.projectRoot), language)
+}
+
+// included reports whether the path made of segments matches an include glob
+func (f *fileFilter) included(segments []string) bool {
+	for _, p := range f.include {
+		if p.matches(segments, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGeneratedGoFile reports whether the Go file at path carries the standard generated code
+// comment before its package clause
+func isGeneratedGoFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+		if generatedCodePattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGlobPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"/build", "src/build", true, false},
+		{"/build", "build", true, true},
+		{"docs/*.md", "docs/readme.md", false, true},
+		{"docs/*.md", "docs/api/readme.md", false, false},
+		{"**/testdata", "a/b/testdata", true, true},
+		{"internal/**/gen.go", "internal/gen.go", false, true},
+		{"internal/**/gen.go", "internal/a/b/gen.go", false, true},
+		{"internal/**", "internal/a.go", false, true},
+		{`\#notes`, "#notes", false, true},
+	}
+
+	for _, tt := range tests {
+		p, ok := parseGlobPattern(tt.pattern)
+		if !ok {
+			t.Fatalf("Expected %q to parse", tt.pattern)
+		}
+		if got := p.matches(strings.Split(tt.path, "/"), tt.isDir); got != tt.want {
+			t.Errorf("%q matching %q (dir: %v): expected %v, got %v", tt.pattern, tt.path, tt.isDir, tt.want, got)
+		}
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "/"} {
+		if _, ok := parseGlobPattern(line); ok {
+			t.Errorf("Expected %q to hold no pattern", line)
+		}
+	}
+	if _, err := parseGlobPatterns([]string{"src/[a"}); err == nil {
+		t.Error("Expected an error for an invalid glob")
+	}
+}
+
+// writeTree writes files, given by slash-separated path relative to root, with their content
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestDiscoverFilesFilter(t *testing.T) {
+	projectRoot := t.TempDir()
+	writeTree(t, projectRoot, map[string]string{
+		".gitignore":              "*.log\nbuild/\n",
+		".sherpaignore":           "fixtures/\n",
+		".git/config":             "",
+		"main.go":                 "package main\n",
+		"debug.log":               "",
+		"build/out.go":            "package out\n",
+		"fixtures/bad.go":         "package fixtures\n",
+		"node_modules/lib/x.js":   "",
+		"vendor/dep/dep.go":       "package dep\n",
+		"api/api.pb.go":           "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n",
+		"api/api.go":              "// Package api is written by hand.\npackage api\n",
+		"pkg/.gitignore":          "*.tmp.go\n!keep.tmp.go\n",
+		"pkg/a.tmp.go":            "package pkg\n",
+		"pkg/keep.tmp.go":         "package pkg\n",
+		"pkg/pkg.go":              "package pkg\n",
+		"pkg/pkg_test.go":         "package pkg\n",
+		"pkg/testdata/sample.go":  "package sample\n",
+		".context-sherpa/data.go": "package data\n",
+	})
+
+	discover := func(t *testing.T, path string, opts ScanPathOptions) string {
+		t.Helper()
+		filter, err := newFileFilter(projectRoot, defaultLanguages, opts)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		files, err := discoverFiles(path, "", projectRoot, filter)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var rels []string
+		for _, file := range files {
+			rels = append(rels, relativeToProjectRoot(file, projectRoot))
+		}
+		sort.Strings(rels)
+		return strings.Join(rels, " ")
+	}
+
+	t.Run("Ignore files and generated code", func(t *testing.T) {
+		got := discover(t, ".", ScanPathOptions{})
+		want := ".gitignore .sherpaignore api/api.go main.go pkg/.gitignore pkg/keep.tmp.go pkg/pkg.go pkg/pkg_test.go pkg/testdata/sample.go"
+		if got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("Generated code can be included", func(t *testing.T) {
+		if got := discover(t, filepath.Join(projectRoot, "api", "api.pb.go"), ScanPathOptions{IncludeGenerated: true}); got != "api/api.pb.go" {
+			t.Errorf("Expected the generated file, got %q", got)
+		}
+		if got := discover(t, filepath.Join(projectRoot, "api", "api.pb.go"), ScanPathOptions{}); got != "" {
+			t.Errorf("Expected the generated file to be skipped, got %q", got)
+		}
+	})
+
+	t.Run("Include and exclude globs", func(t *testing.T) {
+		got := discover(t, ".", ScanPathOptions{Include: []string{"*.go"}, Exclude: []string{"testdata/", "*_test.go"}})
+		if got != "api/api.go main.go pkg/keep.tmp.go pkg/pkg.go" {
+			t.Errorf("Expected only the selected Go files, got %q", got)
+		}
+		if got := discover(t, ".", ScanPathOptions{Include: []string{"pkg/**/*.go"}}); got != "pkg/keep.tmp.go pkg/pkg.go pkg/pkg_test.go pkg/testdata/sample.go" {
+			t.Errorf("Expected the Go files under pkg, got %q", got)
+		}
+	})
+
+	t.Run("Named files in ignored directories are skipped", func(t *testing.T) {
+		if got := discover(t, filepath.Join(projectRoot, "build", "out.go"), ScanPathOptions{}); got != "" {
+			t.Errorf("Expected no files, got %q", got)
+		}
+	})
+
+	t.Run("Sherpaignore re-includes default ignores", func(t *testing.T) {
+		os.WriteFile(filepath.Join(projectRoot, ".sherpaignore"), []byte("fixtures/\n!vendor/\n"), 0644)
+		defer os.WriteFile(filepath.Join(projectRoot, ".sherpaignore"), []byte("fixtures/\n"), 0644)
+		if got := discover(t, ".", ScanPathOptions{Include: []string{"vendor/**"}}); got != "vendor/dep/dep.go" {
+			t.Errorf("Expected the vendored file, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package mcp
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// languageSpec describes a language ast-grep parses
+type languageSpec struct {
+	// Name is the name ast-grep gives the language in rules
+	Name string
+	// Aliases are the other names ast-grep accepts for it
+	Aliases []string
+	// Extensions are the file extensions of the language, without the dot. The first one is
+	// used for the temporary file of scan_code.
+	Extensions []string
+	// CommentPrefix starts the comments sherpa-ignore suppressions are written in; empty for
+	// languages without comments
+	CommentPrefix string
+}
+
+// builtinLanguages are the languages ast-grep supports out of the box, with the extensions it
+// maps to them
+var builtinLanguages = []languageSpec{
+	{Name: "bash", Aliases: []string{"sh"}, Extensions: []string{"sh", "bash", "bats", "cgi", "command", "env", "fcgi", "ksh", "tmux", "tool", "zsh"}, CommentPrefix: "#"},
+	{Name: "c", Extensions: []string{"c", "h"}, CommentPrefix: "//"},
+	{Name: "cpp", Aliases: []string{"c++", "cc", "cxx"}, Extensions: []string{"cpp", "cc", "cxx", "c++", "hpp", "hh", "hxx", "cu", "ino"}, CommentPrefix: "//"},
+	{Name: "csharp", Aliases: []string{"cs", "c#"}, Extensions: []string{"cs"}, CommentPrefix: "//"},
+	{Name: "css", Extensions: []string{"css", "scss"}, CommentPrefix: "/*"},
+	{Name: "elixir", Aliases: []string{"ex"}, Extensions: []string{"ex", "exs"}, CommentPrefix: "#"},
+	{Name: "go", Aliases: []string{"golang"}, Extensions: []string{"go"}, CommentPrefix: "//"},
+	{Name: "haskell", Aliases: []string{"hs"}, Extensions: []string{"hs"}, CommentPrefix: "--"},
+	{Name: "html", Extensions: []string{"html", "htm", "xhtml"}, CommentPrefix: "<!--"},
+	{Name: "java", Extensions: []string{"java"}, CommentPrefix: "//"},
+	{Name: "javascript", Aliases: []string{"js", "jsx"}, Extensions: []string{"js", "jsx", "mjs", "cjs"}, CommentPrefix: "//"},
+	{Name: "json", Extensions: []string{"json"}},
+	{Name: "kotlin", Aliases: []string{"kt"}, Extensions: []string{"kt", "kts", "ktm"}, CommentPrefix: "//"},
+	{Name: "lua", Extensions: []string{"lua"}, CommentPrefix: "--"},
+	{Name: "php", Extensions: []string{"php"}, CommentPrefix: "//"},
+	{Name: "python", Aliases: []string{"py"}, Extensions: []string{"py", "py3", "pyi", "bzl"}, CommentPrefix: "#"},
+	{Name: "ruby", Aliases: []string{"rb"}, Extensions: []string{"rb", "rbw", "gemspec"}, CommentPrefix: "#"},
+	{Name: "rust", Aliases: []string{"rs"}, Extensions: []string{"rs"}, CommentPrefix: "//"},
+	{Name: "scala", Extensions: []string{"scala", "sc", "sbt"}, CommentPrefix: "//"},
+	{Name: "swift", Extensions: []string{"swift"}, CommentPrefix: "//"},
+	{Name: "tsx", Extensions: []string{"tsx"}, CommentPrefix: "//"},
+	{Name: "typescript", Aliases: []string{"ts"}, Extensions: []string{"ts", "mts", "cts"}, CommentPrefix: "//"},
+	{Name: "yaml", Aliases: []string{"yml"}, Extensions: []string{"yaml", "yml"}, CommentPrefix: "#"},
+}
+
+// defaultCommentPrefix is assumed for files of unknown languages
+const defaultCommentPrefix = "//"
+
+// languageGlob maps the files matching a pattern of sgconfig.yml's languageGlobs to a language
+type languageGlob struct {
+	pattern  globPattern
+	language *languageSpec
+}
+
+// languageRegistry resolves language names and the language of files for one project: the
+// built-in languages, the customLanguages of its sgconfig.yml and its languageGlobs, which take
+// precedence over extensions
+type languageRegistry struct {
+	byName      map[string]*languageSpec
+	byExtension map[string]*languageSpec
+	globs       []languageGlob
+}
+
+// newLanguageRegistry builds the registry of a project from its sgconfig.yml; a nil config
+// gives the built-in languages only
+func newLanguageRegistry(config *SgConfig) *languageRegistry {
+	r := &languageRegistry{
+		byName:      make(map[string]*languageSpec),
+		byExtension: make(map[string]*languageSpec),
+	}
+	for i := range builtinLanguages {
+		spec := builtinLanguages[i]
+		r.add(&spec)
+	}
+	if config == nil {
+		return r
+	}
+
+	names := make([]string, 0, len(config.CustomLanguages))
+	for name := range config.CustomLanguages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		custom := config.CustomLanguages[name]
+		spec := &languageSpec{Name: name, CommentPrefix: defaultCommentPrefix}
+		for _, ext := range custom.Extensions {
+			spec.Extensions = append(spec.Extensions, strings.TrimPrefix(ext, "."))
+		}
+		r.add(spec)
+	}
+
+	names = names[:0]
+	for name := range config.LanguageGlobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec, ok := r.lookup(name)
+		if !ok {
+			continue
+		}
+		for _, line := range config.LanguageGlobs[name] {
+			if p, ok := parseGlobPattern(line); ok && !p.negate {
+				r.globs = append(r.globs, languageGlob{pattern: p, language: spec})
+			}
+		}
+	}
+	return r
+}
+
+// add registers a language under its name and aliases. A custom language replaces a built-in
+// one of the same name, and claims its extensions.
+func (r *languageRegistry) add(spec *languageSpec) {
+	for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+		r.byName[strings.ToLower(name)] = spec
+	}
+	for _, ext := range spec.Extensions {
+		r.byExtension[strings.ToLower(ext)] = spec
+	}
+}
+
+// defaultLanguages holds the built-in languages, for scans without a project configuration
+var defaultLanguages = newLanguageRegistry(nil)
+
+// loadLanguages returns the language registry of the project configured by the sgconfig.yml at
+// sgconfigPath. A config that cannot be read leaves the built-in languages.
+func loadLanguages(sgconfigPath string) *languageRegistry {
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		return defaultLanguages
+	}
+	return newLanguageRegistry(config)
+}
+
+// lookup resolves a language name or alias, ignoring case
+func (r *languageRegistry) lookup(name string) (*languageSpec, bool) {
+	spec, ok := r.byName[strings.ToLower(strings.TrimSpace(name))]
+	return spec, ok
+}
+
+// resolve resolves a language name like lookup, with an error listing the known languages
+func (r *languageRegistry) resolve(name string) (*languageSpec, error) {
+	if spec, ok := r.lookup(name); ok {
+		return spec, nil
+	}
+	return nil, fmt.Errorf("unknown language '%s' (supported: %s)", name, strings.Join(r.names(), ", "))
+}
+
+// names lists the names of the known languages, sorted
+func (r *languageRegistry) names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, spec := range r.byName {
+		if !seen[spec.Name] {
+			seen[spec.Name] = true
+			names = append(names, spec.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// languageOf returns the language of the file at path, relative to the project root when
+// languageGlobs should apply, or nil when no language claims it
+func (r *languageRegistry) languageOf(path string) *languageSpec {
+	if len(r.globs) > 0 {
+		segments := strings.Split(filepath.ToSlash(path), "/")
+		for _, glob := range r.globs {
+			if glob.pattern.matches(segments, false) {
+				return glob.language
+			}
+		}
+	}
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return nil
+	}
+	return r.byExtension[strings.ToLower(ext)]
+}
+
+// matches reports whether the file at path is written in the named language
+func (r *languageRegistry) matches(path, language string) bool {
+	spec, ok := r.lookup(language)
+	return ok && r.languageOf(path) == spec
+}
+
+// commentPrefix returns the comment prefix of the language of the file at path
+func (r *languageRegistry) commentPrefix(path string) string {
+	if spec := r.languageOf(path); spec != nil {
+		return spec.CommentPrefix
+	}
+	return defaultCommentPrefix
+}
@@ -0,0 +1,122 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLanguageRegistry(t *testing.T) {
+	tests := []struct {
+		path     string
+		language string
+		want     bool
+	}{
+		{"web/app.tsx", "tsx", true},
+		{"web/app.tsx", "typescript", false},
+		{"web/app.jsx", "javascript", true},
+		{"web/app.mjs", "js", true},
+		{"include/a.hpp", "cpp", true},
+		{"include/a.HPP", "c++", true},
+		{"App.kt", "kotlin", true},
+		{"Gemfile.gemspec", "ruby", true},
+		{"Program.cs", "csharp", true},
+		{"main.swift", "swift", true},
+		{"init.lua", "lua", true},
+		{"index.html", "html", true},
+		{"site.css", "css", true},
+		{"main.go", "golang", true},
+		{"main.go", "cobol", false},
+		{"Makefile", "bash", false},
+	}
+	for _, tt := range tests {
+		if got := defaultLanguages.matches(tt.path, tt.language); got != tt.want {
+			t.Errorf("matches(%q, %q): expected %v, got %v", tt.path, tt.language, tt.want, got)
+		}
+	}
+
+	if _, err := defaultLanguages.resolve("cobol"); err == nil || !strings.Contains(err.Error(), "supported: bash, c, cpp") {
+		t.Errorf("Expected an error listing the languages, got %v", err)
+	}
+	if prefix := defaultLanguages.commentPrefix("script.py"); prefix != "#" {
+		t.Errorf("Expected # comments for Python, got %q", prefix)
+	}
+	if prefix := defaultLanguages.commentPrefix("data.json"); prefix != "" {
+		t.Errorf("Expected no comments for JSON, got %q", prefix)
+	}
+}
+
+func TestLanguageRegistryFromSgConfig(t *testing.T) {
+	languages := newLanguageRegistry(&SgConfig{
+		LanguageGlobs:   map[string][]string{"html": {"*.vue"}, "tsx": {"legacy/*.ts"}},
+		CustomLanguages: map[string]CustomLanguage{"mojo": {Extensions: []string{"mojo", ".🔥"}}},
+	})
+
+	if spec := languages.languageOf("components/App.vue"); spec == nil || spec.Name != "html" {
+		t.Errorf("Expected .vue files to be html, got %+v", spec)
+	}
+	if !languages.matches("legacy/app.ts", "tsx") || !languages.matches("src/app.ts", "typescript") {
+		t.Error("Expected anchored language globs to only apply under their directory")
+	}
+	if !languages.matches("main.mojo", "mojo") || !languages.matches("main.🔥", "mojo") {
+		t.Error("Expected the extensions of the custom language to match")
+	}
+	if _, err := languages.resolve("Mojo"); err != nil {
+		t.Errorf("Expected the custom language to resolve, got %v", err)
+	}
+}
+
+func TestCheckRuleLanguage(t *testing.T) {
+	languages := newLanguageRegistry(&SgConfig{CustomLanguages: map[string]CustomLanguage{"mojo": {Extensions: []string{"mojo"}}}})
+
+	for _, language := range []string{"go", "TypeScript", "mojo"} {
+		if err := checkRuleLanguage("id: r\nlanguage: "+language+"\nrule:\n  pattern: x\n", languages); err != nil {
+			t.Errorf("Expected %s to be accepted, got %v", language, err)
+		}
+	}
+	err := checkRuleLanguage("id: r\nlanguage: cobol\nrule:\n  pattern: x\n", languages)
+	if err == nil || !strings.Contains(err.Error(), "line 2: unknown language 'cobol'") {
+		t.Errorf("Expected the unknown language to be reported on line 2, got %v", err)
+	}
+}
+
+// snippetFakeAstGrep reports the file it was asked to scan as the text of a match
+const snippetFakeAstGrep = `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+	*ast-grep-scan*) file="$arg" ;;
+	esac
+done
+printf '[{"text": "%s", "range": {"byteOffset": {"start": 0, "end": 1}, "start": {"line": 0, "column": 0}, "end": {"line": 0, "column": 1}}, "file": "%s", "ruleId": "r", "severity": "error", "message": "m"}]' "$file" "$file"
+`
+
+func TestScanCodeLanguage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+
+	projectRoot := writeRuleProject(t, "r")
+	sgconfig := "ruleDirs:\n  - rules\ncustomLanguages:\n  mojo:\n    libraryPath: mojo.so\n    extensions: [mojo]\n"
+	if err := os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte(sgconfig), 0644); err != nil {
+		t.Fatalf("Failed to write sgconfig.yml: %v", err)
+	}
+	sgPath := writeFakeAstGrep(t, t.TempDir(), snippetFakeAstGrep)
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath})
+
+	for language, ext := range map[string]string{"ts": ".ts", "tsx": ".tsx", "golang": ".go", "mojo": ".mojo"} {
+		result, err := s.ScanCode(context.Background(), "x", language)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", language, err)
+		}
+		if len(result.Findings) != 1 || !strings.HasSuffix(result.Findings[0].Text, ext) {
+			t.Errorf("%s: expected a temporary file ending in %s, got %+v", language, ext, result.Findings)
+		}
+	}
+
+	if _, err := s.ScanCode(context.Background(), "x", "cobol"); err == nil || !strings.Contains(err.Error(), "unknown language 'cobol'") {
+		t.Errorf("Expected an unknown language error, got %v", err)
+	}
+}
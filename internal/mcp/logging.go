@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Supported values of the --logFormat flag
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogOptions configures the logging subsystem
+type LogOptions struct {
+	// Level is one of debug, info (default), warn or error
+	Level string
+	// Format is LogFormatText (default) or LogFormatJSON
+	Format string
+	// File, when set, receives logs in addition to stderr
+	File string
+	// Quiet stops logging to stderr; logs still go to File when it is set
+	Quiet bool
+}
+
+// parseLogLevel converts a level name into a slog level, defaulting to info
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if strings.TrimSpace(name) == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return level, fmt.Errorf("unsupported log level '%s' (supported: 'debug', 'info', 'warn', 'error')", name)
+	}
+	return level, nil
+}
+
+// newLogHandler returns a handler writing to w in the configured format and level
+func newLogHandler(w io.Writer, opts LogOptions) (slog.Handler, error) {
+	level, err := parseLogLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(strings.TrimSpace(opts.Format)) {
+	case "", LogFormatText:
+		return slog.NewTextHandler(w, handlerOpts), nil
+	case LogFormatJSON:
+		return slog.NewJSONHandler(w, handlerOpts), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format '%s' (supported: '%s', '%s')", opts.Format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// newLogger builds the logger described by opts. Nothing is ever logged to stdout, which carries
+// the JSON-RPC stream of the stdio transport. The returned file is the opened log file, if any,
+// and should be closed when the server stops.
+func newLogger(opts LogOptions) (*slog.Logger, *os.File, error) {
+	var writers []io.Writer
+	if !opts.Quiet {
+		writers = append(writers, os.Stderr)
+	}
+
+	var logFile *os.File
+	if opts.File != "" {
+		var err error
+		logFile, err = os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file %s: %w", opts.File, err)
+		}
+		writers = append(writers, logFile)
+	}
+
+	var w io.Writer = io.Discard
+	if len(writers) > 0 {
+		w = io.MultiWriter(writers...)
+	}
+
+	handler, err := newLogHandler(w, opts)
+	if err != nil {
+		if logFile != nil {
+			logFile.Close()
+		}
+		return nil, nil, err
+	}
+	logger := slog.New(handler)
+
+	logger.Debug("Debug logging enabled", "file", opts.File)
+	return logger, logFile, nil
+}
+
+// requestIDValue unwraps a JSON-RPC request id so it is logged as a plain number or string
+func requestIDValue(id any) any {
+	if requestID, ok := id.(mcp.RequestId); ok {
+		return requestID.Value()
+	}
+	return id
+}
+
+// newRequestLoggingHooks returns hooks that log every tool call with its tool name, request id
+// and duration
+func (s *Server) newRequestLoggingHooks() *server.Hooks {
+	// The same request pointer is passed to the before, after and error hooks of one call
+	var started sync.Map
+
+	finish := func(id any, req *mcp.CallToolRequest) []any {
+		attrs := []any{"tool", req.Params.Name, "request_id", requestIDValue(id)}
+		if start, ok := started.LoadAndDelete(req); ok {
+			attrs = append(attrs, "duration", time.Since(start.(time.Time)))
+		}
+		return attrs
+	}
+
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(func(ctx context.Context, id any, req *mcp.CallToolRequest) {
+		started.Store(req, time.Now())
+		s.logger.Debug("Tool call started", "tool", req.Params.Name, "request_id", requestIDValue(id))
+	})
+	hooks.AddAfterCallTool(func(ctx context.Context, id any, req *mcp.CallToolRequest, result *mcp.CallToolResult) {
+		attrs := finish(id, req)
+		s.logger.Info("Tool call finished", append(attrs, "is_error", result != nil && result.IsError)...)
+	})
+	hooks.AddOnError(func(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
+		if req, ok := message.(*mcp.CallToolRequest); ok && method == mcp.MethodToolsCall {
+			s.logger.Error("Tool call failed", append(finish(id, req), "error", err)...)
+			return
+		}
+		s.logger.Error("Request failed", "method", method, "request_id", requestIDValue(id), "error", err)
+	})
+	return hooks
+}
@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"":      slog.LevelInfo,
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for name, expected := range tests {
+		level, err := parseLogLevel(name)
+		if err != nil || level != expected {
+			t.Errorf("parseLogLevel(%q) = %v, %v; expected %v", name, level, err, expected)
+		}
+	}
+
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+}
+
+func TestNewLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := newLogHandler(&buf, LogOptions{Level: "warn", Format: "json"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	l := slog.New(handler)
+	l.Info("dropped")
+	l.Warn("kept", "tool", "scan_path")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "kept" || record["tool"] != "scan_path" {
+		t.Errorf("Unexpected record: %v", record)
+	}
+
+	if _, err := newLogHandler(&buf, LogOptions{Format: "xml"}); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func TestNewLoggerNeverWritesToStdout(t *testing.T) {
+	oldStdout := os.Stdout
+	defer func() { os.Stdout = oldStdout }()
+
+	stdoutFile := filepath.Join(t.TempDir(), "stdout")
+	stdout, err := os.Create(stdoutFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	os.Stdout = stdout
+
+	logPath := filepath.Join(t.TempDir(), "sherpa.log")
+	logger, logFile, err := newLogger(LogOptions{Level: "debug", File: logPath, Quiet: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	logger.Info("Starting MCP server...")
+	logFile.Close()
+
+	if data, _ := os.ReadFile(stdoutFile); len(data) != 0 {
+		t.Errorf("Expected nothing on stdout, got: %s", data)
+	}
+	if data, _ := os.ReadFile(logPath); !strings.Contains(string(data), "Starting MCP server...") {
+		t.Errorf("Expected the message in the log file, got: %s", data)
+	}
+}
+
+func TestRequestLoggingHooks(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewServer(Options{
+		ProjectRoot: t.TempDir(),
+		Logger:      slog.New(slog.NewJSONHandler(&buf, nil)),
+	}).newMCPServer()
+	message := `{"jsonrpc": "2.0", "id": 7, "method": "tools/call", "params": {"name": "list_rules", "arguments": {}}}`
+	s.HandleMessage(context.Background(), json.RawMessage(message))
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "Tool call finished" || record["tool"] != "list_rules" || record["request_id"] != float64(7) {
+		t.Errorf("Unexpected record: %v", record)
+	}
+	if _, ok := record["duration"]; !ok {
+		t.Errorf("Expected the call duration to be logged, got: %v", record)
+	}
+	if _, ok := record["is_error"]; !ok {
+		t.Errorf("Expected the tool result status to be logged, got: %v", record)
+	}
+}
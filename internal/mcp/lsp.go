@@ -0,0 +1,425 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lspShutdownTimeout bounds how long a language server is given to exit
+const lspShutdownTimeout = 5 * time.Second
+
+// lspPosition is a zero-based position; Character counts UTF-16 code units, as in LSP
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+// lspLocationLink is the alternative form of a definition result
+type lspLocationLink struct {
+	TargetURI            string   `json:"targetUri"`
+	TargetRange          lspRange `json:"targetRange"`
+	TargetSelectionRange lspRange `json:"targetSelectionRange"`
+}
+
+type lspTextDocumentPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+// lspHover is the result of textDocument/hover. Contents may be MarkupContent, a MarkedString
+// or an array of MarkedStrings, so it is decoded by hoverText.
+type lspHover struct {
+	Contents json.RawMessage `json:"contents"`
+	Range    *lspRange       `json:"range,omitempty"`
+}
+
+// lspMessage is a JSON-RPC 2.0 request, notification or response
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *lspError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// lspResponse is what a pending call receives
+type lspResponse struct {
+	result json.RawMessage
+	err    error
+}
+
+// lspClient talks to a language server subprocess over stdio. Requests may be sent from
+// several goroutines; responses are matched to them by id.
+type lspClient struct {
+	cmd    *exec.Cmd
+	logger *slog.Logger
+
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan lspResponse
+	// opened holds the text and version last sent for each open document
+	opened map[string]lspDocument
+	// done is closed once the server's output ends
+	done chan struct{}
+	err  error
+}
+
+// startLSPClient starts the language server at path and initializes it for the workspace
+// rooted at rootDir
+func startLSPClient(ctx context.Context, path string, args []string, rootDir string, logger *slog.Logger) (*lspClient, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Dir = rootDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	// The server's stderr is its log; it must never reach our stdout
+	cmd.Stderr = io.Discard
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start %s: %v", path, err)
+	}
+
+	c := &lspClient{
+		cmd:     cmd,
+		logger:  logger,
+		stdin:   stdin,
+		pending: make(map[int]chan lspResponse),
+		opened:  make(map[string]lspDocument),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(bufio.NewReader(stdout))
+
+	rootURI := fileURI(rootDir)
+	initParams := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   rootURI,
+		"workspaceFolders": []map[string]string{
+			{"uri": rootURI, "name": filepath.Base(rootDir)},
+		},
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"hover": map[string]interface{}{
+					"contentFormat": []string{"markdown", "plaintext"},
+				},
+			},
+		},
+	}
+	if err := c.call(ctx, "initialize", initParams, nil); err != nil {
+		c.close()
+		return nil, fmt.Errorf("initialize failed: %v", err)
+	}
+	if err := c.notify("initialized", map[string]interface{}{}); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// alive reports whether the server is still running
+func (c *lspClient) alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// call sends a request and decodes its result into result, which may be nil
+func (c *lspClient) call(ctx context.Context, method string, params, result interface{}) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan lspResponse, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	rawID := json.RawMessage(strconv.Itoa(id))
+	if err := c.write(lspMessage{ID: &rawID, Method: method, Params: mustMarshal(params)}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.err != nil {
+			return fmt.Errorf("%s: %v", method, resp.err)
+		}
+		if result != nil && len(resp.result) > 0 {
+			if err := json.Unmarshal(resp.result, result); err != nil {
+				return fmt.Errorf("%s: could not decode result: %v", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		// Tell the server to stop working on the abandoned request
+		c.notify("$/cancelRequest", map[string]int{"id": id})
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification, which has no response
+func (c *lspClient) notify(method string, params interface{}) error {
+	return c.write(lspMessage{Method: method, Params: mustMarshal(params)})
+}
+
+// write sends one message with its Content-Length header
+func (c *lspClient) write(msg lspMessage) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return fmt.Errorf("language server is not running: %v", err)
+	}
+	if _, err := c.stdin.Write(body); err != nil {
+		return fmt.Errorf("language server is not running: %v", err)
+	}
+	return nil
+}
+
+// readLoop dispatches the server's messages until its output ends
+func (c *lspClient) readLoop(r *bufio.Reader) {
+	var err error
+	for {
+		var msg *lspMessage
+		msg, err = readLSPMessage(r)
+		if err != nil {
+			break
+		}
+
+		switch {
+		case msg.ID != nil && msg.Method != "":
+			c.write(lspMessage{ID: msg.ID, Result: serverRequestResult(msg)})
+		case msg.ID != nil:
+			id, convErr := strconv.Atoi(string(*msg.ID))
+			if convErr != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch, ok := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if ok {
+				resp := lspResponse{result: msg.Result}
+				if msg.Error != nil {
+					resp.err = msg.Error
+				}
+				ch <- resp
+			}
+		case msg.Method == "window/logMessage":
+			c.logger.Debug("Language server message", "params", string(msg.Params))
+		}
+	}
+
+	if errors.Is(err, io.EOF) {
+		err = errors.New("language server exited")
+	}
+	c.mu.Lock()
+	c.err = err
+	for id, ch := range c.pending {
+		ch <- lspResponse{err: err}
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// serverRequestResult answers a request sent by the server. The client has no settings and
+// no UI, so every answer is empty: one null per workspace/configuration item, null otherwise.
+func serverRequestResult(msg *lspMessage) json.RawMessage {
+	if msg.Method == "workspace/configuration" {
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		return mustMarshal(make([]interface{}, len(params.Items)))
+	}
+	return json.RawMessage("null")
+}
+
+// readLSPMessage reads one Content-Length framed message
+func readLSPMessage(r *bufio.Reader) (*lspMessage, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var msg lspMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %v", err)
+	}
+	return &msg, nil
+}
+
+// lspDocument is a document open in the language server. Its version grows with each change,
+// as the protocol requires.
+type lspDocument struct {
+	text    string
+	version int
+}
+
+// syncDocument opens the file in the server, or sends its new text when it changed on disk
+// since it was opened, so queries see the current content
+func (c *lspClient) syncDocument(path, languageID string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	uri := fileURI(path)
+	text := string(data)
+
+	c.mu.Lock()
+	previous, ok := c.opened[uri]
+	doc := lspDocument{text: text, version: previous.version + 1}
+	if ok && previous.text == text {
+		doc = previous
+	}
+	c.opened[uri] = doc
+	c.mu.Unlock()
+
+	if !ok {
+		return text, c.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"uri":        uri,
+				"languageId": languageID,
+				"version":    doc.version,
+				"text":       text,
+			},
+		})
+	}
+	if previous.text != text {
+		return text, c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": doc.version},
+			"contentChanges": []map[string]string{{"text": text}},
+		})
+	}
+	return text, nil
+}
+
+// close asks the server to shut down and waits for it to exit
+func (c *lspClient) close() error {
+	if c.alive() {
+		ctx, cancel := context.WithTimeout(context.Background(), lspShutdownTimeout)
+		c.call(ctx, "shutdown", nil, nil)
+		cancel()
+		c.notify("exit", nil)
+	}
+	c.stdin.Close()
+
+	select {
+	case <-c.done:
+	case <-time.After(lspShutdownTimeout):
+		c.cmd.Process.Kill()
+	}
+	return c.cmd.Wait()
+}
+
+// mustMarshal encodes params, which are always plain data
+func mustMarshal(params interface{}) json.RawMessage {
+	if params == nil {
+		return nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// fileURI converts an absolute path into a file:// URI
+func fileURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path // Windows drive letters
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// uriToPath converts a file:// URI back into a path
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	path := u.Path
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:] // Windows drive letters
+	}
+	return filepath.FromSlash(path)
+}
@@ -0,0 +1,306 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLSPScriptEnv names the script that turns the test binary into a fake language server
+const fakeLSPScriptEnv = "SHERPA_FAKE_LSP_SCRIPT"
+
+func TestMain(m *testing.M) {
+	if script := os.Getenv(fakeLSPScriptEnv); script != "" {
+		os.Exit(runFakeLanguageServer(script))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeLSPScript tells the fake language server how to answer
+type fakeLSPScript struct {
+	// Results maps request methods to their result; other requests get null
+	Results map[string]json.RawMessage `json:"results"`
+	// Errors maps request methods to an error response
+	Errors map[string]lspError `json:"errors"`
+	// Ignore lists request methods that are never answered
+	Ignore []string `json:"ignore"`
+	// CrashOn makes the server exit when it receives this method
+	CrashOn string `json:"crash_on"`
+	// AskConfiguration sends a workspace/configuration request once initialized
+	AskConfiguration bool `json:"ask_configuration"`
+	// Log is the file every received message is appended to, one JSON object per line
+	Log string `json:"log"`
+}
+
+// runFakeLanguageServer serves the script on stdin and stdout until it receives exit
+func runFakeLanguageServer(scriptPath string) int {
+	data, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return 2
+	}
+	var script fakeLSPScript
+	if err := json.Unmarshal(data, &script); err != nil {
+		return 2
+	}
+	logFile, err := os.OpenFile(script.Log, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return 2
+	}
+	defer logFile.Close()
+
+	client := &lspClient{stdin: nopWriteCloser{os.Stdout}}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		msg, err := readLSPMessage(in)
+		if err != nil {
+			return 0
+		}
+		line, _ := json.Marshal(msg)
+		logFile.Write(append(line, '\n'))
+
+		if script.CrashOn != "" && msg.Method == script.CrashOn {
+			return 1
+		}
+		switch {
+		case msg.Method == "exit":
+			return 0
+		case msg.Method == "initialized" && script.AskConfiguration:
+			id := json.RawMessage(`"server-1"`)
+			client.write(lspMessage{ID: &id, Method: "workspace/configuration", Params: json.RawMessage(`{"items":[{"section":"gopls"},{"section":"go"}]}`)})
+		case msg.ID != nil && msg.Method != "":
+			if containsString(script.Ignore, msg.Method) {
+				continue
+			}
+			if lspErr, ok := script.Errors[msg.Method]; ok {
+				client.write(lspMessage{ID: msg.ID, Error: &lspErr})
+				continue
+			}
+			result, ok := script.Results[msg.Method]
+			if !ok {
+				result = json.RawMessage("null")
+			}
+			client.write(lspMessage{ID: msg.ID, Result: result})
+		}
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFakeLanguageServer prepares the test binary to act as a language server following script
+// and returns its path together with the log of the messages it receives
+func writeFakeLanguageServer(t *testing.T, script fakeLSPScript) (serverPath, logPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	script.Log = filepath.Join(dir, "messages.jsonl")
+	data, err := json.Marshal(script)
+	if err != nil {
+		t.Fatalf("Failed to encode script: %v", err)
+	}
+	scriptPath := filepath.Join(dir, "script.json")
+	if err := os.WriteFile(scriptPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	t.Setenv(fakeLSPScriptEnv, scriptPath)
+	return os.Args[0], script.Log
+}
+
+// receivedLSPMessages reads the messages logged by the fake language server
+func receivedLSPMessages(t *testing.T, logPath string) []lspMessage {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read the language server log: %v", err)
+	}
+	var messages []lspMessage
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var msg lspMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("Invalid logged message %q: %v", line, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// receivedMethods lists the methods of the logged messages
+func receivedMethods(messages []lspMessage) []string {
+	var methods []string
+	for _, msg := range messages {
+		methods = append(methods, msg.Method)
+	}
+	return methods
+}
+
+func TestLSPClient(t *testing.T) {
+	serverPath, logPath := writeFakeLanguageServer(t, fakeLSPScript{
+		Results: map[string]json.RawMessage{
+			"textDocument/hover": json.RawMessage(`{"contents":{"kind":"markdown","value":"hello"}}`),
+		},
+		Errors: map[string]lspError{
+			"textDocument/definition": {Code: -32603, Message: "no package for file"},
+		},
+		AskConfiguration: true,
+	})
+	root := t.TempDir()
+	ctx := context.Background()
+
+	client, err := startLSPClient(ctx, serverPath, nil, root, slog.Default())
+	if err != nil {
+		t.Fatalf("Expected the client to start, got: %v", err)
+	}
+
+	var hover lspHover
+	if err := client.call(ctx, "textDocument/hover", map[string]string{}, &hover); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if hoverText(hover.Contents) != "hello" {
+		t.Errorf("Expected the scripted hover, got %s", hover.Contents)
+	}
+
+	err = client.call(ctx, "textDocument/definition", map[string]string{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "textDocument/definition: no package for file (code -32603)") {
+		t.Errorf("Expected the error response to be returned, got: %v", err)
+	}
+
+	file := filepath.Join(root, "main.go")
+	os.WriteFile(file, []byte("package main\n"), 0644)
+	for i := 0; i < 2; i++ {
+		if _, err := client.syncDocument(file, "go"); err != nil {
+			t.Fatalf("Expected the document to be opened, got: %v", err)
+		}
+	}
+	for _, text := range []string{"package main\n\nfunc main() {}\n", "package main\n\nfunc main() { main() }\n"} {
+		os.WriteFile(file, []byte(text), 0644)
+		if _, err := client.syncDocument(file, "go"); err != nil {
+			t.Fatalf("Expected the document to be updated, got: %v", err)
+		}
+	}
+
+	if err := client.close(); err != nil {
+		t.Errorf("Expected the server to exit cleanly, got: %v", err)
+	}
+
+	messages := receivedLSPMessages(t, logPath)
+	var requests []lspMessage
+	var reply *lspMessage
+	for i, msg := range messages {
+		if msg.Method == "" {
+			reply = &messages[i]
+		} else {
+			requests = append(requests, msg)
+		}
+	}
+	methods := strings.Join(receivedMethods(requests), ",")
+	expected := "initialize,initialized,textDocument/hover,textDocument/definition,textDocument/didOpen,textDocument/didChange,textDocument/didChange,shutdown,exit"
+	if methods != expected {
+		t.Errorf("Expected messages %s, got %s", expected, methods)
+	}
+
+	// Each change of the document raises its version
+	var versions []int
+	for _, msg := range requests {
+		if strings.HasPrefix(msg.Method, "textDocument/did") {
+			var params struct {
+				TextDocument struct {
+					Version int `json:"version"`
+				} `json:"textDocument"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			versions = append(versions, params.TextDocument.Version)
+		}
+	}
+	if fmt.Sprint(versions) != "[1 2 3]" {
+		t.Errorf("Expected the document versions [1 2 3], got %v", versions)
+	}
+
+	// The workspace/configuration request is answered with one null per item
+	if reply == nil || string(reply.Result) != "[null,null]" {
+		t.Errorf("Expected one null per configuration item, got %+v", reply)
+	}
+
+	var initParams struct {
+		RootURI string `json:"rootUri"`
+	}
+	json.Unmarshal(messages[0].Params, &initParams)
+	if initParams.RootURI != fileURI(root) {
+		t.Errorf("Expected the workspace root %s, got %s", fileURI(root), initParams.RootURI)
+	}
+}
+
+func TestLSPClientServerExit(t *testing.T) {
+	serverPath, _ := writeFakeLanguageServer(t, fakeLSPScript{CrashOn: "textDocument/hover"})
+	ctx := context.Background()
+
+	client, err := startLSPClient(ctx, serverPath, nil, t.TempDir(), slog.Default())
+	if err != nil {
+		t.Fatalf("Expected the client to start, got: %v", err)
+	}
+	defer client.close()
+
+	err = client.call(ctx, "textDocument/hover", map[string]string{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "language server exited") {
+		t.Errorf("Expected the exit to be reported, got: %v", err)
+	}
+	if client.alive() {
+		t.Error("Expected the client to notice the server exited")
+	}
+	if err := client.call(ctx, "textDocument/hover", map[string]string{}, nil); err == nil {
+		t.Error("Expected calls after the exit to fail")
+	}
+}
+
+func TestLSPClientContextCancel(t *testing.T) {
+	serverPath, logPath := writeFakeLanguageServer(t, fakeLSPScript{Ignore: []string{"textDocument/references"}})
+
+	client, err := startLSPClient(context.Background(), serverPath, nil, t.TempDir(), slog.Default())
+	if err != nil {
+		t.Fatalf("Expected the client to start, got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.call(ctx, "textDocument/references", map[string]string{}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to end the call, got: %v", err)
+	}
+	client.close()
+
+	methods := receivedMethods(receivedLSPMessages(t, logPath))
+	if !containsString(methods, "$/cancelRequest") {
+		t.Errorf("Expected the abandoned request to be cancelled, got %v", methods)
+	}
+}
+
+func TestFileURI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir with space", "main.go")
+	uri := fileURI(path)
+	if !strings.HasPrefix(uri, "file:///") || !strings.Contains(uri, "dir%20with%20space") {
+		t.Errorf("Unexpected URI %s", uri)
+	}
+	if back := uriToPath(uri); back != path {
+		t.Errorf("Expected %s back, got %s", path, back)
+	}
+}
@@ -0,0 +1,176 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultPreviewSampleSize is the number of matches included in a rule preview by default
+const defaultPreviewSampleSize = 10
+
+// FileMatchCount is the number of matches of a previewed rule in one file
+type FileMatchCount struct {
+	File    string `json:"file"`
+	Matches int    `json:"matches"`
+}
+
+// RulePreview is the document returned by the preview_rule tool
+type RulePreview struct {
+	RuleID       string           `json:"rule_id"`
+	FilesScanned int              `json:"files_scanned"`
+	TotalMatches int              `json:"total_matches"`
+	Files        []FileMatchCount `json:"files"`
+	// Samples holds the first matches, in file order, up to the requested sample size
+	Samples     []Finding    `json:"samples"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// newRulePreview summarizes the findings of a previewed rule
+func newRulePreview(ruleID string, outcome *scanPathOutcome, sampleSize int) *RulePreview {
+	preview := &RulePreview{
+		RuleID:       ruleID,
+		FilesScanned: len(outcome.Files),
+		TotalMatches: len(outcome.Result.Findings),
+		Files:        []FileMatchCount{},
+		Samples:      []Finding{},
+		Diagnostics:  []Diagnostic{},
+	}
+
+	counts := make(map[string]int)
+	for _, finding := range outcome.Result.Findings {
+		counts[finding.File]++
+	}
+	for file, count := range counts {
+		preview.Files = append(preview.Files, FileMatchCount{File: file, Matches: count})
+	}
+	// Files with the most matches first
+	sort.Slice(preview.Files, func(i, j int) bool {
+		if preview.Files[i].Matches != preview.Files[j].Matches {
+			return preview.Files[i].Matches > preview.Files[j].Matches
+		}
+		return preview.Files[i].File < preview.Files[j].File
+	})
+
+	findings := append([]Finding(nil), outcome.Result.Findings...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].StartLine < findings[j].StartLine
+	})
+	if len(findings) > sampleSize {
+		findings = findings[:sampleSize]
+	}
+	preview.Samples = append(preview.Samples, findings...)
+
+	// Unused sherpa-ignore comments are about the saved rules, not the one being previewed
+	for _, diagnostic := range outcome.Result.Diagnostics {
+		if diagnostic.Source != suppressionMarker {
+			preview.Diagnostics = append(preview.Diagnostics, diagnostic)
+		}
+	}
+
+	return preview
+}
+
+// previewRuleHandler handles the preview_rule tool
+func (s *Server) previewRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ruleYAML, err := req.RequireString("rule_yaml")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	opts, err := scanPathOptionsFromRequest(req, ".")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	sampleSize := req.GetInt("sample_size", defaultPreviewSampleSize)
+	if sampleSize < 0 {
+		sampleSize = 0
+	}
+
+	if err := validateAstGrepRule(ruleYAML); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid rule: %v", err)), nil
+	}
+
+	setup, errResult := s.prepareScan(opts.Sgconfig)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	if err := checkRuleLanguage(ruleYAML, setup.Languages); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid rule: %v", err)), nil
+	}
+	if err := s.validateRuleWithAstGrep(ctx, setup.SgPath, setup.SgconfigPath, ruleYAML); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid rule: %v", err)), nil
+	}
+
+	// The rule lives in a temporary file, so nothing is written to the rule directories
+	tempDir, err := os.MkdirTemp("", "sherpa-preview-")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error creating temporary directory: %v", err)), nil
+	}
+	defer os.RemoveAll(tempDir)
+
+	ruleFile := filepath.Join(tempDir, "rule.yml")
+	if err := os.WriteFile(ruleFile, []byte(ruleYAML), 0644); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error writing temporary rule file: %v", err)), nil
+	}
+	// Only the previewed rule runs, so the other analyzers are left out
+	setup.Analyzers = []Analyzer{&astGrepAnalyzer{server: s, sgPath: setup.SgPath, ruleFile: ruleFile}}
+	setup.Constraints = previewConstraints(ruleYAML)
+	setup.ConstraintDiagnostics = nil
+
+	filter, err := newFileFilter(setup.ProjectRoot, setup.Languages, opts)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	files, err := discoverFiles(opts.Path, opts.LanguageFilter, setup.ProjectRoot, filter)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error discovering files: %v", err)), nil
+	}
+
+	s.logger.Debug("Previewing rule", "files", len(files))
+
+	outcome, errResult := s.scanFiles(ctx, setup, files)
+	if errResult != nil {
+		return errResult, nil
+	}
+	// Counts over part of the files would understate the rule's impact
+	if errResult := incompleteScanError(ctx, outcome.Result); errResult != nil {
+		return errResult, nil
+	}
+	outcome.Result.Diagnostics = append(outcome.Result.Diagnostics, unmatchedPathDiagnostics(opts.Path, setup.ProjectRoot, files)...)
+
+	var rule AstGrepRule
+	if root, err := parseRuleYAML(ruleYAML); err == nil {
+		root.Decode(&rule)
+	}
+
+	data, err := json.MarshalIndent(newRulePreview(rule.ID, outcome, sampleSize), "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error encoding preview: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+// previewConstraints reads the semantic constraints of the previewed rule, by rule id. The rule
+// has been validated, so it parses.
+func previewConstraints(ruleYAML string) map[string][]semanticConstraint {
+	root, err := parseRuleYAML(ruleYAML)
+	if err != nil {
+		return nil
+	}
+	constraints, err := semanticConstraints(root)
+	if err != nil || len(constraints) == 0 {
+		return nil
+	}
+	return map[string][]semanticConstraint{mappingValue(root, "id"): constraints}
+}
@@ -0,0 +1,92 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// previewMatch is an ast-grep match of the no-panic rule on a 0-based line
+func previewMatch(file string, line int) string {
+	return fmt.Sprintf(`{"text": "panic(err)", "range": {"byteOffset": {"start": 0, "end": 10}, "start": {"line": %d, "column": 1}, "end": {"line": %d, "column": 11}}, "file": %q, "ruleId": "no-panic", "severity": "error", "message": "Do not panic"}`, line, line, file)
+}
+
+func TestPreviewRuleHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot := t.TempDir()
+	os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n"), 0644)
+	os.MkdirAll(filepath.Join(projectRoot, "rules"), 0755)
+	os.WriteFile(filepath.Join(projectRoot, "a.go"), []byte("package a\n\nfunc a() {\n\tpanic(err)\n\tpanic(err)\n}\n"), 0644)
+	os.WriteFile(filepath.Join(projectRoot, "b.go"), []byte("package b\n\n// sherpa-ignore: other-rule reason=\"x\"\nfunc b() { panic(err) }\n"), 0644)
+
+	output := "[" + previewMatch("a.go", 3) + "," + previewMatch("b.go", 3) + "," + previewMatch("a.go", 4) + "]"
+	toolDir := t.TempDir()
+	argsFile := filepath.Join(toolDir, "args")
+	script := "#!/bin/sh\necho \"$@\" >> " + argsFile + "\ncase \"$*\" in\n  *--json=compact*) echo '[]' ;;\n  *) cat <<'EOF'\n" + output + "\nEOF\n  ;;\nesac\n"
+
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: writeFakeAstGrep(t, toolDir, script)})
+
+	req := mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Arguments: map[string]interface{}{
+				"rule_yaml":   "id: no-panic\nlanguage: go\nmessage: Do not panic\nrule:\n  pattern: panic($$$)\n",
+				"sample_size": float64(2),
+				"language":    "go",
+			},
+		},
+	}
+	result, err := s.previewRuleHandler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error from handler, got: %v", err)
+	}
+
+	var preview RulePreview
+	if err := json.Unmarshal([]byte(toolResultText(t, result)), &preview); err != nil {
+		t.Fatalf("Expected JSON output, got: %v", err)
+	}
+
+	if preview.RuleID != "no-panic" || preview.TotalMatches != 3 || preview.FilesScanned != 2 {
+		t.Errorf("Unexpected preview summary: %+v", preview)
+	}
+	if len(preview.Files) != 2 || preview.Files[0] != (FileMatchCount{File: "a.go", Matches: 2}) {
+		t.Errorf("Expected files sorted by match count, got %+v", preview.Files)
+	}
+	if len(preview.Samples) != 2 || preview.Samples[0].StartLine != 4 || preview.Samples[1].StartLine != 5 {
+		t.Errorf("Expected the first 2 matches in file order, got %+v", preview.Samples)
+	}
+	if len(preview.Diagnostics) != 0 {
+		t.Errorf("Expected unrelated suppression diagnostics to be dropped, got %+v", preview.Diagnostics)
+	}
+
+	args, _ := os.ReadFile(argsFile)
+	// The rule runs on its own, with the config for the utility rules it may reference
+	for _, line := range strings.Split(strings.TrimSpace(string(args)), "\n") {
+		if !strings.Contains(line, "--rule") || !strings.Contains(line, "--config "+filepath.Join(projectRoot, "sgconfig.yml")) {
+			t.Errorf("Expected the rule to run with the project's config, got arguments:\n%s", line)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(projectRoot, "rules")); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written to the rule directory, found %d files", len(entries))
+	}
+}
+
+func TestPreviewRuleHandlerInvalidRule(t *testing.T) {
+	req := mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Arguments: map[string]interface{}{"rule_yaml": "id: r\nlanguage: go\nrule:\n  patern: x\n"},
+		},
+	}
+	result, _ := NewServer(Options{}).previewRuleHandler(context.Background(), req)
+	if !result.IsError || !strings.Contains(toolResultText(t, result), "unknown rule key 'patern'") {
+		t.Errorf("Expected the invalid rule to be rejected, got: %s", toolResultText(t, result))
+	}
+}
@@ -0,0 +1,386 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultRuleSeverity is the severity ast-grep assumes when a rule does not declare one
+const defaultRuleSeverity = "hint"
+
+// RuleInfo summarizes a rule defined in one of the configured rule directories
+type RuleInfo struct {
+	ID       string `json:"id"`
+	Language string `json:"language"`
+	Severity string `json:"severity"`
+	Message  string `json:"message,omitempty"`
+	// File is the rule file, relative to the project root
+	File string `json:"file"`
+	// Origin is the ruleDirs entry of sgconfig.yml the rule was loaded from
+	Origin string `json:"origin"`
+	// Analyzer is the analyzer that runs the rule
+	Analyzer string `json:"analyzer"`
+}
+
+// RuleList is the document returned by the list_rules tool
+type RuleList struct {
+	Rules       []RuleInfo   `json:"rules"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// ruleDocument is a single rule read from a rule file, which may define several rules
+type ruleDocument struct {
+	ruleMetadata
+	Path    string
+	RuleDir string
+	node    *yaml.Node
+	// shared is set when the rule file holds more than one YAML document
+	shared bool
+}
+
+// isRuleFile reports whether path looks like an ast-grep rule file
+func isRuleFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// loadRuleDocuments reads every rule under all the ruleDirs declared in the given sgconfig.yml.
+// Rule directories are resolved relative to the directory containing the config file.
+// Rule files that cannot be parsed are reported as diagnostics rather than failing the load.
+func loadRuleDocuments(sgconfigPath string) ([]ruleDocument, []Diagnostic, error) {
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var docs []ruleDocument
+	var problems []Diagnostic
+	configDir := filepath.Dir(sgconfigPath)
+	for _, ruleDir := range config.RuleDirs {
+		ruleDir = strings.TrimSpace(ruleDir)
+		dir := filepath.Join(configDir, ruleDir)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !isRuleFile(path) {
+				return nil
+			}
+
+			fileDocs, err := readRuleDocuments(path)
+			if err != nil {
+				problems = append(problems, Diagnostic{
+					Level:   DiagnosticError,
+					Source:  "context-sherpa",
+					Message: err.Error(),
+					File:    relativeToProjectRoot(path, configDir),
+				})
+			}
+			for _, doc := range fileDocs {
+				doc.RuleDir = ruleDir
+				docs = append(docs, doc)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return docs, problems, fmt.Errorf("error reading rules in %s: %v", dir, err)
+		}
+	}
+
+	return docs, problems, nil
+}
+
+// readRuleDocuments reads the rules defined in a rule file, which may hold several YAML documents.
+// The rules decoded before a parse error are still returned.
+func readRuleDocuments(path string) ([]ruleDocument, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var docs []ruleDocument
+	decoder := yaml.NewDecoder(file)
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return docs, fmt.Errorf("error parsing %s: %v", path, err)
+		}
+
+		var meta ruleMetadata
+		if err := node.Decode(&meta); err != nil {
+			return docs, fmt.Errorf("error parsing %s: %v", path, err)
+		}
+		if meta.ID != "" {
+			docs = append(docs, ruleDocument{ruleMetadata: meta, Path: path, node: &node})
+		}
+	}
+
+	if len(docs) > 1 {
+		for i := range docs {
+			docs[i].shared = true
+		}
+	}
+	return docs, nil
+}
+
+// YAML returns the rule's YAML. Rules sharing a file with other rules are re-encoded on their own.
+func (d ruleDocument) YAML() (string, error) {
+	if !d.shared {
+		data, err := os.ReadFile(d.Path)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	data, err := yaml.Marshal(d.node)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// findRuleDocument returns the rule named ruleID: the rule with that id or, failing that, the
+// rule of the file <ruleID>.yml. It returns nil when there is none.
+func findRuleDocument(docs []ruleDocument, ruleID string) *ruleDocument {
+	for i := range docs {
+		if docs[i].ID == ruleID {
+			return &docs[i]
+		}
+	}
+	for i := range docs {
+		name := filepath.Base(docs[i].Path)
+		if strings.TrimSuffix(name, filepath.Ext(name)) == ruleID {
+			return &docs[i]
+		}
+	}
+	return nil
+}
+
+// ruleInfos converts rule documents into RuleInfo, keeping those matching the language and
+// severity filters (either may be empty), sorted by id
+func ruleInfos(docs []ruleDocument, projectRoot, languageFilter, severityFilter string) []RuleInfo {
+	rules := make([]RuleInfo, 0, len(docs))
+	for _, doc := range docs {
+		severity := strings.ToLower(doc.Severity)
+		if severity == "" {
+			severity = defaultRuleSeverity
+		}
+		if languageFilter != "" && !strings.EqualFold(doc.Language, languageFilter) {
+			continue
+		}
+		if severityFilter != "" && severity != severityFilter {
+			continue
+		}
+
+		rules = append(rules, RuleInfo{
+			ID:       doc.ID,
+			Language: doc.Language,
+			Severity: severity,
+			Message:  doc.Message,
+			File:     relativeToProjectRoot(doc.Path, projectRoot),
+			Origin:   doc.RuleDir,
+			Analyzer: AstGrepAnalyzerName,
+		})
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].ID != rules[j].ID {
+			return rules[i].ID < rules[j].ID
+		}
+		return rules[i].File < rules[j].File
+	})
+	return rules
+}
+
+// duplicateRuleDiagnostics reports rule ids defined more than once, since ast-grep would
+// run each copy and report every violation twice
+func duplicateRuleDiagnostics(rules []RuleInfo) []Diagnostic {
+	files := make(map[string][]string)
+	var ids []string
+	for _, rule := range rules {
+		if _, ok := files[rule.ID]; !ok {
+			ids = append(ids, rule.ID)
+		}
+		files[rule.ID] = append(files[rule.ID], rule.File)
+	}
+
+	var diagnostics []Diagnostic
+	for _, id := range ids {
+		if len(files[id]) > 1 {
+			diagnostics = append(diagnostics, Diagnostic{
+				Level:   DiagnosticWarning,
+				Source:  "context-sherpa",
+				Message: fmt.Sprintf("rule '%s' is defined more than once: %s", id, strings.Join(files[id], ", ")),
+			})
+		}
+	}
+	return diagnostics
+}
+
+// ruleSetFromRequest locates the project root and the sgconfig.yml named by the sgconfig argument
+func (s *Server) ruleSetFromRequest(req mcp.CallToolRequest) (projectRoot, sgconfigPath string, errResult *mcp.CallToolResult) {
+	sgconfigStr := "sgconfig.yml" // Default value
+	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
+		if sgconfig, ok := args["sgconfig"].(string); ok && sgconfig != "" {
+			sgconfigStr = sgconfig
+		}
+	}
+	return s.ruleSet(sgconfigStr)
+}
+
+// ruleSet locates the project root and the named sgconfig.yml.
+// When either is missing, the tool result describing the problem is returned instead.
+func (s *Server) ruleSet(sgconfigStr string) (projectRoot, sgconfigPath string, errResult *mcp.CallToolResult) {
+	projectRoot, err := s.findProjectRoot()
+	if err != nil {
+		return "", "", mcp.NewToolResultText(fmt.Sprintf("Error: %s. Please run the 'initialize_ast_grep' tool first to set up the project.", err.Error()))
+	}
+
+	sgconfigPath = resolvePathRelativeToProjectRoot(sgconfigStr, projectRoot)
+	if _, err := os.Stat(sgconfigPath); os.IsNotExist(err) {
+		return "", "", mcp.NewToolResultText(fmt.Sprintf("Error: Configuration file '%s' not found at resolved path '%s'. Please run the 'initialize_ast_grep' tool first to set up the project.", sgconfigStr, sgconfigPath))
+	}
+
+	return projectRoot, sgconfigPath, nil
+}
+
+// listRulesHandler handles the list_rules tool
+func (s *Server) listRulesHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var languageFilter, severityFilter string
+	sgconfigStr := "sgconfig.yml" // Default value
+	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
+		if lang, ok := args["language"].(string); ok && lang != "" {
+			languageFilter = strings.ToLower(lang)
+		}
+		if severity, ok := args["severity"].(string); ok && severity != "" {
+			severityFilter = strings.ToLower(severity)
+		}
+		if sgconfig, ok := args["sgconfig"].(string); ok && sgconfig != "" {
+			sgconfigStr = sgconfig
+		}
+	}
+
+	list, errResult := s.listRules(ctx, sgconfigStr, languageFilter, severityFilter)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error encoding rules: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+// listRules loads the rules of the named sgconfig.yml and those of the other analyzers, keeping
+// the ones matching the filters. When the ast-grep rules cannot be loaded, the tool result
+// describing why is returned instead.
+func (s *Server) listRules(ctx context.Context, sgconfigStr, languageFilter, severityFilter string) (*RuleList, *mcp.CallToolResult) {
+	projectRoot, sgconfigPath, errResult := s.ruleSet(sgconfigStr)
+	if errResult != nil {
+		return nil, errResult
+	}
+
+	docs, problems, err := loadRuleDocuments(sgconfigPath)
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Error loading rules: %v", err))
+	}
+
+	list := &RuleList{
+		Rules:       ruleInfos(docs, projectRoot, languageFilter, severityFilter),
+		Diagnostics: problems,
+	}
+	list.Diagnostics = append(list.Diagnostics, duplicateRuleDiagnostics(ruleInfos(docs, projectRoot, "", ""))...)
+
+	project := Project{Root: projectRoot, SgconfigPath: sgconfigPath}
+	for _, analyzer := range defaultAnalyzers(s.analyzers(""), sgconfigPath) {
+		if analyzer.Name() == AstGrepAnalyzerName {
+			continue // listed above
+		}
+		rules, err := analyzer.DiscoverRules(ctx, project)
+		if err != nil {
+			list.Diagnostics = append(list.Diagnostics, Diagnostic{
+				Level:   DiagnosticError,
+				Source:  analyzer.Name(),
+				Message: fmt.Sprintf("could not list rules: %v", err),
+			})
+			continue
+		}
+		for _, rule := range rules {
+			if languageFilter != "" && !strings.EqualFold(rule.Language, languageFilter) {
+				continue
+			}
+			if severityFilter != "" && !strings.EqualFold(rule.Severity, severityFilter) {
+				continue
+			}
+			if rule.Analyzer == "" {
+				rule.Analyzer = analyzer.Name()
+			}
+			list.Rules = append(list.Rules, rule)
+		}
+	}
+
+	if list.Diagnostics == nil {
+		list.Diagnostics = []Diagnostic{}
+	}
+	return list, nil
+}
+
+// getRuleHandler handles the get_rule tool
+func (s *Server) getRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ruleID, err := req.RequireString("rule_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	projectRoot, sgconfigPath, errResult := s.ruleSetFromRequest(req)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	docs, _, err := loadRuleDocuments(sgconfigPath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error loading rules: %v", err)), nil
+	}
+
+	var result strings.Builder
+	for _, doc := range docs {
+		if doc.ID != ruleID {
+			continue
+		}
+
+		yamlContent, err := doc.YAML()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading rule '%s': %v", ruleID, err)), nil
+		}
+
+		if result.Len() > 0 {
+			result.WriteString("\n")
+		}
+		fmt.Fprintf(&result, "Rule '%s' defined in %s:\n\n```yaml\n%s", ruleID, relativeToProjectRoot(doc.Path, projectRoot), yamlContent)
+		if !strings.HasSuffix(yamlContent, "\n") {
+			result.WriteString("\n")
+		}
+		result.WriteString("```\n")
+	}
+
+	if result.Len() == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' not found.", ruleID)), nil
+	}
+	return mcp.NewToolResultText(result.String()), nil
+}
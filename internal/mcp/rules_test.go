@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestLoadRuleDocuments(t *testing.T) {
+	projectRoot := writeSarifTestProject(t)
+	os.WriteFile(filepath.Join(projectRoot, "rules", "broken.yml"), []byte("id: [unterminated\n"), 0644)
+
+	docs, problems, err := loadRuleDocuments(filepath.Join(projectRoot, "sgconfig.yml"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(docs))
+	}
+	if len(problems) != 1 || problems[0].File != "rules/broken.yml" {
+		t.Errorf("Expected the broken rule file to be reported, got %+v", problems)
+	}
+
+	rules := ruleInfos(docs, projectRoot, "", "")
+	if rules[0].ID != "no-fmt-println" || rules[0].File != "rules/no-fmt-println.yml" || rules[0].Origin != "rules" {
+		t.Errorf("Unexpected rule info: %+v", rules[0])
+	}
+	if rules[2].ID != "no-todo" || rules[2].Origin != "more-rules" {
+		t.Errorf("Expected rules from the second rule directory, got %+v", rules[2])
+	}
+}
+
+func TestRuleInfosFilters(t *testing.T) {
+	docs := []ruleDocument{
+		{ruleMetadata: ruleMetadata{ID: "a", Language: "Go", Severity: "error"}},
+		{ruleMetadata: ruleMetadata{ID: "b", Language: "python", Severity: "warning"}},
+		{ruleMetadata: ruleMetadata{ID: "c", Language: "go"}},
+	}
+
+	tests := []struct {
+		name     string
+		language string
+		severity string
+		expected []string
+	}{
+		{"No filters", "", "", []string{"a", "b", "c"}},
+		{"Language is case insensitive", "go", "", []string{"a", "c"}},
+		{"Severity", "", "warning", []string{"b"}},
+		{"Missing severity defaults to hint", "", "hint", []string{"c"}},
+		{"Both", "go", "error", []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			for _, rule := range ruleInfos(docs, "", tt.language, tt.severity) {
+				ids = append(ids, rule.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestListRulesHandler(t *testing.T) {
+	projectRoot := writeSarifTestProject(t)
+	// A duplicate of an existing rule under another file
+	os.WriteFile(filepath.Join(projectRoot, "more-rules", "panic.yml"), []byte("id: no-panic\nlanguage: go\nrule:\n  pattern: panic($$$)\n"), 0644)
+
+	s := NewServer(Options{ProjectRoot: projectRoot})
+
+	req := mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Arguments: map[string]interface{}{"severity": "error"},
+		},
+	}
+	result, err := s.listRulesHandler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error from handler, got: %v", err)
+	}
+
+	var list RuleList
+	if err := json.Unmarshal([]byte(toolResultText(t, result)), &list); err != nil {
+		t.Fatalf("Expected JSON output, got: %v", err)
+	}
+	if len(list.Rules) != 1 || list.Rules[0].ID != "no-panic" {
+		t.Errorf("Expected only the error rule, got %+v", list.Rules)
+	}
+	if len(list.Diagnostics) != 1 || !strings.Contains(list.Diagnostics[0].Message, "more than once") {
+		t.Errorf("Expected the duplicate rule to be reported, got %+v", list.Diagnostics)
+	}
+}
+
+func TestGetRuleHandler(t *testing.T) {
+	projectRoot := writeSarifTestProject(t)
+
+	s := NewServer(Options{ProjectRoot: projectRoot})
+
+	t.Run("Rule sharing a file", func(t *testing.T) {
+		req := mcp.CallToolRequest{
+			Params: mcp.CallToolParams{
+				Arguments: map[string]interface{}{"rule_id": "no-panic"},
+			},
+		}
+		result, _ := s.getRuleHandler(context.Background(), req)
+		text := toolResultText(t, result)
+		if !strings.Contains(text, "rules/no-fmt-println.yml") || !strings.Contains(text, "pattern: panic($$$)") {
+			t.Errorf("Expected the rule YAML, got:\n%s", text)
+		}
+		if strings.Contains(text, "fmt.Println") {
+			t.Errorf("Expected only the requested rule, got:\n%s", text)
+		}
+	})
+
+	t.Run("Rule with its own file", func(t *testing.T) {
+		req := mcp.CallToolRequest{
+			Params: mcp.CallToolParams{
+				Arguments: map[string]interface{}{"rule_id": "no-todo"},
+			},
+		}
+		result, _ := s.getRuleHandler(context.Background(), req)
+		if text := toolResultText(t, result); !strings.Contains(text, "message: Resolve TODOs\nseverity: hint\n") {
+			t.Errorf("Expected the file content, got:\n%s", text)
+		}
+	})
+
+	t.Run("Unknown rule", func(t *testing.T) {
+		req := mcp.CallToolRequest{
+			Params: mcp.CallToolParams{
+				Arguments: map[string]interface{}{"rule_id": "missing"},
+			},
+		}
+		result, _ := s.getRuleHandler(context.Background(), req)
+		if text := toolResultText(t, result); !strings.Contains(text, "not found") {
+			t.Errorf("Expected not found message, got: %s", text)
+		}
+	})
+}
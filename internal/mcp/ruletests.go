@@ -0,0 +1,324 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultRuleTestDir is the test directory registered in sgconfig.yml when none is configured
+const defaultRuleTestDir = "rule-tests"
+
+// ruleTestCase is an ast-grep rule test file
+type ruleTestCase struct {
+	ID      string   `yaml:"id"`
+	Valid   []string `yaml:"valid,omitempty"`
+	Invalid []string `yaml:"invalid,omitempty"`
+}
+
+// RuleTestFailure is a single failed test case
+type RuleTestFailure struct {
+	// Kind is ast-grep's failure category, such as Noisy (a valid example was reported)
+	// or Missing (an invalid example was not reported)
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+// RuleTestResult is the outcome of the test cases of one rule
+type RuleTestResult struct {
+	ID       string            `json:"id"`
+	Passed   bool              `json:"passed"`
+	Failures []RuleTestFailure `json:"failures,omitempty"`
+}
+
+// RuleTestReport is the document returned by the run_rule_tests tool
+type RuleTestReport struct {
+	Passed      int              `json:"passed"`
+	Failed      int              `json:"failed"`
+	Rules       []RuleTestResult `json:"rules"`
+	Diagnostics []Diagnostic     `json:"diagnostics"`
+}
+
+var (
+	// ruleTestSummaryPattern matches the per-rule summary lines of `ast-grep test`
+	ruleTestSummaryPattern = regexp.MustCompile(`^(PASS|FAIL)\s+(\S+)`)
+	// ruleTestFailurePattern matches the header of a failure detail: [Noisy] Expect ...
+	ruleTestFailurePattern = regexp.MustCompile(`^\[(\w+)\]\s+(.*)$`)
+	// ruleTestFailureIDPattern extracts the rule id from a failure message: Expect rule <id> to
+	// report issues, Expect <id> to report no issue, or Fail to apply fix to <id>
+	ruleTestFailureIDPattern = regexp.MustCompile(`(?:Expect (?:rule )?(\S+?):? (?:to|report)|Fail to apply fix to (\S+?)\.?$)`)
+)
+
+// ruleTestFileName is the file the test cases of a rule are written to
+func ruleTestFileName(ruleID string) string {
+	return ruleID + "-test.yml"
+}
+
+// ruleTestDir returns the first test directory configured in the given sgconfig.yml. When none is
+// configured and create is set, a rule-tests directory next to the first rule directory is
+// registered under testConfigs.
+func ruleTestDir(sgconfigPath string, create bool) (string, error) {
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		return "", err
+	}
+
+	configDir := filepath.Dir(sgconfigPath)
+	for _, testConfig := range config.TestConfigs {
+		if dir := strings.TrimSpace(testConfig.TestDir); dir != "" {
+			return filepath.Join(configDir, dir), nil
+		}
+	}
+
+	if !create {
+		return "", fmt.Errorf("no testConfigs configured in %s", filepath.Base(sgconfigPath))
+	}
+
+	testDir := defaultRuleTestDir
+	if len(config.RuleDirs) > 0 {
+		testDir = filepath.ToSlash(filepath.Join(filepath.Dir(strings.TrimSpace(config.RuleDirs[0])), defaultRuleTestDir))
+	}
+
+	data, err := os.ReadFile(sgconfigPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %v", sgconfigPath, err)
+	}
+	data, err = registerTestDir(data, testDir)
+	if err != nil {
+		return "", fmt.Errorf("could not register a test directory in %s: %v", filepath.Base(sgconfigPath), err)
+	}
+	if err := os.WriteFile(sgconfigPath, data, 0644); err != nil {
+		return "", fmt.Errorf("error updating %s: %v", sgconfigPath, err)
+	}
+
+	return filepath.Join(configDir, testDir), nil
+}
+
+// registerTestDir returns the sgconfig.yml content data with testDir set as the test directory
+// of its first testConfigs entry
+func registerTestDir(data []byte, testDir string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var testConfigs *yaml.Node
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		testConfigs = mappingEntry(doc.Content[0], "testConfigs")
+	}
+
+	// Append rather than re-encode so comments and formatting in sgconfig.yml are kept
+	if testConfigs == nil {
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		return append(data, fmt.Sprintf("testConfigs:\n  - testDir: %s\n", testDir)...), nil
+	}
+
+	// A second testConfigs key would make the file invalid, so the existing one is filled in
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "testDir"}
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: testDir}
+	switch {
+	case testConfigs.Kind == yaml.SequenceNode && len(testConfigs.Content) > 0:
+		entry := testConfigs.Content[0]
+		if entry.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("testConfigs entries must be mappings; set testDir in the first one")
+		}
+		if existing := mappingEntry(entry, "testDir"); existing != nil {
+			*existing = *value
+		} else {
+			entry.Content = append(entry.Content, key, value)
+		}
+	case testConfigs.Kind == yaml.SequenceNode || testConfigs.Tag == "!!null":
+		*testConfigs = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{
+			{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{key, value}},
+		}}
+	default:
+		return nil, fmt.Errorf("testConfigs must be a list; set testDir in it")
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeRuleTestCase writes the valid and invalid examples of a rule as an ast-grep test file
+func writeRuleTestCase(testDir, ruleID string, valid, invalid []string) (string, error) {
+	if err := os.MkdirAll(testDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating test directory: %v", err)
+	}
+
+	data, err := yaml.Marshal(ruleTestCase{ID: ruleID, Valid: valid, Invalid: invalid})
+	if err != nil {
+		return "", fmt.Errorf("error encoding test cases: %v", err)
+	}
+
+	testFile := filepath.Join(testDir, ruleTestFileName(ruleID))
+	if err := os.WriteFile(testFile, data, 0644); err != nil {
+		return "", fmt.Errorf("error writing test file: %v", err)
+	}
+	return testFile, nil
+}
+
+// parseRuleTestOutput reads the human-readable report of `ast-grep test`. Failure details that
+// cannot be attributed to a rule of the summary are returned as diagnostics rather than dropped.
+func parseRuleTestOutput(output string) ([]RuleTestResult, []Diagnostic) {
+	var results []RuleTestResult
+	var diagnostics []Diagnostic
+	index := make(map[string]int)
+	var current *RuleTestFailure
+	var currentID string
+	var code []string
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Code = strings.TrimRight(strings.TrimLeft(strings.Join(code, "\n"), "\n"), "\n ")
+		if i, ok := index[currentID]; ok {
+			results[i].Failures = append(results[i].Failures, *current)
+		} else {
+			message := fmt.Sprintf("rule test failure not attributed to any rule: [%s] %s", current.Kind, current.Message)
+			if current.Code != "" {
+				message += "\n" + current.Code
+			}
+			diagnostics = append(diagnostics, Diagnostic{Level: DiagnosticWarning, Source: "ast-grep", Message: message})
+		}
+		current, code = nil, nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(ansiEscapePattern.ReplaceAllString(output, "")))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if match := ruleTestSummaryPattern.FindStringSubmatch(trimmed); match != nil {
+			flush()
+			if _, ok := index[match[2]]; !ok {
+				index[match[2]] = len(results)
+				results = append(results, RuleTestResult{ID: match[2], Passed: match[1] == "PASS"})
+			}
+			continue
+		}
+
+		if match := ruleTestFailurePattern.FindStringSubmatch(trimmed); match != nil {
+			flush()
+			current = &RuleTestFailure{Kind: match[1], Message: match[2]}
+			currentID = ""
+			if idMatch := ruleTestFailureIDPattern.FindStringSubmatch(match[2]); idMatch != nil {
+				currentID = idMatch[1] + idMatch[2]
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "test result:") || strings.HasPrefix(trimmed, "-----") {
+			flush()
+			continue
+		}
+
+		if current != nil {
+			code = append(code, strings.TrimPrefix(line, "  "))
+		}
+	}
+	flush()
+
+	return results, diagnostics
+}
+
+// runRuleTestsHandler handles the run_rule_tests tool
+func (s *Server) runRuleTestsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var ruleIDs []string
+	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
+		if ids, ok := args["rule_ids"].(string); ok {
+			ruleIDs = splitCommaList(ids)
+		}
+	}
+
+	projectRoot, sgconfigPath, errResult := s.ruleSetFromRequest(req)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	if _, err := ruleTestDir(sgconfigPath, false); err != nil {
+		return mcp.NewToolResultText(fmt.Sprintf("No rule tests found: %v. Add valid_examples or invalid_examples with add_or_update_rule to create them.", err)), nil
+	}
+
+	sgPath, err := s.findAstGrepBinary()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error finding ast-grep binary: %v", err)), nil
+	}
+
+	args := []string{"test", "--config", sgconfigPath, "--skip-snapshot-tests"}
+	if len(ruleIDs) > 0 {
+		quoted := make([]string, len(ruleIDs))
+		for i, id := range ruleIDs {
+			quoted[i] = regexp.QuoteMeta(id)
+		}
+		args = append(args, "--filter", "^("+strings.Join(quoted, "|")+")$")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, sgPath, args...)
+	cmd.WaitDelay = subprocessWaitDelay
+	cmd.Dir = projectRoot
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	s.logger.Debug("Running rule tests", "command", cmd.String())
+
+	// ast-grep exits with an error when a test fails, so the exit status alone means little
+	runErr := cmd.Run()
+	if err := ctx.Err(); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: the rule tests %s before they finished", cancelReason(err))), nil
+	}
+
+	rules, diagnostics := parseRuleTestOutput(stdout.String())
+	report := RuleTestReport{
+		Rules:       rules,
+		Diagnostics: append([]Diagnostic{}, diagnostics...),
+	}
+	if report.Rules == nil {
+		report.Rules = []RuleTestResult{}
+	}
+	for _, result := range report.Rules {
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+
+	if msg := strings.TrimSpace(ansiEscapePattern.ReplaceAllString(stderr.String(), "")); msg != "" {
+		report.Diagnostics = append(report.Diagnostics, Diagnostic{Level: DiagnosticWarning, Source: "ast-grep", Message: msg})
+	}
+	if runErr != nil && report.Failed == 0 {
+		report.Diagnostics = append(report.Diagnostics, Diagnostic{
+			Level:   DiagnosticError,
+			Source:  "ast-grep",
+			Message: fmt.Sprintf("ast-grep test failed: %v", runErr),
+		})
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error encoding test results: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
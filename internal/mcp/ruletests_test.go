@@ -0,0 +1,288 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+const sampleRuleTestOutput = `Running 3 tests
+PASS no-todo  ...
+FAIL no-fmt-println  ..N.M
+FAIL no-panic  .M
+----------- Failure Details -----------
+[Noisy] Expect no-fmt-println to report no issue, but some issues found in:
+
+  log.Println(fmt.Sprint(x))
+
+[Missing] Expect rule no-fmt-println to report issues, but none found in:
+
+  fmt.Println("a")
+  fmt.Println("b")
+
+[Missing] Expect rule no-panic to report issues, but none found in:
+
+  panic(err)
+
+test result: failed. 1 passed; 2 failed;
+`
+
+func TestParseRuleTestOutput(t *testing.T) {
+	results, diagnostics := parseRuleTestOutput(sampleRuleTestOutput)
+
+	if len(diagnostics) != 0 {
+		t.Errorf("Expected every failure to be attributed, got %+v", diagnostics)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 rules, got %+v", results)
+	}
+	if results[0].ID != "no-todo" || !results[0].Passed || len(results[0].Failures) != 0 {
+		t.Errorf("Unexpected result for the passing rule: %+v", results[0])
+	}
+
+	fmtRule := results[1]
+	if fmtRule.ID != "no-fmt-println" || fmtRule.Passed || len(fmtRule.Failures) != 2 {
+		t.Fatalf("Unexpected result for no-fmt-println: %+v", fmtRule)
+	}
+	if fmtRule.Failures[0].Kind != "Noisy" || fmtRule.Failures[0].Code != "log.Println(fmt.Sprint(x))" {
+		t.Errorf("Unexpected noisy failure: %+v", fmtRule.Failures[0])
+	}
+	if fmtRule.Failures[1].Kind != "Missing" || fmtRule.Failures[1].Code != "fmt.Println(\"a\")\nfmt.Println(\"b\")" {
+		t.Errorf("Unexpected missing failure: %+v", fmtRule.Failures[1])
+	}
+
+	if len(results[2].Failures) != 1 || results[2].Failures[0].Code != "panic(err)" {
+		t.Errorf("Unexpected result for no-panic: %+v", results[2])
+	}
+}
+
+func TestParseRuleTestOutputReport(t *testing.T) {
+	// The report as ast-grep 0.39 prints it to a terminal, colours included
+	data, err := os.ReadFile(filepath.Join("testdata", "ast-grep-test-report.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read the report: %v", err)
+	}
+	results, diagnostics := parseRuleTestOutput(string(data))
+
+	if len(results) != 3 || len(diagnostics) != 0 {
+		t.Fatalf("Expected 3 rules and no diagnostics, got %+v and %+v", results, diagnostics)
+	}
+	if results[0].ID != "no-todo" || !results[0].Passed {
+		t.Errorf("Unexpected result for the passing rule: %+v", results[0])
+	}
+	if fmtRule := results[1]; fmtRule.ID != "no-fmt-println" || fmtRule.Passed || len(fmtRule.Failures) != 2 || fmtRule.Failures[0].Code != "log.Println(fmt.Println(x))" {
+		t.Errorf("Unexpected result for no-fmt-println: %+v", fmtRule)
+	}
+	if results[2].ID != "no-panic" || len(results[2].Failures) != 1 || results[2].Failures[0].Kind != "Missing" {
+		t.Errorf("Unexpected result for no-panic: %+v", results[2])
+	}
+}
+
+func TestParseRuleTestOutputUnattributed(t *testing.T) {
+	output := `Running 2 tests
+FAIL no-panic .M
+FAIL no-todo .E
+----------- Failure Details -----------
+[Missing] Expect rule no-panic to report issues, but none found in:
+
+  panic(err)
+
+[Error] Fail to apply fix to no-todo
+[Broken] Something ast-grep said about a rule in a new way:
+
+  x := 1
+
+test result: failed. 0 passed; 2 failed;
+`
+	results, diagnostics := parseRuleTestOutput(output)
+
+	if len(results) != 2 || len(results[0].Failures) != 1 || len(results[1].Failures) != 1 || results[1].Failures[0].Kind != "Error" {
+		t.Errorf("Expected the attributed failures on their rules, got %+v", results)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Level != DiagnosticWarning || !strings.Contains(diagnostics[0].Message, "[Broken] Something ast-grep said") || !strings.HasSuffix(diagnostics[0].Message, "\nx := 1") {
+		t.Errorf("Expected the unattributed failure as a diagnostic, got %+v", diagnostics)
+	}
+}
+
+func TestRuleTestDir(t *testing.T) {
+	projectRoot := t.TempDir()
+	sgconfigPath := filepath.Join(projectRoot, "sgconfig.yml")
+	// Same content as initialize_ast_grep writes, without a trailing newline
+	os.WriteFile(sgconfigPath, []byte("# project rules\nruleDirs:\n  - rules\n "), 0644)
+
+	if _, err := ruleTestDir(sgconfigPath, false); err == nil {
+		t.Error("Expected an error when no test directory is configured")
+	}
+
+	dir, err := ruleTestDir(sgconfigPath, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if dir != filepath.Join(projectRoot, "rule-tests") {
+		t.Errorf("Expected rule-tests next to the rules, got %s", dir)
+	}
+
+	data, _ := os.ReadFile(sgconfigPath)
+	if !strings.HasPrefix(string(data), "# project rules\n") {
+		t.Errorf("Expected existing content to be kept, got:\n%s", data)
+	}
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		t.Fatalf("Expected the updated sgconfig.yml to parse, got: %v", err)
+	}
+	if len(config.TestConfigs) != 1 || config.TestConfigs[0].TestDir != "rule-tests" || len(config.RuleDirs) != 1 {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+
+	// Registered once, then reused
+	if again, _ := ruleTestDir(sgconfigPath, true); again != dir {
+		t.Errorf("Expected the configured directory to be reused, got %s", again)
+	}
+	if after, _ := os.ReadFile(sgconfigPath); string(after) != string(data) {
+		t.Errorf("Expected sgconfig.yml not to change again, got:\n%s", after)
+	}
+}
+
+func TestRuleTestDirExistingTestConfigs(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		testConfigs string
+		snapshotDir string
+	}{
+		{"Empty list", "testConfigs: []\n", ""},
+		{"No value", "testConfigs:\n", ""},
+		{"Entry without testDir", "testConfigs:\n  - snapshotDir: snapshots\n", "snapshots"},
+		{"Blank testDir", "testConfigs:\n  - testDir: ''\n", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			projectRoot := t.TempDir()
+			sgconfigPath := filepath.Join(projectRoot, "sgconfig.yml")
+			os.WriteFile(sgconfigPath, []byte("ruleDirs:\n  - rules\n"+tt.testConfigs), 0644)
+
+			dir, err := ruleTestDir(sgconfigPath, true)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if dir != filepath.Join(projectRoot, "rule-tests") {
+				t.Errorf("Expected rule-tests next to the rules, got %s", dir)
+			}
+			config, err := readSgConfig(sgconfigPath)
+			if err != nil {
+				data, _ := os.ReadFile(sgconfigPath)
+				t.Fatalf("Expected the updated sgconfig.yml to parse, got: %v\n%s", err, data)
+			}
+			if len(config.TestConfigs) != 1 || config.TestConfigs[0].TestDir != "rule-tests" || config.TestConfigs[0].SnapshotDir != tt.snapshotDir || len(config.RuleDirs) != 1 {
+				t.Errorf("Unexpected config: %+v", config)
+			}
+		})
+	}
+}
+
+func TestWriteRuleTestCase(t *testing.T) {
+	testDir := filepath.Join(t.TempDir(), "rule-tests")
+	valid := []string{"log.Println(x)"}
+	invalid := []string{"fmt.Println(x)", "func f() {\n\tfmt.Println(y)\n}"}
+
+	testFile, err := writeRuleTestCase(testDir, "no-fmt-println", valid, invalid)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if filepath.Base(testFile) != "no-fmt-println-test.yml" {
+		t.Errorf("Unexpected test file name: %s", testFile)
+	}
+
+	data, _ := os.ReadFile(testFile)
+	var testCase ruleTestCase
+	if err := yaml.Unmarshal(data, &testCase); err != nil {
+		t.Fatalf("Expected valid YAML, got: %v", err)
+	}
+	if testCase.ID != "no-fmt-println" || len(testCase.Valid) != 1 || testCase.Invalid[1] != invalid[1] {
+		t.Errorf("Unexpected test case: %+v", testCase)
+	}
+}
+
+func TestRunRuleTestsHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot := t.TempDir()
+	os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n"), 0644)
+	os.MkdirAll(filepath.Join(projectRoot, "rules"), 0755)
+
+	toolDir := t.TempDir()
+	argsFile := filepath.Join(toolDir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\ncat <<'EOF'\n" + sampleRuleTestOutput + "EOF\nexit 1\n"
+
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: writeFakeAstGrep(t, toolDir, script)})
+
+	t.Run("No tests configured", func(t *testing.T) {
+		result, _ := s.runRuleTestsHandler(context.Background(), mcp.CallToolRequest{})
+		if text := toolResultText(t, result); !strings.Contains(text, "No rule tests found") {
+			t.Errorf("Expected a hint about adding tests, got: %s", text)
+		}
+	})
+
+	t.Run("Add rule with examples", func(t *testing.T) {
+		// The test-run fake exits with an error, which rule validation would treat as a rejection
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: writeFakeAstGrep(t, t.TempDir(), "#!/bin/sh\necho '[]'\n")})
+
+		req := mcp.CallToolRequest{
+			Params: mcp.CallToolParams{
+				Arguments: map[string]interface{}{
+					"rule_id":          "no-fmt-println",
+					"rule_yaml":        "id: no-fmt-println\nlanguage: go\nrule:\n  pattern: fmt.Println($$$)\n",
+					"valid_examples":   []interface{}{"log.Println(x)"},
+					"invalid_examples": []interface{}{"fmt.Println(x)"},
+				},
+			},
+		}
+		result, _ := s.addOrUpdateRuleHandler(context.Background(), req)
+		if result.IsError {
+			t.Fatalf("Expected rule to be added, got: %s", toolResultText(t, result))
+		}
+		if _, err := os.Stat(filepath.Join(projectRoot, "rule-tests", "no-fmt-println-test.yml")); err != nil {
+			t.Errorf("Expected the test case to be written: %v", err)
+		}
+	})
+
+	t.Run("Run filtered tests", func(t *testing.T) {
+		req := mcp.CallToolRequest{
+			Params: mcp.CallToolParams{
+				Arguments: map[string]interface{}{"rule_ids": "no-fmt-println, no-panic"},
+			},
+		}
+		result, _ := s.runRuleTestsHandler(context.Background(), req)
+
+		var report RuleTestReport
+		if err := json.Unmarshal([]byte(toolResultText(t, result)), &report); err != nil {
+			t.Fatalf("Expected JSON output, got: %v", err)
+		}
+		if report.Passed != 1 || report.Failed != 2 || len(report.Diagnostics) != 0 {
+			t.Errorf("Unexpected report: %+v", report)
+		}
+
+		args, _ := os.ReadFile(argsFile)
+		if !strings.Contains(string(args), "--skip-snapshot-tests") || !strings.Contains(string(args), "--filter ^(no-fmt-println|no-panic)$") {
+			t.Errorf("Unexpected ast-grep arguments: %s", args)
+		}
+	})
+
+	t.Run("Removing the rule removes its tests", func(t *testing.T) {
+		req := mcp.CallToolRequest{
+			Params: mcp.CallToolParams{
+				Arguments: map[string]interface{}{"rule_id": "no-fmt-println"},
+			},
+		}
+		s.removeRuleHandler(context.Background(), req)
+		if _, err := os.Stat(filepath.Join(projectRoot, "rule-tests", "no-fmt-println-test.yml")); !os.IsNotExist(err) {
+			t.Error("Expected the test case to be removed with the rule")
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Supported values of the output_format argument of scan_path
+const (
+	outputFormatJSON  = "json"
+	outputFormatSARIF = "sarif"
+)
+
+const (
+	sarifVersion   = "2.1.0"
+	sarifSchemaURI = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifSrcRoot   = "%SRCROOT%"
+	// sarifFingerprintKey names the partial fingerprint carrying the baseline fingerprint of a finding
+	sarifFingerprintKey = "contextSherpa/v1"
+	toolInformationURI  = "https://github.com/hackafterdark/context-sherpa"
+)
+
+// ruleMetadata is the subset of an ast-grep rule file used to describe rules in reports
+type ruleMetadata struct {
+	ID       string `yaml:"id"`
+	Language string `yaml:"language"`
+	Message  string `yaml:"message"`
+	Severity string `yaml:"severity"`
+	Note     string `yaml:"note"`
+	URL      string `yaml:"url"`
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+	Invocations        []sarifInvocation                `json:"invocations"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string                 `json:"id"`
+	ShortDescription     *sarifMessage          `json:"shortDescription,omitempty"`
+	Help                 *sarifMessage          `json:"help,omitempty"`
+	HelpURI              string                 `json:"helpUri,omitempty"`
+	DefaultConfiguration sarifReportingConfig   `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifReportingConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int           `json:"startLine"`
+	StartColumn int           `json:"startColumn"`
+	EndLine     int           `json:"endLine"`
+	EndColumn   int           `json:"endColumn"`
+	Snippet     *sarifMessage `json:"snippet,omitempty"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+// outputFormatFromRequest reads and validates the output_format argument
+func outputFormatFromRequest(req mcp.CallToolRequest) (string, error) {
+	format := outputFormatJSON
+	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
+		if f, ok := args["output_format"].(string); ok && f != "" {
+			format = strings.ToLower(f)
+		}
+	}
+
+	switch format {
+	case outputFormatJSON, outputFormatSARIF:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported output_format '%s' (supported: '%s', '%s')", format, outputFormatJSON, outputFormatSARIF)
+	}
+}
+
+// loadRuleMetadata reads every rule defined under the ruleDirs declared in the given sgconfig.yml.
+// Rules that can be read are returned even when some rule files are malformed.
+func loadRuleMetadata(sgconfigPath string) (map[string]ruleMetadata, error) {
+	docs, problems, err := loadRuleDocuments(sgconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string]ruleMetadata, len(docs))
+	for _, doc := range docs {
+		rules[doc.ID] = doc.ruleMetadata
+	}
+	if len(problems) > 0 {
+		return rules, fmt.Errorf("%s: %s", problems[0].File, problems[0].Message)
+	}
+	return rules, nil
+}
+
+// sarifLevel maps an ast-grep severity onto a SARIF result level
+func sarifLevel(severity string) string {
+	switch strings.ToLower(severity) {
+	case "error":
+		return "error"
+	case "warning":
+		return "warning"
+	case "off":
+		return "none"
+	default: // info, hint
+		return "note"
+	}
+}
+
+// sarifArtifactURI converts a finding file path into a SARIF artifact location
+func sarifArtifactURI(file string) sarifArtifactLocation {
+	if filepath.IsAbs(file) {
+		return sarifArtifactLocation{URI: (&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String()}
+	}
+	return sarifArtifactLocation{URI: (&url.URL{Path: file}).String(), URIBaseID: sarifSrcRoot}
+}
+
+// toSARIF converts a scan result into a SARIF 2.1.0 log with a single run
+func toSARIF(result *ScanResult, rules map[string]ruleMetadata, projectRoot string) *sarifLog {
+	// Describe every configured rule, plus any rule id reported without a local rule file
+	ruleIDs := make([]string, 0, len(rules))
+	for id := range rules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	for _, finding := range result.Findings {
+		if _, ok := rules[finding.RuleID]; !ok {
+			rules[finding.RuleID] = ruleMetadata{ID: finding.RuleID, Severity: finding.Severity}
+			ruleIDs = append(ruleIDs, finding.RuleID)
+		}
+	}
+	sort.Strings(ruleIDs)
+
+	ruleIndex := make(map[string]int, len(ruleIDs))
+	sarifRules := make([]sarifRule, 0, len(ruleIDs))
+	for i, id := range ruleIDs {
+		meta := rules[id]
+		ruleIndex[id] = i
+
+		rule := sarifRule{
+			ID:                   id,
+			HelpURI:              meta.URL,
+			DefaultConfiguration: sarifReportingConfig{Level: sarifLevel(meta.Severity)},
+		}
+		if meta.Message != "" {
+			rule.ShortDescription = &sarifMessage{Text: meta.Message}
+		}
+		if meta.Note != "" {
+			rule.Help = &sarifMessage{Text: meta.Note}
+		}
+		if meta.Language != "" {
+			rule.Properties = map[string]interface{}{"language": meta.Language}
+		}
+		sarifRules = append(sarifRules, rule)
+	}
+
+	results := make([]sarifResult, 0, len(result.Findings))
+	for _, finding := range result.Findings {
+		message := finding.Message
+		if message == "" {
+			message = rules[finding.RuleID].Message
+		}
+		if message == "" {
+			message = finding.RuleID
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    finding.RuleID,
+			RuleIndex: ruleIndex[finding.RuleID],
+			Level:     sarifLevel(finding.Severity),
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactURI(finding.File),
+					Region: &sarifRegion{
+						StartLine:   finding.StartLine,
+						StartColumn: finding.StartColumn,
+						EndLine:     finding.EndLine,
+						EndColumn:   finding.EndColumn,
+						Snippet:     &sarifMessage{Text: finding.Text},
+					},
+				},
+			}},
+			PartialFingerprints: map[string]string{sarifFingerprintKey: findingFingerprint(finding)},
+		})
+	}
+
+	invocation := sarifInvocation{ExecutionSuccessful: true}
+	for _, diagnostic := range result.Diagnostics {
+		notification := sarifNotification{
+			Level:   sarifLevel(diagnostic.Level),
+			Message: sarifMessage{Text: fmt.Sprintf("%s: %s", diagnostic.Source, diagnostic.Message)},
+		}
+		if diagnostic.File != "" {
+			notification.Locations = []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactURI(diagnostic.File)},
+			}}
+		}
+		if diagnostic.Level == DiagnosticError {
+			invocation.ExecutionSuccessful = false
+		}
+		invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, notification)
+	}
+
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "context-sherpa",
+			Version:        serverVersion,
+			InformationURI: toolInformationURI,
+			Rules:          sarifRules,
+		}},
+		Results:     results,
+		Invocations: []sarifInvocation{invocation},
+	}
+	if projectRoot != "" {
+		rootURI := (&url.URL{Scheme: "file", Path: filepath.ToSlash(projectRoot) + "/"}).String()
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLocation{sarifSrcRoot: {URI: rootURI}}
+	}
+
+	return &sarifLog{
+		Schema:  sarifSchemaURI,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}
+}
+
+// sarifToolResult converts a scan result into a SARIF tool result, using the rules declared
+// in the given sgconfig.yml files for rule metadata
+func sarifToolResult(result *ScanResult, sgconfigPaths []string, projectRoot string) *mcp.CallToolResult {
+	rules := make(map[string]ruleMetadata)
+	for _, sgconfigPath := range sgconfigPaths {
+		configRules, err := loadRuleMetadata(sgconfigPath)
+		if err != nil {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{
+				Level:   DiagnosticWarning,
+				Source:  "context-sherpa",
+				Message: fmt.Sprintf("rule metadata unavailable: %v", err),
+			})
+		}
+		// A rule id defined by several sub-projects is described by the first
+		for id, rule := range configRules {
+			if _, ok := rules[id]; !ok {
+				rules[id] = rule
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(toSARIF(result, rules, projectRoot), "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error encoding SARIF: %v", err))
+	}
+	toolResult := mcp.NewToolResultText(string(data))
+	// A partial scan is still returned, but flagged so it is not mistaken for a clean one
+	toolResult.IsError = len(result.Unscanned) > 0
+	return toolResult
+}
@@ -0,0 +1,162 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func writeSarifTestProject(t *testing.T) string {
+	t.Helper()
+	projectRoot := t.TempDir()
+
+	os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n  - more-rules\n"), 0644)
+	os.MkdirAll(filepath.Join(projectRoot, "rules"), 0755)
+	os.MkdirAll(filepath.Join(projectRoot, "more-rules", "nested"), 0755)
+
+	os.WriteFile(filepath.Join(projectRoot, "rules", "no-fmt-println.yml"), []byte(`id: no-fmt-println
+language: go
+message: Avoid fmt.Println
+severity: warning
+note: Use the structured logger instead.
+url: https://example.com/rules/no-fmt-println
+rule:
+  pattern: fmt.Println($$$)
+---
+id: no-panic
+language: go
+message: Do not panic
+severity: error
+rule:
+  pattern: panic($$$)
+`), 0644)
+	os.WriteFile(filepath.Join(projectRoot, "more-rules", "nested", "todo.yaml"), []byte(`id: no-todo
+language: go
+message: Resolve TODOs
+severity: hint
+rule:
+  pattern: TODO
+`), 0644)
+
+	return projectRoot
+}
+
+func TestLoadRuleMetadata(t *testing.T) {
+	projectRoot := writeSarifTestProject(t)
+
+	rules, err := loadRuleMetadata(filepath.Join(projectRoot, "sgconfig.yml"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules from all ruleDirs and documents, got %d", len(rules))
+	}
+	if rules["no-fmt-println"].URL != "https://example.com/rules/no-fmt-println" {
+		t.Errorf("Expected url to be read, got '%s'", rules["no-fmt-println"].URL)
+	}
+	if rules["no-todo"].Severity != "hint" {
+		t.Errorf("Expected nested rule to be read, got %+v", rules["no-todo"])
+	}
+}
+
+func TestToSARIF(t *testing.T) {
+	projectRoot := writeSarifTestProject(t)
+	rules, _ := loadRuleMetadata(filepath.Join(projectRoot, "sgconfig.yml"))
+
+	result := newScanResult([]Finding{
+		{RuleID: "no-fmt-println", Severity: "warning", Message: "Avoid fmt.Println", File: "cmd/main go.go", StartLine: 3, StartColumn: 2, EndLine: 3, EndColumn: 20, Text: "fmt.Println()"},
+		{RuleID: "unknown-rule", Severity: "info", File: "pkg/a.go", StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 5, Text: "x"},
+	}, []Diagnostic{
+		{Level: DiagnosticWarning, Source: "ast-grep", Message: "noisy"},
+	})
+
+	log := toSARIF(result, rules, projectRoot)
+
+	if log.Version != sarifVersion || len(log.Runs) != 1 {
+		t.Fatalf("Expected a single SARIF %s run, got version %s with %d runs", sarifVersion, log.Version, len(log.Runs))
+	}
+
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 4 {
+		t.Fatalf("Expected 4 rules (3 configured + 1 unknown), got %d", len(run.Tool.Driver.Rules))
+	}
+
+	first := run.Results[0]
+	rule := run.Tool.Driver.Rules[first.RuleIndex]
+	if rule.ID != "no-fmt-println" {
+		t.Errorf("Expected ruleIndex to point at no-fmt-println, got %s", rule.ID)
+	}
+	if rule.HelpURI != "https://example.com/rules/no-fmt-println" || rule.Help == nil || rule.ShortDescription == nil {
+		t.Errorf("Expected rule metadata to be populated, got %+v", rule)
+	}
+	if first.Level != "warning" {
+		t.Errorf("Expected level 'warning', got '%s'", first.Level)
+	}
+
+	location := first.Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "cmd/main%20go.go" || location.ArtifactLocation.URIBaseID != sarifSrcRoot {
+		t.Errorf("Unexpected artifact location: %+v", location.ArtifactLocation)
+	}
+	if location.Region.StartLine != 3 || location.Region.EndColumn != 20 {
+		t.Errorf("Unexpected region: %+v", location.Region)
+	}
+	if first.PartialFingerprints[sarifFingerprintKey] == "" {
+		t.Error("Expected a partial fingerprint")
+	}
+
+	second := run.Results[1]
+	if second.Level != "note" || second.Message.Text != "unknown-rule" {
+		t.Errorf("Expected info finding without message to fall back to the rule id, got %+v", second)
+	}
+
+	if len(run.Invocations[0].ToolExecutionNotifications) != 1 {
+		t.Error("Expected diagnostics to be reported as tool execution notifications")
+	}
+}
+
+func TestOutputFormatFromRequest(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+		wantErr  bool
+	}{
+		{nil, outputFormatJSON, false},
+		{"SARIF", outputFormatSARIF, false},
+		{"json", outputFormatJSON, false},
+		{"xml", "", true},
+	}
+
+	for _, tt := range tests {
+		args := map[string]interface{}{}
+		if tt.value != nil {
+			args["output_format"] = tt.value
+		}
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: args}}
+
+		format, err := outputFormatFromRequest(req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("outputFormatFromRequest(%v) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if format != tt.expected {
+			t.Errorf("outputFormatFromRequest(%v) = %s, expected %s", tt.value, format, tt.expected)
+		}
+	}
+}
+
+func TestSarifToolResultIsValidJSON(t *testing.T) {
+	projectRoot := writeSarifTestProject(t)
+
+	result := sarifToolResult(newScanResult(nil, nil), []string{filepath.Join(projectRoot, "sgconfig.yml")}, projectRoot)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(toolResultText(t, result)), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v", err)
+	}
+	if decoded["$schema"] != sarifSchemaURI {
+		t.Errorf("Expected $schema to be set, got %v", decoded["$schema"])
+	}
+}
@@ -0,0 +1,565 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SymbolLocation is a source range returned by the semantic query tools.
+// Lines and columns are 1-based, like those of findings.
+type SymbolLocation struct {
+	// File is relative to the project root when it lies inside it
+	File        string `json:"file"`
+	StartLine   int    `json:"start_line"`
+	StartColumn int    `json:"start_column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+	// Signature is the declaration of a definition, without its body or doc comment
+	Signature string `json:"signature,omitempty"`
+	// Text is the source line of a reference
+	Text string `json:"text,omitempty"`
+}
+
+// DefinitionResult is the document returned by the get_definition tool
+type DefinitionResult struct {
+	Definitions []SymbolLocation `json:"definitions"`
+}
+
+// TypeInfo is the document returned by the get_type_info tool
+type TypeInfo struct {
+	// Type is the declaration gopls shows for the symbol, e.g. "func Open(name string) (*File, error)"
+	Type string `json:"type"`
+	// Documentation is the symbol's doc comment, as markdown
+	Documentation string `json:"documentation,omitempty"`
+	// Range is the symbol the information is about, when the language server reports it
+	Range *SymbolLocation `json:"range,omitempty"`
+}
+
+// ReferenceList is the document returned by the find_references tool
+type ReferenceList struct {
+	References []SymbolLocation `json:"references"`
+}
+
+// findGoplsBinary locates gopls: the configured path, PATH, then the bin directory that
+// 'go install' writes to
+func (s *Server) findGoplsBinary() (string, error) {
+	if s.goplsPath != "" {
+		if _, err := os.Stat(s.goplsPath); err == nil {
+			return s.goplsPath, nil
+		}
+		return "", fmt.Errorf("gopls not found at specified path: %s", s.goplsPath)
+	}
+
+	if path, err := exec.LookPath("gopls"); err == nil {
+		return path, nil
+	}
+
+	name := "gopls"
+	if runtime.GOOS == "windows" {
+		name = "gopls.exe"
+	}
+	path := filepath.Join(build.Default.GOPATH, "bin", name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	return "", fmt.Errorf("gopls not found in PATH. Install it with 'go install golang.org/x/tools/gopls@latest' or pass --goplsPath")
+}
+
+// workspaceRoot is the directory the language server is started in. The semantic tools work
+// without sgconfig.yml, so the configured root or the working directory is used when it is missing.
+func (s *Server) workspaceRoot() (string, error) {
+	if root, err := s.findProjectRoot(); err == nil {
+		return root, nil
+	}
+	if s.projectRoot != "" {
+		return filepath.Abs(s.projectRoot)
+	}
+	return os.Getwd()
+}
+
+// goplsClient returns the running gopls, starting it on first use or after it exited
+func (s *Server) goplsClient(ctx context.Context) (*lspClient, error) {
+	s.goplsMu.Lock()
+	defer s.goplsMu.Unlock()
+
+	if s.gopls != nil && s.gopls.alive() {
+		return s.gopls, nil
+	}
+	if s.gopls != nil {
+		s.logger.Warn("gopls exited, restarting it")
+		s.gopls.close()
+		s.gopls = nil
+	}
+
+	goplsPath, err := s.findGoplsBinary()
+	if err != nil {
+		return nil, err
+	}
+	root, err := s.workspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Starting gopls", "path", goplsPath, "root", root)
+	client, err := startLSPClient(ctx, goplsPath, nil, root, s.logger)
+	if err != nil {
+		return nil, fmt.Errorf("could not start gopls: %v", err)
+	}
+	s.gopls = client
+	return client, nil
+}
+
+// Close stops the language server started by the semantic query tools, if any
+func (s *Server) Close() error {
+	s.goplsMu.Lock()
+	defer s.goplsMu.Unlock()
+
+	if s.gopls == nil {
+		return nil
+	}
+	err := s.gopls.close()
+	s.gopls = nil
+	return err
+}
+
+// semanticQuery is a position in a Go file that a semantic tool asks about
+type semanticQuery struct {
+	client      *lspClient
+	projectRoot string
+	params      lspTextDocumentPositionParams
+}
+
+// semanticQueryFromRequest reads the file_path, line and column arguments, opens the file in
+// gopls and converts the position for LSP. When any of that fails, the tool result describing
+// why is returned instead.
+func (s *Server) semanticQueryFromRequest(ctx context.Context, req mcp.CallToolRequest) (*semanticQuery, *mcp.CallToolResult) {
+	filePath, err := req.RequireString("file_path")
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	line, err := req.RequireInt("line")
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	column, err := req.RequireInt("column")
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	if line < 1 || column < 1 {
+		return nil, mcp.NewToolResultError("line and column are 1-based and must be at least 1")
+	}
+
+	root, err := s.workspaceRoot()
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	path, err := filepath.Abs(resolvePathRelativeToProjectRoot(filePath, root))
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+
+	client, err := s.goplsClient(ctx)
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+
+	text, err := client.syncDocument(path, "go")
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Error reading file: %v", err))
+	}
+	lines := strings.Split(text, "\n")
+	if line > len(lines) {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("line %d is past the end of %s (%d lines)", line, filePath, len(lines)))
+	}
+
+	query := &semanticQuery{client: client, projectRoot: root}
+	query.params.TextDocument.URI = fileURI(path)
+	query.params.Position = lspPosition{Line: line - 1, Character: utf16Offset(lines[line-1], column)}
+	return query, nil
+}
+
+// getDefinitionHandler handles the get_definition tool
+func (s *Server) getDefinitionHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, errResult := s.semanticQueryFromRequest(ctx, req)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	var raw json.RawMessage
+	if err := query.client.call(ctx, "textDocument/definition", query.params, &raw); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("gopls could not find the definition: %v", err)), nil
+	}
+	locations, err := decodeDefinitions(raw)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("gopls could not find the definition: %v", err)), nil
+	}
+
+	result := DefinitionResult{Definitions: []SymbolLocation{}}
+	files := newSourceCache()
+	for _, location := range locations {
+		symbol := files.symbolLocation(location, query.projectRoot)
+		symbol.Signature = files.signature(location)
+		result.Definitions = append(result.Definitions, symbol)
+	}
+	return jsonToolResult(result)
+}
+
+// getTypeInfoHandler handles the get_type_info tool
+func (s *Server) getTypeInfoHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, errResult := s.semanticQueryFromRequest(ctx, req)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	var hover *lspHover
+	if err := query.client.call(ctx, "textDocument/hover", query.params, &hover); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("gopls could not describe the symbol: %v", err)), nil
+	}
+	if hover == nil {
+		return mcp.NewToolResultError("No type information at this position. Point line and column at an identifier."), nil
+	}
+
+	info := TypeInfo{}
+	info.Type, info.Documentation = splitHover(hoverText(hover.Contents))
+	if hover.Range != nil {
+		symbol := newSourceCache().symbolLocation(lspLocation{URI: query.params.TextDocument.URI, Range: *hover.Range}, query.projectRoot)
+		info.Range = &symbol
+	}
+	return jsonToolResult(info)
+}
+
+// findReferencesHandler handles the find_references tool
+func (s *Server) findReferencesHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, errResult := s.semanticQueryFromRequest(ctx, req)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	params := struct {
+		lspTextDocumentPositionParams
+		Context struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}{lspTextDocumentPositionParams: query.params}
+	params.Context.IncludeDeclaration = req.GetBool("include_declaration", true)
+
+	var locations []lspLocation
+	if err := query.client.call(ctx, "textDocument/references", params, &locations); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("gopls could not find references: %v", err)), nil
+	}
+
+	result := ReferenceList{References: []SymbolLocation{}}
+	files := newSourceCache()
+	for _, location := range locations {
+		symbol := files.symbolLocation(location, query.projectRoot)
+		symbol.Text = strings.TrimSpace(files.line(location.URI, location.Range.Start.Line))
+		result.References = append(result.References, symbol)
+	}
+	return jsonToolResult(result)
+}
+
+// jsonToolResult serializes a tool's result document
+func jsonToolResult(v interface{}) (*mcp.CallToolResult, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error encoding result: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+// decodeDefinitions reads a definition result, which may be a Location, a list of Locations
+// or a list of LocationLinks
+func decodeDefinitions(raw json.RawMessage) ([]lspLocation, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] == '{' {
+		raw = append(append([]byte("["), raw...), ']')
+	}
+
+	var entries []struct {
+		lspLocation
+		lspLocationLink
+	}
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("could not decode definition: %v", err)
+	}
+
+	locations := make([]lspLocation, 0, len(entries))
+	for _, entry := range entries {
+		if entry.TargetURI != "" {
+			locations = append(locations, lspLocation{URI: entry.TargetURI, Range: entry.TargetSelectionRange})
+		} else {
+			locations = append(locations, entry.lspLocation)
+		}
+	}
+	return locations, nil
+}
+
+// hoverText extracts the text of hover contents: MarkupContent, a MarkedString or a list of them
+func hoverText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var marked struct {
+		Kind     string `json:"kind"`
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &marked); err == nil {
+		if marked.Language != "" {
+			return "```" + marked.Language + "\n" + marked.Value + "\n```"
+		}
+		return marked.Value
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		var parts []string
+		for _, item := range list {
+			parts = append(parts, hoverText(item))
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
+
+// splitHover separates the first code block of a hover, which holds the declaration, from the
+// documentation around it. Hovers without a code block are all type.
+func splitHover(text string) (typ, documentation string) {
+	start := strings.Index(text, "```")
+	if start < 0 {
+		return strings.TrimSpace(text), ""
+	}
+	bodyStart := strings.Index(text[start:], "\n")
+	if bodyStart < 0 {
+		return strings.TrimSpace(text), ""
+	}
+	bodyStart += start + 1
+	end := strings.Index(text[bodyStart:], "```")
+	if end < 0 {
+		return strings.TrimSpace(text[bodyStart:]), strings.TrimSpace(text[:start])
+	}
+	end += bodyStart
+
+	typ = strings.TrimSpace(text[bodyStart:end])
+	documentation = strings.TrimSpace(text[:start] + text[end+3:])
+	return typ, documentation
+}
+
+// utf16Offset converts a 1-based column counted in characters into an LSP character offset
+func utf16Offset(line string, column int) int {
+	offset := 0
+	for _, r := range line {
+		if column <= 1 {
+			break
+		}
+		offset += len(utf16.Encode([]rune{r}))
+		column--
+	}
+	return offset
+}
+
+// runeColumn converts an LSP character offset into a 1-based column counted in characters
+func runeColumn(line string, character int) int {
+	column := 1
+	for _, r := range line {
+		if character <= 0 {
+			break
+		}
+		character -= len(utf16.Encode([]rune{r}))
+		column++
+	}
+	return column
+}
+
+// sourceCache reads each file referenced by a query result once
+type sourceCache map[string][]string
+
+func newSourceCache() sourceCache {
+	return make(sourceCache)
+}
+
+// lines returns the lines of the file at uri, or nil when it cannot be read
+func (c sourceCache) lines(uri string) []string {
+	if lines, ok := c[uri]; ok {
+		return lines
+	}
+	var lines []string
+	if data, err := os.ReadFile(uriToPath(uri)); err == nil {
+		lines = strings.Split(string(data), "\n")
+	}
+	c[uri] = lines
+	return lines
+}
+
+// line returns one zero-based line of the file at uri
+func (c sourceCache) line(uri string, line int) string {
+	lines := c.lines(uri)
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line], "\r")
+}
+
+// symbolLocation converts an LSP location into 1-based lines and character columns
+func (c sourceCache) symbolLocation(location lspLocation, projectRoot string) SymbolLocation {
+	start, end := location.Range.Start, location.Range.End
+	return SymbolLocation{
+		File:        relativeToProjectRoot(uriToPath(location.URI), projectRoot),
+		StartLine:   start.Line + 1,
+		StartColumn: runeColumn(c.line(location.URI, start.Line), start.Character),
+		EndLine:     end.Line + 1,
+		EndColumn:   runeColumn(c.line(location.URI, end.Line), end.Character),
+	}
+}
+
+// signature returns the declaration of the Go identifier at location, without its body or doc
+// comment. When the identifier is not declared at package or type level, for example a local
+// variable, the source line is returned instead.
+func (c sourceCache) signature(location lspLocation) string {
+	line := c.line(location.URI, location.Range.Start.Line)
+	fallback := strings.TrimSpace(line)
+
+	path := uriToPath(location.URI)
+	if filepath.Ext(path) != ".go" {
+		return fallback
+	}
+	lines := c.lines(location.URI)
+	src := []byte(strings.Join(lines, "\n"))
+
+	// Byte offset of the identifier
+	offset := 0
+	for i := 0; i < location.Range.Start.Line && i < len(lines); i++ {
+		offset += len(lines[i]) + 1
+	}
+	column := runeColumn(line, location.Range.Start.Character)
+	for i := 1; i < column && len(line) > 0; i++ {
+		_, size := utf8.DecodeRuneInString(line)
+		offset += size
+		line = line[size:]
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return fallback
+	}
+	if decl := declarationAt(fset, file, fset.File(file.Pos()).Pos(offset)); decl != "" {
+		return decl
+	}
+	return fallback
+}
+
+// declarationAt prints the declaration naming the identifier at pos: a function or method
+// (without its body), a type, a var or const, or a struct field or interface method.
+// It returns "" when the identifier is declared elsewhere, such as inside a function.
+func declarationAt(fset *token.FileSet, file *ast.File, pos token.Pos) string {
+	var decl ast.Node
+	var field *ast.Field
+	ast.Inspect(file, func(n ast.Node) bool {
+		if decl != nil || field != nil || n == nil || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Name.Pos() == pos {
+				signature := *n
+				signature.Body = nil
+				signature.Doc = nil
+				decl = &signature
+				return false
+			}
+		case *ast.GenDecl:
+			for _, spec := range n.Specs {
+				if specNames(spec, pos) {
+					decl = &ast.GenDecl{Tok: n.Tok, Specs: []ast.Spec{withoutComments(spec)}}
+					return false
+				}
+			}
+		case *ast.Field:
+			for _, name := range n.Names {
+				if name.Pos() == pos {
+					field = n
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	switch {
+	case decl != nil:
+		if err := format.Node(&buf, fset, decl); err != nil {
+			return ""
+		}
+	case field != nil:
+		// Fields are not printable on their own, so print the names and the type
+		var names []string
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		buf.WriteString(strings.Join(names, ", "))
+		if _, isMethod := field.Type.(*ast.FuncType); !isMethod {
+			buf.WriteString(" ")
+		}
+		var typ bytes.Buffer
+		if err := format.Node(&typ, fset, field.Type); err != nil {
+			return ""
+		}
+		// Interface methods print their type as "func(...)", written after the name without it
+		buf.WriteString(strings.TrimPrefix(typ.String(), "func"))
+	}
+	return buf.String()
+}
+
+// specNames reports whether spec declares the identifier at pos
+func specNames(spec ast.Spec, pos token.Pos) bool {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		return spec.Name.Pos() == pos
+	case *ast.ValueSpec:
+		for _, name := range spec.Names {
+			if name.Pos() == pos {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withoutComments copies spec without its doc and line comments
+func withoutComments(spec ast.Spec) ast.Spec {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		copied := *spec
+		copied.Doc, copied.Comment = nil, nil
+		return &copied
+	case *ast.ValueSpec:
+		copied := *spec
+		copied.Doc, copied.Comment = nil, nil
+		return &copied
+	}
+	return spec
+}
@@ -0,0 +1,214 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const semanticSample = `package greet
+
+// Greeter says hello.
+type Greeter struct {
+	// Name is who is greeted
+	Name string
+}
+
+// Greet returns a greeting.
+func (g *Greeter) Greet(punctuation string) string {
+	msg := "Hello, " + g.Name
+	return msg + punctuation
+}
+
+func main() {
+	g := &Greeter{Name: "é"}
+	g.Greet("!")
+}
+`
+
+func TestSemanticTools(t *testing.T) {
+	projectRoot := t.TempDir()
+	file := filepath.Join(projectRoot, "greet.go")
+	os.WriteFile(file, []byte(semanticSample), 0644)
+	uri := fileURI(file)
+
+	// Greet is declared on line 10 (zero-based 9) and called on line 17 (zero-based 16)
+	declaration := fmt.Sprintf(`{"uri":%q,"range":{"start":{"line":9,"character":18},"end":{"line":9,"character":23}}}`, uri)
+	call := fmt.Sprintf(`{"uri":%q,"range":{"start":{"line":16,"character":3},"end":{"line":16,"character":8}}}`, uri)
+	goplsPath, logPath := writeFakeLanguageServer(t, fakeLSPScript{
+		Results: map[string]json.RawMessage{
+			"textDocument/definition": json.RawMessage("[" + declaration + "]"),
+			"textDocument/hover": json.RawMessage(`{
+				"contents": {"kind": "markdown", "value": "` + "```go\\nfunc (g *Greeter) Greet(punctuation string) string\\n```" + `\n\nGreet returns a greeting."},
+				"range": {"start": {"line": 16, "character": 3}, "end": {"line": 16, "character": 8}}
+			}`),
+			"textDocument/references": json.RawMessage("[" + declaration + "," + call + "]"),
+		},
+	})
+
+	s := NewServer(Options{ProjectRoot: projectRoot, GoplsPath: goplsPath})
+	defer s.Close()
+	position := map[string]interface{}{"file_path": "greet.go", "line": 17, "column": 5}
+
+	t.Run("get_definition", func(t *testing.T) {
+		result, err := s.RunTool(context.Background(), "get_definition", position)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var definition DefinitionResult
+		if err := json.Unmarshal([]byte(toolResultText(t, result)), &definition); err != nil {
+			t.Fatalf("Expected a definition document, got: %s", toolResultText(t, result))
+		}
+		expected := SymbolLocation{File: "greet.go", StartLine: 10, StartColumn: 19, EndLine: 10, EndColumn: 24, Signature: "func (g *Greeter) Greet(punctuation string) string"}
+		if len(definition.Definitions) != 1 || definition.Definitions[0] != expected {
+			t.Errorf("Expected %+v, got %+v", expected, definition.Definitions)
+		}
+	})
+
+	t.Run("get_type_info", func(t *testing.T) {
+		result, err := s.RunTool(context.Background(), "get_type_info", position)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var info TypeInfo
+		if err := json.Unmarshal([]byte(toolResultText(t, result)), &info); err != nil {
+			t.Fatalf("Expected a type document, got: %s", toolResultText(t, result))
+		}
+		if info.Type != "func (g *Greeter) Greet(punctuation string) string" || info.Documentation != "Greet returns a greeting." {
+			t.Errorf("Unexpected type info: %+v", info)
+		}
+		if info.Range == nil || info.Range.StartLine != 17 || info.Range.StartColumn != 4 {
+			t.Errorf("Expected the hovered range, got %+v", info.Range)
+		}
+	})
+
+	t.Run("find_references", func(t *testing.T) {
+		result, err := s.RunTool(context.Background(), "find_references", position)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var references ReferenceList
+		if err := json.Unmarshal([]byte(toolResultText(t, result)), &references); err != nil {
+			t.Fatalf("Expected a references document, got: %s", toolResultText(t, result))
+		}
+		if len(references.References) != 2 || references.References[1].Text != `g.Greet("!")` || references.References[1].StartLine != 17 {
+			t.Errorf("Unexpected references: %+v", references.References)
+		}
+	})
+
+	t.Run("Invalid position", func(t *testing.T) {
+		result, err := s.RunTool(context.Background(), "get_definition", map[string]interface{}{"file_path": "greet.go", "line": 99, "column": 1})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !result.IsError || !strings.Contains(toolResultText(t, result), "line 99 is past the end") {
+			t.Errorf("Expected the position to be rejected, got: %s", toolResultText(t, result))
+		}
+	})
+
+	// One long-lived gopls answers every query, and the file is opened once
+	var methods []string
+	for _, msg := range receivedLSPMessages(t, logPath) {
+		methods = append(methods, msg.Method)
+	}
+	if strings.Count(strings.Join(methods, ","), "initialize,") != 1 || strings.Count(strings.Join(methods, ","), "didOpen") != 1 {
+		t.Errorf("Expected gopls to be started and the file opened once, got %v", methods)
+	}
+
+	var params struct {
+		Position lspPosition `json:"position"`
+		Context  struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}
+	for _, msg := range receivedLSPMessages(t, logPath) {
+		if msg.Method == "textDocument/references" {
+			json.Unmarshal(msg.Params, &params)
+		}
+	}
+	if params.Position != (lspPosition{Line: 16, Character: 4}) || !params.Context.IncludeDeclaration {
+		t.Errorf("Expected the zero-based position and includeDeclaration, got %+v", params)
+	}
+}
+
+func TestSemanticToolsWithoutGopls(t *testing.T) {
+	s := NewServer(Options{ProjectRoot: t.TempDir(), GoplsPath: filepath.Join(t.TempDir(), "gopls")})
+	result, err := s.RunTool(context.Background(), "get_type_info", map[string]interface{}{"file_path": "main.go", "line": 1, "column": 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !result.IsError || !strings.Contains(toolResultText(t, result), "gopls not found at specified path") {
+		t.Errorf("Expected the missing gopls to be reported, got: %s", toolResultText(t, result))
+	}
+}
+
+func TestDeclarationAt(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "greet.go", semanticSample, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ident    string
+		expected string
+	}{
+		{"Method", "Greet(punctuation", "func (g *Greeter) Greet(punctuation string) string"},
+		{"Type", "Greeter struct", "type Greeter struct {\n\tName string\n}"},
+		{"Field", "Name string", "Name string"},
+		{"Function", "main()", "func main()"},
+		{"Local variable", "msg :=", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos := fset.File(file.Pos()).Pos(strings.Index(semanticSample, tt.ident))
+			if got := declarationAt(fset, file, pos); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSplitHover(t *testing.T) {
+	typ, doc := splitHover("```go\nvar err error\n```\n\nerr is the failure.")
+	if typ != "var err error" || doc != "err is the failure." {
+		t.Errorf("Unexpected split: %q, %q", typ, doc)
+	}
+
+	typ, doc = splitHover("plain text")
+	if typ != "plain text" || doc != "" {
+		t.Errorf("Expected plain hovers to be all type, got %q, %q", typ, doc)
+	}
+}
+
+func TestHoverText(t *testing.T) {
+	tests := map[string]string{
+		`"plain"`:                                    "plain",
+		`{"kind":"markdown","value":"**bold**"}`:     "**bold**",
+		`{"language":"go","value":"int"}`:            "```go\nint\n```",
+		`["doc", {"language":"go","value":"x int"}]`: "doc\n\n```go\nx int\n```",
+	}
+	for raw, expected := range tests {
+		if got := hoverText(json.RawMessage(raw)); got != expected {
+			t.Errorf("hoverText(%s) = %q, expected %q", raw, got, expected)
+		}
+	}
+}
+
+func TestUTF16Columns(t *testing.T) {
+	// x is the third character, after é (one UTF-16 unit) and 😀 (two)
+	line := "é😀x"
+	if offset := utf16Offset(line, 3); offset != 3 {
+		t.Errorf("Expected UTF-16 offset 3, got %d", offset)
+	}
+	if column := runeColumn(line, 3); column != 3 {
+		t.Errorf("Expected column 3, got %d", column)
+	}
+}
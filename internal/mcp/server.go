@@ -4,26 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"go/token"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/tools/go/analysis"
 	"gopkg.in/yaml.v3"
 )
 
-// SgConfig represents the structure of sgconfig.yml
-type SgConfig struct {
-	RuleDirs []string `yaml:"ruleDirs"`
-}
-
 // CommunityRule represents a rule in the community repository
 type CommunityRule struct {
 	ID          string   `json:"id"`
@@ -49,83 +48,315 @@ type AstGrepRule struct {
 	Rule     struct{} `yaml:"rule"`
 }
 
-// Cache for the community rule index
-var (
+// serverVersion is the version reported to MCP clients and in SARIF output
+const serverVersion = "1.0.0"
+
+// DefaultCommunityIndexURL is the index of the Context Sherpa Community Rules repository
+const DefaultCommunityIndexURL = "https://raw.githubusercontent.com/hackafterdark/context-sherpa-community-rules/main/index.json"
+
+// communityCacheTTL is how long a fetched community rule index is reused
+const communityCacheTTL = 5 * time.Minute
+
+// Options configures a Server. The zero value serves the project containing the current
+// directory with ast-grep from PATH.
+type Options struct {
+	// ProjectRoot is the directory searched (with its parents) for sgconfig.yml.
+	// Defaults to the current working directory.
+	ProjectRoot string
+	// AstGrepPath is an explicit path to the ast-grep binary. Defaults to ast-grep in PATH.
+	AstGrepPath string
+	// GoplsPath is an explicit path to the gopls binary used by the semantic query tools.
+	// Defaults to gopls in PATH or in $GOPATH/bin.
+	GoplsPath string
+	// CommunityIndexURL is the index.json of the community rule registry.
+	// Defaults to DefaultCommunityIndexURL.
+	CommunityIndexURL string
+	// CommunityRulesURL is the base URL the rule paths of the index are resolved against, like
+	// relative links, so a directory URL needs a trailing slash. Defaults to CommunityIndexURL.
+	CommunityRulesURL string
+	// Logger receives the server's logs. Defaults to slog.Default().
+	Logger *slog.Logger
+	// HTTPClient fetches community rules. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Analyzers are run by every scan next to the built-in ast-grep analyzer
+	Analyzers []Analyzer
+	// GoAnalyzers are go/analysis passes offered by the go-analysis analyzer next to the go vet
+	// suite. They run by default unless goAnalysis.analyzers in sgconfig.yml names others.
+	GoAnalyzers []*analysis.Analyzer
+	// DisableScanCache stops ast-grep results being cached in .context-sherpa/ in the project root
+	DisableScanCache bool
+	// ScanBatchSize is the most files passed to one ast-grep run; larger scans are split into
+	// batches. Defaults to 200.
+	ScanBatchSize int
+	// ScanWorkers is the most ast-grep batches run at once. Defaults to the number of CPUs.
+	ScanWorkers int
+	// ToolTimeout bounds every tool call; the subprocesses of a call that runs longer are
+	// killed. Defaults to DefaultToolTimeout, and a negative value means no limit.
+	ToolTimeout time.Duration
+	// ToolTimeouts overrides ToolTimeout for the tools it names; zero or negative means no limit
+	ToolTimeouts map[string]time.Duration
+}
+
+// Server is a context-sherpa instance bound to one project. Servers share no state, so several
+// can run in one process.
+type Server struct {
+	projectRoot       string
+	astGrepPath       string
+	goplsPath         string
+	communityIndexURL string
+	communityRulesURL string
+	logger            *slog.Logger
+	httpClient        *http.Client
+	extraAnalyzers    []Analyzer
+	goAnalyzers       []*analysis.Analyzer
+
+	// Cache for the community rule index
+	communityMu        sync.Mutex
 	communityRuleCache *CommunityRuleIndex
 	cacheTimestamp     time.Time
-	cacheTTL           = 5 * time.Minute // Cache for 5 minutes
-)
 
-var communityRulesRepo = "https://raw.githubusercontent.com/hackafterdark/context-sherpa-community-rules/main/index.json"
+	// scanCacheMu guards the scan cache file and astGrepVersions, the output of ast-grep
+	// --version for each binary
+	disableScanCache bool
+	scanCacheMu      sync.Mutex
+	astGrepVersions  map[string]string
 
-// projectRootOverride stores the custom project root directory when specified via command-line argument
-var projectRootOverride string
+	// scanBatchSize and scanWorkerCount bound the ast-grep runs of a scan; zero means the default
+	scanBatchSize   int
+	scanWorkerCount int
 
-// astGrepPathOverride stores the custom ast-grep binary path when specified via command-line argument
-var astGrepPathOverride string
+	// defaultToolTimeout and toolTimeouts bound tool calls; a negative timeout means no limit
+	defaultToolTimeout time.Duration
+	toolTimeouts       map[string]time.Duration
 
-// Logging configuration
-var (
-	verboseLogging bool
-	logFile        *os.File
-	customLogger   *log.Logger
-)
+	// gopls is started by the first semantic query and kept running
+	goplsMu sync.Mutex
+	gopls   *lspClient
+}
 
-// getCommunityRulesRepoURL returns the community rules repository URL (can be overridden in tests)
-func getCommunityRulesRepoURL() string {
-	return communityRulesRepo
+// NewServer creates a Server from opts, filling in defaults
+func NewServer(opts Options) *Server {
+	s := &Server{
+		projectRoot:        opts.ProjectRoot,
+		astGrepPath:        opts.AstGrepPath,
+		goplsPath:          opts.GoplsPath,
+		communityIndexURL:  opts.CommunityIndexURL,
+		communityRulesURL:  opts.CommunityRulesURL,
+		logger:             opts.Logger,
+		httpClient:         opts.HTTPClient,
+		extraAnalyzers:     opts.Analyzers,
+		goAnalyzers:        opts.GoAnalyzers,
+		disableScanCache:   opts.DisableScanCache,
+		scanBatchSize:      opts.ScanBatchSize,
+		scanWorkerCount:    opts.ScanWorkers,
+		defaultToolTimeout: opts.ToolTimeout,
+		toolTimeouts:       opts.ToolTimeouts,
+	}
+	if s.communityIndexURL == "" {
+		s.communityIndexURL = DefaultCommunityIndexURL
+	}
+	if s.communityRulesURL == "" {
+		s.communityRulesURL = s.communityIndexURL
+	}
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+	if s.httpClient == nil {
+		s.httpClient = http.DefaultClient
+	}
+	if s.defaultToolTimeout == 0 {
+		s.defaultToolTimeout = DefaultToolTimeout
+	}
+	return s
 }
 
-// Start initializes and starts the MCP server.
-func Start(projectRoot string, verbose bool, logFilePath string, astGrepPath string) {
-	if projectRoot != "" {
-		projectRootOverride = projectRoot
+// Start initializes and starts the MCP server described by opts on the given transport.
+// The logger of opts is replaced by one configured from logging.
+func Start(opts Options, logging LogOptions, transport TransportOptions) {
+	// Initialize logging system
+	logger, logFile, err := newLogger(logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logging: %v\n", err)
+		return
 	}
-	if astGrepPath != "" {
-		astGrepPathOverride = astGrepPath
+	if logFile != nil {
+		defer logFile.Close()
 	}
 
-	// Initialize logging system
-	initLogging(verbose, logFilePath)
+	opts.Logger = logger
+	s := NewServer(opts)
+	defer s.Close()
+
+	// Test ast-grep binary and log version information
+	sgPath, err := s.findAstGrepBinary()
+	if err != nil {
+		logger.Error("Failed to find ast-grep binary", "error", err)
+		// Don't exit here - let the MCP tools handle the error when actually used
+	} else {
+		// Log ast-grep version for debugging and verification
+		versionCmd := exec.Command(sgPath, "--version")
+		if versionOutput, err := versionCmd.Output(); err == nil {
+			logger.Info("Using ast-grep: "+strings.TrimSpace(string(versionOutput)), "path", sgPath)
+		} else {
+			logger.Warn("Could not get ast-grep version", "path", sgPath, "error", err)
+		}
+	}
+
+	logger.Info("Starting MCP server...")
+
+	if err := s.Serve(transport); err != nil {
+		logger.Error("Server error", "error", err)
+	}
+}
 
-	// Create a new MCP server
-	s := server.NewMCPServer(
+// newMCPServer creates an MCP server with every tool of s registered and tool calls logged.
+// All transports serve such a server, so they expose the same tool set.
+func (s *Server) newMCPServer() *server.MCPServer {
+	m := server.NewMCPServer(
 		"context-sherpa 🚀",
-		"1.0.0",
+		serverVersion,
 		server.WithToolCapabilities(false),
+		server.WithHooks(s.newRequestLoggingHooks()),
 	)
+	s.RegisterTools(m)
+	return m
+}
 
+// RegisterTools adds every context-sherpa tool to m. The tools operate on the project of s, so
+// an embedding program can serve them next to its own tools.
+func (s *Server) RegisterTools(m *server.MCPServer) {
 	// Add scan_code tool
 	scanCodeTool := mcp.NewTool("scan_code",
-		mcp.WithDescription("Scan a given string of source code for violations against the currently configured ast-grep rules."),
+		mcp.WithDescription("Scan a given string of source code for violations against the currently configured ast-grep rules. Returns the same versioned JSON findings document as scan_path."),
 		mcp.WithString("code",
 			mcp.Required(),
 			mcp.Description("The raw source code to be scanned."),
 		),
 		mcp.WithString("language",
 			mcp.Required(),
-			mcp.Description("The programming language of the code (e.g., 'go', 'python')."),
+			mcp.Description("The programming language of the code, as ast-grep names it or one of its aliases (e.g., 'go', 'python', 'tsx'). Languages declared in the project's customLanguages are accepted too."),
 		),
 		mcp.WithString("sgconfig",
 			mcp.Description("Path to a specific sgconfig.yml file to use for the scan. If omitted, it defaults to the root sgconfig.yml."),
 		),
+		mcp.WithBoolean("baseline",
+			mcp.Description("When true, findings recorded in the baseline file (see create_baseline) are hidden so only new findings are reported."),
+		),
+		mcp.WithString("baseline_file",
+			mcp.Description("Path to the baseline file, relative to the project root. Defaults to 'sherpa-baseline.json'."),
+		),
 	)
 
+	// fileSelectionOptions narrow the files read by the tools scanning files on disk
+	fileSelectionOptions := []mcp.ToolOption{
+		mcp.WithString("include",
+			mcp.Description("Comma-separated globs in .gitignore syntax; when given, only matching files are scanned. Example: 'internal/**,*.go'."),
+		),
+		mcp.WithString("exclude",
+			mcp.Description("Comma-separated globs in .gitignore syntax of files and directories to skip. Example: 'testdata/,*_test.go'. Files ignored by .gitignore files or the project's .sherpaignore are always skipped."),
+		),
+		mcp.WithBoolean("include_generated",
+			mcp.Description("When true, Go files marked '// Code generated ... DO NOT EDIT.' are scanned too. Defaults to false."),
+		),
+	}
+
 	// Add scan_path tool
-	scanPathTool := mcp.NewTool("scan_path",
-		mcp.WithDescription("Scan code for rule violations by providing a file path, directory path, or glob pattern. The path can resolve to a single file, multiple files, or an entire directory tree. Returns JSON array of violations found with file location, line numbers, and rule details."),
+	scanPathTool := mcp.NewTool("scan_path", append([]mcp.ToolOption{
+		mcp.WithDescription("Scan code for rule violations by providing a file path, directory path, or glob pattern. The path can resolve to a single file, multiple files, or an entire directory tree. Returns a versioned JSON document with a 'findings' array (rule id, severity, message, file, 1-based line/column range) and a 'diagnostics' array for problems encountered while scanning."),
 		mcp.WithString("path",
 			mcp.Required(),
-			mcp.Description("File path, directory path, or glob pattern to scan. Examples: 'src/main.go' (single file), 'src/' (directory), '**/*.go' (all Go files), 'internal/**/*.js' (pattern)."),
+			mcp.Description("File path, directory path, or comma-separated glob patterns relative to the project root. '**' matches any number of directories, braces list alternatives and a leading '!' excludes matches. Examples: 'src/main.go' (single file), 'src/' (directory), '**/*.go' (all Go files), 'web/**/*.{ts,tsx}' (pattern), '**/*.go,!**/*_test.go' (several patterns)."),
 		),
 		mcp.WithString("sgconfig",
 			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root. Example: 'custom/sgconfig.yml'."),
 		),
 		mcp.WithString("language",
-			mcp.Description("Programming language filter for directory scans. Supported: 'go', 'python', 'javascript', 'typescript', 'rust', 'java', 'cpp', 'c'. If specified, only files with matching extensions are scanned."),
+			mcp.Description("Programming language filter for directory scans, e.g. 'go', 'python', 'javascript', 'typescript', 'tsx', 'rust', 'java', 'cpp', 'c', 'csharp', 'kotlin', 'ruby', 'swift', 'lua', 'html' or 'css'. If specified, only files of that language are scanned, as told by their extension or the project's languageGlobs."),
+		),
+		mcp.WithString("analyzers",
+			mcp.Description("Comma-separated names of the analyzers to run, e.g. 'ast-grep' or 'go-analysis'. If omitted, the analyzers the project enables run and their findings are merged; each finding names the analyzer that reported it."),
+		),
+		mcp.WithBoolean("baseline",
+			mcp.Description("When true, findings recorded in the baseline file (see create_baseline) are hidden so only new findings are reported."),
+		),
+		mcp.WithString("baseline_file",
+			mcp.Description("Path to the baseline file, relative to the project root. Defaults to 'sherpa-baseline.json'."),
+		),
+		mcp.WithString("output_format",
+			mcp.Description("Format of the result: 'json' (default, the versioned findings document) or 'sarif' (SARIF 2.1.0 with rule metadata from the configured ruleDirs, for code-scanning dashboards)."),
+			mcp.Enum(outputFormatJSON, outputFormatSARIF),
+		),
+	}, fileSelectionOptions...)...)
+
+	// Add scan_changes tool
+	scanChangesTool := mcp.NewTool("scan_changes",
+		mcp.WithDescription("Scan only the lines you changed. Compares the working tree and staged index against a git ref, scans the changed and untracked files, and reports only findings that overlap changed lines, so pre-existing violations in touched files are not reported. Works in any local git repository, no remote required. Returns the same versioned JSON findings document as scan_path."),
+		mcp.WithString("base",
+			mcp.Description("Git ref to compare against (branch, tag or commit). Defaults to 'HEAD', i.e. uncommitted changes."),
+		),
+		mcp.WithString("sgconfig",
+			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root."),
+		),
+		mcp.WithString("language",
+			mcp.Description("Programming language filter. If specified, only changed files with matching extensions are scanned."),
 		),
 	)
 
+	// Add apply_fixes tool
+	applyFixesTool := mcp.NewTool("apply_fixes", append([]mcp.ToolOption{
+		mcp.WithDescription("Apply the 'fix:' templates of ast-grep rules instead of hand-editing code. By default returns a unified diff preview of the rewrites ast-grep would make and changes nothing; pass confirm=true to write the files. Only files inside the project root are ever modified."),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("File path, directory path, or glob pattern to fix. Examples: 'src/main.go', 'src/'."),
+		),
+		mcp.WithString("rule_ids",
+			mcp.Description("Comma-separated list of rule ids whose fixes should be applied (e.g., 'no-fmt-println,use-errors-is'). If omitted, fixes from every rule are applied."),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Set to true to write the fixes to disk. Defaults to false, which only returns the diff preview."),
+		),
+		mcp.WithString("sgconfig",
+			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root."),
+		),
+		mcp.WithString("language",
+			mcp.Description("Programming language filter for directory scans."),
+		),
+	}, fileSelectionOptions...)...)
+
+	// Add create_baseline tool
+	createBaselineTool := mcp.NewTool("create_baseline", append([]mcp.ToolOption{
+		mcp.WithDescription("Snapshot the current findings into a baseline file so that pre-existing violations no longer flood scan results. Commit the file and scan with baseline=true to see only new findings. Findings are fingerprinted by rule id, file and a hash of the normalized matched code, so unrelated line shifts do not invalidate the baseline. Only the entries of the scanned files are replaced; the rest of an existing baseline is kept."),
+		mcp.WithString("path",
+			mcp.Description("File path, directory path, or glob pattern to snapshot. Defaults to '.' (the whole project)."),
+		),
+		mcp.WithString("sgconfig",
+			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root."),
+		),
+		mcp.WithString("language",
+			mcp.Description("Programming language filter for directory scans."),
+		),
+		mcp.WithString("baseline_file",
+			mcp.Description("Path to the baseline file to write, relative to the project root. Defaults to 'sherpa-baseline.json'."),
+		),
+	}, fileSelectionOptions...)...)
+
+	// Add prune_baseline tool
+	pruneBaselineTool := mcp.NewTool("prune_baseline", append([]mcp.ToolOption{
+		mcp.WithDescription("Re-scan the project and remove baseline entries whose findings have since been fixed, so the baseline does not keep hiding violations that are reintroduced later."),
+		mcp.WithString("path",
+			mcp.Description("File path, directory path, or glob pattern to re-scan. Only entries for these files (or for files that no longer exist) are pruned. Defaults to '.'."),
+		),
+		mcp.WithString("sgconfig",
+			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root."),
+		),
+		mcp.WithString("language",
+			mcp.Description("Programming language filter for directory scans."),
+		),
+		mcp.WithString("baseline_file",
+			mcp.Description("Path to the baseline file, relative to the project root. Defaults to 'sherpa-baseline.json'."),
+		),
+	}, fileSelectionOptions...)...)
+
 	// Add add_or_update_rule tool
 	addOrUpdateRuleTool := mcp.NewTool("add_or_update_rule",
 		mcp.WithDescription(`Create or update an ast-grep rule for pattern-based code analysis.
@@ -141,7 +372,7 @@ Use this when you want to:
 Example: "Create a rule to catch SQL injection" → generates ast-grep YAML rules`),
 		mcp.WithString("rule_id",
 			mcp.Required(),
-			mcp.Description("Unique identifier for the rule (e.g., 'no-sql-injection', 'require-tests', 'no-todo-comments')"),
+			mcp.Description("Unique identifier for the rule (e.g., 'no-sql-injection', 'require-tests', 'no-todo-comments'). It must match the 'id' in rule_yaml."),
 		),
 		mcp.WithString("rule_yaml",
 			mcp.Required(),
@@ -161,15 +392,95 @@ rule:
 message: "Use parameterized queries"
 severity: error`),
 		),
+		mcp.WithArray("valid_examples",
+			mcp.WithStringItems(),
+			mcp.Description("Optional code snippets the rule must NOT report. Written as an ast-grep test case next to the rule."),
+		),
+		mcp.WithArray("invalid_examples",
+			mcp.WithStringItems(),
+			mcp.Description("Optional code snippets the rule MUST report. Written as an ast-grep test case next to the rule."),
+		),
+		mcp.WithString("rule_dir",
+			mcp.Description("The ruleDirs entry of sgconfig.yml to save the rule in, as written there (e.g., 'rules/security'). If omitted, an existing rule is updated where it is and a new rule goes to the first rule directory. Use get_config to list the rule directories."),
+		),
+		mcp.WithString("scope",
+			mcp.Description("File or directory, relative to the project root, of the sub-project the rule is for (e.g., 'services/api'). The rule is saved with the sgconfig.yml nearest to it, so it only applies to that sub-project. If omitted, the rule is added to the project's own sgconfig.yml. Use get_config to list the sub-projects."),
+		),
 	)
 
 	// Add remove_rule tool
 	removeRuleTool := mcp.NewTool("remove_rule",
-		mcp.WithDescription("Remove a specific ast-grep rule file from the local project's rule directory."),
+		mcp.WithDescription("Remove a specific ast-grep rule file from the local project's rule directories, along with its test cases."),
 		mcp.WithString("rule_id",
 			mcp.Required(),
 			mcp.Description("The unique ID of the rule to be removed (e.g., 'no-sql-injection'). This should match the filename without the .yml extension."),
 		),
+		mcp.WithString("scope",
+			mcp.Description("File or directory, relative to the project root, of the sub-project the rule belongs to, as given to add_or_update_rule. If omitted, the rule is removed from the project's own sgconfig.yml."),
+		),
+	)
+
+	// Add preview_rule tool
+	previewRuleTool := mcp.NewTool("preview_rule", append([]mcp.ToolOption{
+		mcp.WithDescription("Dry-run a proposed rule against the project before saving it. The rule is run on its own, without being written to the rule directories, and the tool returns the number of matches per file and a sample of matches. Use this before add_or_update_rule to check a rule is not too broad or too narrow."),
+		mcp.WithString("rule_yaml",
+			mcp.Required(),
+			mcp.Description("Complete YAML rule definition, in the same format as add_or_update_rule"),
+		),
+		mcp.WithString("path",
+			mcp.Description("File path, directory path, or glob pattern to run the rule against. Defaults to the whole project."),
+		),
+		mcp.WithString("language",
+			mcp.Description("Programming language filter for directory scans"),
+		),
+		mcp.WithNumber("sample_size",
+			mcp.Description("Maximum number of matches to include in the sample. Defaults to 10."),
+		),
+	}, fileSelectionOptions...)...)
+
+	// Add list_rules tool
+	listRulesTool := mcp.NewTool("list_rules",
+		mcp.WithDescription("List the rules configured for the local project, from every directory in sgconfig.yml's ruleDirs. Check this before adding a rule to avoid creating duplicates under a new id."),
+		mcp.WithString("language",
+			mcp.Description("Only list rules for this language (e.g., 'go', 'python')"),
+		),
+		mcp.WithString("severity",
+			mcp.Description("Only list rules with this severity (e.g., 'error', 'warning', 'info', 'hint')"),
+		),
+		mcp.WithString("sgconfig",
+			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root."),
+		),
+	)
+
+	// Add get_rule tool
+	getRuleTool := mcp.NewTool("get_rule",
+		mcp.WithDescription("Get the full YAML of a rule configured for the local project."),
+		mcp.WithString("rule_id",
+			mcp.Required(),
+			mcp.Description("The unique ID of the rule (e.g., 'no-sql-injection')"),
+		),
+		mcp.WithString("sgconfig",
+			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root."),
+		),
+	)
+
+	// Add get_config tool
+	getConfigTool := mcp.NewTool("get_config",
+		mcp.WithDescription("Get the project's resolved ast-grep configuration: the rule, utility and test directories of sgconfig.yml with whether they exist, its languageGlobs, customLanguages and languageInjections, the languages rules may use, the analyzers scans run, and any problems found in the configuration. Use this to understand how a project is set up before adding rules."),
+		mcp.WithString("sgconfig",
+			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root."),
+		),
+	)
+
+	// Add run_rule_tests tool
+	runRuleTestsTool := mcp.NewTool("run_rule_tests",
+		mcp.WithDescription("Run the ast-grep test cases of the local rules (the valid and invalid examples given to add_or_update_rule) and report which rules pass or fail. Use this to check a new rule behaves as intended."),
+		mcp.WithString("rule_ids",
+			mcp.Description("Comma-separated rule ids to test. If omitted, all rule tests are run."),
+		),
+		mcp.WithString("sgconfig",
+			mcp.Description("Path to specific sgconfig.yml configuration file. If omitted, uses 'sgconfig.yml' in project root."),
+		),
 	)
 
 	// Add initialize_ast_grep tool
@@ -220,42 +531,61 @@ Example: "Create a rule to catch SQL injection" → generates ast-grep YAML rule
 		),
 	)
 
-	// Add tool handlers
-	s.AddTool(scanCodeTool, scanCodeHandler)
-	s.AddTool(scanPathTool, scanPathHandler)
-	s.AddTool(addOrUpdateRuleTool, addOrUpdateRuleHandler)
-	s.AddTool(removeRuleTool, removeRuleHandler)
-	s.AddTool(initializeAstGrepTool, initializeAstGrepHandler)
-	s.AddTool(searchCommunityRulesTool, searchCommunityRulesHandler)
-	s.AddTool(getCommunityRuleDetailsTool, getCommunityRuleDetailsHandler)
-	s.AddTool(importCommunityRuleTool, importCommunityRuleHandler)
-
-	// Test ast-grep binary and log version information
-	sgPath, err := findAstGrepBinary(astGrepPathOverride)
-	if err != nil {
-		customLogger.Printf("Failed to find ast-grep binary: %v\n", err)
-		// Don't exit here - let the MCP tools handle the error when actually used
-	} else {
-		// Log ast-grep version for debugging and verification
-		versionCmd := exec.Command(sgPath, "--version")
-		if versionOutput, err := versionCmd.Output(); err == nil {
-			customLogger.Printf("Using ast-grep: %s", strings.TrimSpace(string(versionOutput)))
-		} else {
-			customLogger.Printf("Warning: Could not get ast-grep version: %v", err)
-		}
+	// Semantic query tools for Go, answered by a long-lived gopls process
+	semanticPositionOptions := []mcp.ToolOption{
+		mcp.WithString("file_path",
+			mcp.Required(),
+			mcp.Description("Go file containing the symbol, relative to the project root."),
+		),
+		mcp.WithNumber("line",
+			mcp.Required(),
+			mcp.Description("1-based line of the symbol, as reported in findings."),
+		),
+		mcp.WithNumber("column",
+			mcp.Required(),
+			mcp.Description("1-based column of any character of the symbol."),
+		),
 	}
 
-	customLogger.Println("Starting MCP server...")
+	getDefinitionTool := mcp.NewTool("get_definition", append([]mcp.ToolOption{
+		mcp.WithDescription("Find where the Go symbol at a position is defined, using gopls. Returns the definition's file, 1-based line/column range and its declaration (function signature, type, var, const or field) without the body."),
+	}, semanticPositionOptions...)...)
 
-	// Start the stdio server
-	if err := server.ServeStdio(s); err != nil {
-		customLogger.Printf("Server error: %v\n", err)
-	}
-}
+	getTypeInfoTool := mcp.NewTool("get_type_info", append([]mcp.ToolOption{
+		mcp.WithDescription("Get the type of the Go symbol at a position, using gopls. Returns the declaration as 'type' (e.g. 'var err error' or a function signature), its documentation and the symbol's range."),
+	}, semanticPositionOptions...)...)
 
-func scanCodeHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	var projectRoot string
+	findReferencesTool := mcp.NewTool("find_references", append([]mcp.ToolOption{
+		mcp.WithDescription("Find every reference to the Go symbol at a position across the workspace, using gopls. Returns each reference's file, 1-based line/column range and source line."),
+		mcp.WithBoolean("include_declaration",
+			mcp.Description("Whether the declaration itself is listed. Defaults to true."),
+		),
+	}, semanticPositionOptions...)...)
+
+	// Add tool handlers, each bounded by its timeout
+	m.AddTool(scanCodeTool, s.withTimeout(scanCodeTool.Name, s.scanCodeHandler))
+	m.AddTool(scanPathTool, s.withTimeout(scanPathTool.Name, s.scanPathHandler))
+	m.AddTool(scanChangesTool, s.withTimeout(scanChangesTool.Name, s.scanChangesHandler))
+	m.AddTool(applyFixesTool, s.withTimeout(applyFixesTool.Name, s.applyFixesHandler))
+	m.AddTool(createBaselineTool, s.withTimeout(createBaselineTool.Name, s.createBaselineHandler))
+	m.AddTool(pruneBaselineTool, s.withTimeout(pruneBaselineTool.Name, s.pruneBaselineHandler))
+	m.AddTool(addOrUpdateRuleTool, s.withTimeout(addOrUpdateRuleTool.Name, s.addOrUpdateRuleHandler))
+	m.AddTool(removeRuleTool, s.withTimeout(removeRuleTool.Name, s.removeRuleHandler))
+	m.AddTool(previewRuleTool, s.withTimeout(previewRuleTool.Name, s.previewRuleHandler))
+	m.AddTool(listRulesTool, s.withTimeout(listRulesTool.Name, s.listRulesHandler))
+	m.AddTool(getRuleTool, s.withTimeout(getRuleTool.Name, s.getRuleHandler))
+	m.AddTool(getConfigTool, s.withTimeout(getConfigTool.Name, s.getConfigHandler))
+	m.AddTool(runRuleTestsTool, s.withTimeout(runRuleTestsTool.Name, s.runRuleTestsHandler))
+	m.AddTool(initializeAstGrepTool, s.withTimeout(initializeAstGrepTool.Name, s.initializeAstGrepHandler))
+	m.AddTool(searchCommunityRulesTool, s.withTimeout(searchCommunityRulesTool.Name, s.searchCommunityRulesHandler))
+	m.AddTool(getCommunityRuleDetailsTool, s.withTimeout(getCommunityRuleDetailsTool.Name, s.getCommunityRuleDetailsHandler))
+	m.AddTool(importCommunityRuleTool, s.withTimeout(importCommunityRuleTool.Name, s.importCommunityRuleHandler))
+	m.AddTool(getDefinitionTool, s.withTimeout(getDefinitionTool.Name, s.getDefinitionHandler))
+	m.AddTool(getTypeInfoTool, s.withTimeout(getTypeInfoTool.Name, s.getTypeInfoHandler))
+	m.AddTool(findReferencesTool, s.withTimeout(findReferencesTool.Name, s.findReferencesHandler))
+}
 
+func (s *Server) scanCodeHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	code, err := req.RequireString("code")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
@@ -273,90 +603,214 @@ func scanCodeHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToo
 		}
 	}
 
-	// --- DEBUG LOGGING ---
-	verboseLog("scanCodeHandler: Using sgconfig file: %s", sgconfigStr)
-	// --- END DEBUG LOGGING ---
+	result, projectRoot, errResult := s.scanCode(ctx, code, language, sgconfigStr)
+	if errResult != nil {
+		return errResult, nil
+	}
 
-	// Find the project root where sgconfig.yml is located
-	projectRoot, err = findProjectRoot()
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
+	if baselineModeRequested(req) {
+		if errResult := applyBaseline(req, result, projectRoot, true); errResult != nil {
+			return errResult, nil
+		}
 	}
 
-	// Resolve sgconfig path relative to project root
-	resolvedSgconfigPath := resolvePathRelativeToProjectRoot(sgconfigStr, projectRoot)
+	return scanResultToToolResult(result), nil
+}
 
-	// Check if the configuration file exists at the resolved path
-	if _, err := os.Stat(resolvedSgconfigPath); os.IsNotExist(err) {
-		return mcp.NewToolResultText(fmt.Sprintf("Error: Configuration file '%s' not found at resolved path '%s'. Please run the 'initialize_ast_grep' tool first to set up the project.", sgconfigStr, resolvedSgconfigPath)), nil
+// scanCode scans a snippet of code written in language with every analyzer that supports
+// snippets and returns the findings together with
+// the project root. When the scan cannot run, the tool result describing why is returned instead.
+func (s *Server) scanCode(ctx context.Context, code, language, sgconfigStr string) (*ScanResult, string, *mcp.CallToolResult) {
+	// --- DEBUG LOGGING ---
+	s.logger.Debug("Scanning code", "sgconfig", sgconfigStr)
+	// --- END DEBUG LOGGING ---
+
+	setup, errResult := s.prepareScan(sgconfigStr)
+	if errResult != nil {
+		return nil, "", errResult
 	}
 
-	tmpfile, err := os.CreateTemp("", "ast-grep-scan.*."+language)
+	// Analyzers are given the name ast-grep uses, whichever alias the caller wrote
+	spec, err := setup.Languages.resolve(language)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error creating temporary file: %v", err)), nil
+		return nil, "", mcp.NewToolResultError(fmt.Sprintf("Error: %v", err))
 	}
-	defer os.Remove(tmpfile.Name())
 
-	if _, err := tmpfile.Write([]byte(code)); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error writing to temporary file: %v", err)), nil
+	project := Project{Root: setup.ProjectRoot, SgconfigPath: setup.SgconfigPath}
+	merged := newScanResult(nil, nil)
+	for _, analyzer := range setup.Analyzers {
+		if !analyzer.Capabilities().Snippets {
+			continue
+		}
+		result, err := analyzer.ScanSnippet(ctx, project, code, spec.Name)
+		mergeAnalyzerResult(merged, analyzer, result, err)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, "", mcp.NewToolResultError(fmt.Sprintf("Error: the scan %s before the code was scanned", cancelReason(err)))
+	}
+	merged.Diagnostics = append(merged.Diagnostics, setup.ConstraintDiagnostics...)
 
-	if err := tmpfile.Close(); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error closing temporary file: %v", err)), nil
+	// Drop the ast-grep matches failing their rule's semantic constraints, checking the
+	// snippet as a package of its own
+	if spec.Name == "go" && needsSemanticCheck(merged.Findings, setup.Constraints) {
+		fset := token.NewFileSet()
+		typed := make(map[string]*typedFile)
+		if file, err := typeCheckStandalone(fset, snippetFileName, []byte(code)); err == nil {
+			typed[snippetFileName] = file
+		}
+		pathOf := func(Finding) string { return snippetFileName }
+		findings, semanticDiagnostics := applySemanticConstraints(merged.Findings, setup.Constraints, typed, fset, pathOf)
+		merged.Findings = findings
+		merged.Diagnostics = append(merged.Diagnostics, semanticDiagnostics...)
 	}
 
-	sgPath, err := findAstGrepBinary(astGrepPathOverride)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error finding ast-grep binary: %v", err)), nil
+	findings, suppressionDiagnostics := applySuppressions(merged.Findings, []sourceFile{{
+		Name:          snippetFileName,
+		Content:       []byte(code),
+		CommentPrefix: spec.CommentPrefix,
+	}})
+	diagnostics := append(merged.Diagnostics, suppressionDiagnostics...)
+
+	return newScanResult(findings, diagnostics), setup.ProjectRoot, nil
+}
+
+// ScanPathOptions holds the arguments shared by the tools that scan files on disk
+type ScanPathOptions struct {
+	// Path is a file, directory or comma-separated list of glob patterns, relative to the
+	// project root
+	Path string
+	// Sgconfig is the sgconfig.yml to scan with, relative to the project root
+	Sgconfig string
+	// LanguageFilter, when set, limits directory and glob scans to files of that language
+	LanguageFilter string
+	// Analyzers names the analyzers to run; empty runs every enabled analyzer
+	Analyzers []string
+	// Include, when set, limits the scan to files matching one of these globs, and Exclude
+	// skips files and directories matching any of them. Both use .gitignore syntax.
+	Include []string
+	Exclude []string
+	// IncludeGenerated scans Go files marked "// Code generated ... DO NOT EDIT.", which are
+	// skipped otherwise
+	IncludeGenerated bool
+}
+
+// scanPathOutcome is the result of scanning files on disk
+type scanPathOutcome struct {
+	Result      *ScanResult
+	ProjectRoot string
+	// SgconfigPaths lists the sgconfig.yml files the files were scanned with: the selected one
+	// and those of the sub-projects holding some of the files
+	SgconfigPaths []string
+	// Files lists the scanned files relative to the project root
+	Files []string
+}
+
+// scanPathOptionsFromRequest reads the path, sgconfig, language, analyzers and file selection arguments of a scan request.
+// When defaultPath is empty the path argument is required.
+func scanPathOptionsFromRequest(req mcp.CallToolRequest, defaultPath string) (ScanPathOptions, error) {
+	opts := ScanPathOptions{
+		Path:     defaultPath,
+		Sgconfig: "sgconfig.yml", // Default value
 	}
 
-	cmd := exec.Command(sgPath, "scan", "--config", resolvedSgconfigPath, tmpfile.Name(), "--json")
-	cmd.Dir = projectRoot // Run ast-grep from the project root
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// ast-grep exits with non-zero status code if issues are found.
-		// We still want to parse the output.
+	if defaultPath == "" {
+		path, err := req.RequireString("path")
+		if err != nil {
+			return opts, err
+		}
+		opts.Path = path
+	}
+
+	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
+		if path, ok := args["path"].(string); ok && path != "" {
+			opts.Path = path
+		}
+		if sgconfig, ok := args["sgconfig"].(string); ok && sgconfig != "" {
+			opts.Sgconfig = sgconfig
+		}
+		// Get optional language filter
+		if lang, ok := args["language"].(string); ok && lang != "" {
+			opts.LanguageFilter = strings.ToLower(lang)
+		}
+		if analyzers, ok := args["analyzers"].(string); ok && analyzers != "" {
+			opts.Analyzers = splitCommaList(analyzers)
+		}
+		if include, ok := args["include"].(string); ok {
+			opts.Include = splitCommaList(include)
+		}
+		if exclude, ok := args["exclude"].(string); ok {
+			opts.Exclude = splitCommaList(exclude)
+		}
 	}
+	opts.IncludeGenerated = req.GetBool("include_generated", false)
 
-	return mcp.NewToolResultText(string(output)), nil
+	return opts, nil
+}
+
+// splitCommaList splits a comma-separated argument, dropping blank entries
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // scanPathHandler handles the scan_path tool
-func scanPathHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	var projectRoot string
+func (s *Server) scanPathHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts, err := scanPathOptionsFromRequest(req, "")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	path, err := req.RequireString("path")
+	outputFormat, err := outputFormatFromRequest(req)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	sgconfigStr := "sgconfig.yml" // Default value
-	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
-		if sgconfig, ok := args["sgconfig"].(string); ok && sgconfig != "" {
-			sgconfigStr = sgconfig
-		}
+	outcome, errResult := s.runScanPath(ctx, opts)
+	if errResult != nil {
+		return errResult, nil
 	}
 
-	// Get optional language filter
-	var languageFilter string
-	if args, ok := req.Params.Arguments.(map[string]interface{}); ok {
-		if lang, ok := args["language"].(string); ok && lang != "" {
-			languageFilter = strings.ToLower(lang)
+	if baselineModeRequested(req) {
+		if errResult := applyBaseline(req, outcome.Result, outcome.ProjectRoot, false); errResult != nil {
+			return errResult, nil
 		}
 	}
 
-	// --- DEBUG LOGGING ---
-	verboseLog("scanPathHandler: Using sgconfig file: %s", sgconfigStr)
-	verboseLog("scanPathHandler: Scanning path: %s", path)
-	if languageFilter != "" {
-		verboseLog("scanPathHandler: Language filter: %s", languageFilter)
+	if outputFormat == outputFormatSARIF {
+		return sarifToolResult(outcome.Result, outcome.SgconfigPaths, outcome.ProjectRoot), nil
 	}
-	// --- END DEBUG LOGGING ---
 
+	return scanResultToToolResult(outcome.Result), nil
+}
+
+// scanSetup is everything needed to run the analyzers against files on disk
+type scanSetup struct {
+	ProjectRoot  string
+	SgconfigPath string
+	SgPath       string
+	// Analyzers are run against the scanned files, ast-grep first
+	Analyzers []Analyzer
+	// Constraints holds the semantic constraints of the ast-grep rules, by rule id, and
+	// ConstraintDiagnostics the rules whose constraints could not be read
+	Constraints           map[string][]semanticConstraint
+	ConstraintDiagnostics []Diagnostic
+	// Languages tells the languages of the project and of its files apart
+	Languages *languageRegistry
+}
+
+// prepareScan locates the project root, the sgconfig.yml to use and the ast-grep binary, and
+// enables the analyzers the project runs by default.
+// When any of them is missing, the tool result describing the problem is returned instead.
+func (s *Server) prepareScan(sgconfigStr string) (*scanSetup, *mcp.CallToolResult) {
 	// Find the project root where sgconfig.yml is located
-	projectRoot, err = findProjectRoot()
+	projectRoot, err := s.findProjectRoot()
 	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
+		return nil, mcp.NewToolResultError(err.Error())
 	}
 
 	// Resolve sgconfig path relative to project root
@@ -364,26 +818,90 @@ func scanPathHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToo
 
 	// Check if the configuration file exists at the resolved path
 	if _, err := os.Stat(resolvedSgconfigPath); os.IsNotExist(err) {
-		return mcp.NewToolResultText(fmt.Sprintf("Error: Configuration file '%s' not found at resolved path '%s'. Please run the 'initialize_ast_grep' tool first to set up the project.", sgconfigStr, resolvedSgconfigPath)), nil
+		return nil, mcp.NewToolResultText(fmt.Sprintf("Error: Configuration file '%s' not found at resolved path '%s'. Please run the 'initialize_ast_grep' tool first to set up the project.", sgconfigStr, resolvedSgconfigPath))
 	}
 
-	sgPath, err := findAstGrepBinary(astGrepPathOverride)
+	sgPath, err := s.findAstGrepBinary()
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error finding ast-grep binary: %v", err)), nil
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Error finding ast-grep binary: %v", err))
+	}
+
+	return s.newScanSetup(projectRoot, resolvedSgconfigPath, sgPath), nil
+}
+
+// newScanSetup enables the analyzers the sgconfig.yml at sgconfigPath runs by default, and
+// reads its languages and the semantic constraints of its rules
+func (s *Server) newScanSetup(projectRoot, sgconfigPath, sgPath string) *scanSetup {
+	setup := &scanSetup{
+		ProjectRoot:  projectRoot,
+		SgconfigPath: sgconfigPath,
+		SgPath:       sgPath,
+		Analyzers:    defaultAnalyzers(s.analyzers(sgPath), sgconfigPath),
+		Languages:    loadLanguages(sgconfigPath),
+	}
+	// Rules that cannot be read are reported by ast-grep itself, so errors are left to it
+	if docs, _, err := loadRuleDocuments(sgconfigPath); err == nil {
+		setup.Constraints, setup.ConstraintDiagnostics = ruleConstraints(docs, projectRoot)
+	}
+	return setup
+}
+
+// runScanPath discovers and scans the files selected by opts.
+// When the scan cannot run at all, the tool result describing why is returned instead.
+func (s *Server) runScanPath(ctx context.Context, opts ScanPathOptions) (*scanPathOutcome, *mcp.CallToolResult) {
+	// --- DEBUG LOGGING ---
+	s.logger.Debug("Scanning path", "sgconfig", opts.Sgconfig, "path", opts.Path, "language", opts.LanguageFilter)
+	// --- END DEBUG LOGGING ---
+
+	setup, errResult := s.prepareScan(opts.Sgconfig)
+	if errResult != nil {
+		return nil, errResult
+	}
+
+	// A scan naming its analyzers may select those the project does not run by default
+	if len(opts.Analyzers) > 0 {
+		analyzers, err := selectAnalyzers(s.analyzers(setup.SgPath), opts.Analyzers)
+		if err != nil {
+			return nil, mcp.NewToolResultError(err.Error())
+		}
+		setup.Analyzers = analyzers
 	}
 
 	// Discover files to scan
-	files, err := discoverFiles(path, languageFilter, projectRoot)
+	filter, err := newFileFilter(setup.ProjectRoot, setup.Languages, opts)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error discovering files: %v", err)), nil
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	files, err := discoverFiles(opts.Path, opts.LanguageFilter, setup.ProjectRoot, filter)
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Error discovering files: %v", err))
+	}
+
+	// Files of sub-projects are scanned with the rules of their own sgconfig.yml
+	outcome, errResult := s.scanConfigGroups(ctx, setup, files, opts.Analyzers)
+	if errResult != nil {
+		return nil, errResult
+	}
+	outcome.Result.Diagnostics = append(outcome.Result.Diagnostics, unmatchedPathDiagnostics(opts.Path, setup.ProjectRoot, files)...)
+	return outcome, nil
+}
+
+// scanFiles scans the given files with the analyzers of setup, merging their findings and
+// applying the size limit, semantic constraints and suppression comments
+func (s *Server) scanFiles(ctx context.Context, setup *scanSetup, files []string) (*scanPathOutcome, *mcp.CallToolResult) {
+	projectRoot := setup.ProjectRoot
+	outcome := &scanPathOutcome{
+		Result:        newScanResult(nil, nil),
+		ProjectRoot:   projectRoot,
+		SgconfigPaths: []string{setup.SgconfigPath},
 	}
 
 	if len(files) == 0 {
-		return mcp.NewToolResultText("[]"), nil // Return empty JSON array for no files
+		return outcome, nil // No files to scan
 	}
 
 	// --- DEBUG LOGGING ---
-	verboseLog("scan_file: Found %d files to scan", len(files))
+	s.logger.Debug("Found files to scan", "files", len(files))
 	// --- END DEBUG LOGGING ---
 
 	// Filter files by size (1MB limit) - FIRST ITERATION FEATURE
@@ -392,13 +910,13 @@ func scanPathHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToo
 	for _, file := range files {
 		fileInfo, err := os.Stat(file)
 		if err != nil {
-			verboseLog("scan_file: Warning - could not stat file %s: %v", file, err)
+			s.logger.Warn("Could not stat file", "file", file, "error", err)
 			continue
 		}
 
 		if fileInfo.Size() > 1024*1024 { // 1MB limit
 			skippedFiles = append(skippedFiles, file)
-			verboseLog("scan_file: Skipping file %s (size: %d bytes > 1MB limit)", file, fileInfo.Size())
+			s.logger.Debug("Skipping file over 1MB", "file", file, "size", fileInfo.Size())
 			continue
 		}
 
@@ -406,35 +924,112 @@ func scanPathHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToo
 	}
 
 	// --- DEBUG LOGGING ---
-	verboseLog("scan_file: %d files valid for scanning, %d files skipped (over 1MB)", len(validFiles), len(skippedFiles))
+	s.logger.Debug("Files selected for scanning", "valid", len(validFiles), "skipped", len(skippedFiles))
 	// --- END DEBUG LOGGING ---
 
+	var diagnostics []Diagnostic
+	for _, file := range skippedFiles {
+		diagnostics = append(diagnostics, Diagnostic{
+			Level:   DiagnosticInfo,
+			Source:  "context-sherpa",
+			Message: "file skipped: larger than the 1MB scan limit",
+			File:    relativeToProjectRoot(file, projectRoot),
+		})
+	}
+
 	if len(validFiles) == 0 {
-		return mcp.NewToolResultText("[]"), nil // Return empty JSON array for no valid files
+		outcome.Result.Diagnostics = append(outcome.Result.Diagnostics, diagnostics...)
+		return outcome, nil // No valid files to scan
 	}
 
-	// Scan files in batches
-	allOutput, err := scanFileBatch(validFiles, resolvedSgconfigPath, projectRoot, sgPath)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error scanning files: %v", err)), nil
+	// Run every analyzer over the files in its languages and merge the results
+	project := Project{Root: projectRoot, SgconfigPath: setup.SgconfigPath}
+	result := newScanResult(nil, diagnostics)
+	unscanned := make(map[string]bool)
+	for _, analyzer := range setup.Analyzers {
+		analyzerFiles := analyzerFiles(analyzer, validFiles, setup.Languages, projectRoot)
+		if len(analyzerFiles) == 0 {
+			continue
+		}
+		// Once the scan is cancelled, the remaining analyzers are not started and an analyzer
+		// failing because it was stopped scanned none of its files
+		if ctx.Err() == nil {
+			analyzerResult, err := analyzer.ScanFiles(ctx, project, analyzerFiles)
+			if err == nil || ctx.Err() == nil {
+				mergeAnalyzerResult(result, analyzer, analyzerResult, err)
+				if err == nil {
+					for _, file := range analyzerResult.Unscanned {
+						unscanned[file] = true
+					}
+				}
+				continue
+			}
+		}
+		for _, file := range analyzerFiles {
+			unscanned[relativeToProjectRoot(file, projectRoot)] = true
+		}
+	}
+	if len(unscanned) > 0 {
+		for _, file := range validFiles {
+			if rel := relativeToProjectRoot(file, projectRoot); unscanned[rel] {
+				result.Unscanned = append(result.Unscanned, rel)
+			}
+		}
+		result.Diagnostics = append(result.Diagnostics, Diagnostic{
+			Level:   DiagnosticError,
+			Source:  "context-sherpa",
+			Message: scanIncompleteMessage(ctx.Err(), len(result.Unscanned), len(validFiles)),
+		})
+	}
+	result.Diagnostics = append(result.Diagnostics, setup.ConstraintDiagnostics...)
+
+	// Drop the ast-grep matches failing their rule's semantic constraints
+	if needsSemanticCheck(result.Findings, setup.Constraints) {
+		pathOf := func(f Finding) string { return resolvePathRelativeToProjectRoot(f.File, projectRoot) }
+		var paths []string
+		seen := make(map[string]bool)
+		for _, finding := range result.Findings {
+			if path := pathOf(finding); len(setup.Constraints[finding.RuleID]) > 0 && !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+		fset := token.NewFileSet()
+		typed := loadTypedFiles(ctx, fset, projectRoot, paths)
+		findings, semanticDiagnostics := applySemanticConstraints(result.Findings, setup.Constraints, typed, fset, pathOf)
+		result.Findings = findings
+		result.Diagnostics = append(result.Diagnostics, semanticDiagnostics...)
+	}
+
+	// Drop findings silenced by sherpa-ignore comments
+	findings, suppressionDiagnostics := applySuppressions(result.Findings, s.loadSourceFiles(validFiles, projectRoot, setup.Languages))
+	result.Findings = findings
+	result.Diagnostics = append(result.Diagnostics, suppressionDiagnostics...)
+
+	outcome.Result = result
+	for _, file := range validFiles {
+		outcome.Files = append(outcome.Files, relativeToProjectRoot(file, projectRoot))
 	}
 
-	return mcp.NewToolResultText(allOutput), nil
+	return outcome, nil
 }
 
-// discoverFiles discovers files to scan based on the path pattern
-func discoverFiles(path, languageFilter, projectRoot string) ([]string, error) {
+// discoverFiles discovers files to scan based on the path pattern, leaving out those filter
+// skips. With a nil filter only .git and context-sherpa's own directory are skipped.
+func discoverFiles(path, languageFilter, projectRoot string, filter *fileFilter) ([]string, error) {
 	var files []string
 
-	// Check if path is a direct file
-	if info, err := os.Stat(path); err == nil && !info.IsDir() {
-		// Resolve file path relative to project root for consistency
+	// Check if path is a direct file, relative to the project root
+	if info, err := os.Stat(resolvePathRelativeToProjectRoot(path, projectRoot)); err == nil && !info.IsDir() {
 		resolvedPath := resolvePathRelativeToProjectRoot(path, projectRoot)
 
 		// Apply language filter if specified
-		if languageFilter != "" && !matchesLanguage(resolvedPath, languageFilter) {
+		if languageFilter != "" && !filter.inLanguage(resolvedPath, languageFilter) {
 			return files, nil // Return empty slice if file doesn't match language filter
 		}
+		if filter.skipFile(resolvedPath) {
+			return files, nil
+		}
 		return []string{resolvedPath}, nil
 	}
 
@@ -451,13 +1046,19 @@ func discoverFiles(path, languageFilter, projectRoot string) ([]string, error) {
 				return err
 			}
 
-			// Skip directories
+			// Skip directories, and prune those the filter leaves out
 			if info.IsDir() {
+				if currentPath != searchRoot && filter.skipDir(currentPath) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 
 			// Apply language filter if specified
-			if languageFilter != "" && !matchesLanguage(currentPath, languageFilter) {
+			if languageFilter != "" && !filter.inLanguage(currentPath, languageFilter) {
+				return nil
+			}
+			if filter.skipFile(currentPath) {
 				return nil
 			}
 
@@ -468,29 +1069,28 @@ func discoverFiles(path, languageFilter, projectRoot string) ([]string, error) {
 		return files, err
 	}
 
-	// Check if it's a directory path
-	if info, err := os.Stat(path); err == nil && info.IsDir() {
-		// For directory check, we need to resolve the path first to handle project root override
-		resolvedPath := resolvePathRelativeToProjectRoot(path, projectRoot)
-
-		// Verify the resolved path is actually a directory
-		if resolvedInfo, err := os.Stat(resolvedPath); err != nil || !resolvedInfo.IsDir() {
-			// If resolved path doesn't exist or isn't a directory, fall back to original path
-			resolvedPath = path
-		}
-
+	// Check if it's a directory path, resolved against the project root rather than the
+	// working directory
+	resolvedPath := resolvePathRelativeToProjectRoot(path, projectRoot)
+	if info, err := os.Stat(resolvedPath); err == nil && info.IsDir() {
 		err := filepath.Walk(resolvedPath, func(currentPath string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
 
-			// Skip directories
+			// Skip directories, and prune those the filter leaves out
 			if info.IsDir() {
+				if currentPath != resolvedPath && filter.skipDir(currentPath) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 
 			// Apply language filter if specified
-			if languageFilter != "" && !matchesLanguage(currentPath, languageFilter) {
+			if languageFilter != "" && !filter.inLanguage(currentPath, languageFilter) {
+				return nil
+			}
+			if filter.skipFile(currentPath) {
 				return nil
 			}
 
@@ -501,95 +1101,18 @@ func discoverFiles(path, languageFilter, projectRoot string) ([]string, error) {
 		return files, err
 	}
 
-	// Handle glob patterns - walk project root directory and match patterns
-	searchRoot := projectRoot
-	if searchRoot == "" {
-		searchRoot = "."
+	// Anything else is a list of globs relative to the project root
+	if !isGlobPath(path) {
+		return files, nil
 	}
-
-	err := filepath.Walk(searchRoot, func(currentPath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
-
-		// Check if path matches the pattern
-		matched, err := filepath.Match(path, currentPath)
-		if err != nil {
-			return err
-		}
-
-		if matched {
-			// Apply language filter if specified
-			if languageFilter != "" && !matchesLanguage(currentPath, languageFilter) {
-				return nil
-			}
-			files = append(files, currentPath)
-		}
-
-		return nil
-	})
-
-	return files, err
-}
-
-// matchesLanguage checks if a file path matches the specified language
-func matchesLanguage(filePath, language string) bool {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	switch language {
-	case "go":
-		return ext == ".go"
-	case "python":
-		return ext == ".py"
-	case "javascript":
-		return ext == ".js"
-	case "typescript":
-		return ext == ".ts"
-	case "rust":
-		return ext == ".rs"
-	case "java":
-		return ext == ".java"
-	case "cpp", "c++":
-		return ext == ".cpp" || ext == ".cc" || ext == ".cxx"
-	case "c":
-		return ext == ".c" || ext == ".h"
-	default:
-		return false
-	}
-}
-
-// scanFileBatch scans a batch of files and returns combined results
-func scanFileBatch(files []string, sgconfigStr, projectRoot, sgPath string) (string, error) {
-	if len(files) == 0 {
-		return "[]", nil
-	}
-
-	// For now, scan all files in a single batch
-	// TODO: Implement batching for very large file lists
-	args := []string{"scan", "--config", sgconfigStr}
-	args = append(args, files...)
-	args = append(args, "--json")
-
-	cmd := exec.Command(sgPath, args...)
-	cmd.Dir = projectRoot
-	output, err := cmd.CombinedOutput()
+	patterns, err := parsePathPatterns(path, projectRoot)
 	if err != nil {
-		// ast-grep exits with non-zero status code if issues are found.
-		// We still want to parse the output.
-		verboseLog("scan_file: ast-grep command exited with error: %v", err)
+		return nil, err
 	}
-
-	// Log the actual ast-grep command output when verbose logging is enabled
-	verboseLog("scan_file: ast-grep command output: %s", string(output))
-
-	return string(output), nil
+	return discoverGlobFiles(patterns, languageFilter, projectRoot, filter)
 }
 
-func addOrUpdateRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (s *Server) addOrUpdateRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	ruleID, err := req.RequireString("rule_id")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
@@ -600,34 +1123,112 @@ func addOrUpdateRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	// Get the rule directory from sgconfig.yml
-	ruleDir, err := getRuleDir()
+	testFile, errResult := s.addRule(ctx, RuleSpec{
+		ID:              ruleID,
+		YAML:            ruleYAML,
+		ValidExamples:   req.GetStringSlice("valid_examples", nil),
+		InvalidExamples: req.GetStringSlice("invalid_examples", nil),
+		RuleDir:         req.GetString("rule_dir", ""),
+		Scope:           req.GetString("scope", ""),
+	})
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	if testFile == "" {
+		return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' was added or updated successfully.", ruleID)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' was added or updated successfully. Test cases were written to %s; run them with the 'run_rule_tests' tool.", ruleID, testFile)), nil
+}
+
+// addRule validates and saves a rule, and writes its test cases when it has examples.
+// It returns the test file written, if any. When the rule is not saved, or its tests are not,
+// the tool result describing why is returned instead.
+func (s *Server) addRule(ctx context.Context, spec RuleSpec) (string, *mcp.CallToolResult) {
+	projectRoot, err := s.findProjectRoot()
 	if err != nil {
 		// If sgconfig.yml doesn't exist, suggest using the initialize tool
 		if strings.Contains(err.Error(), "sgconfig.yml not found") {
-			return mcp.NewToolResultText(fmt.Sprintf("Error: %s. Please run the 'initialize_ast_grep' tool first to set up the project.", err.Error())), nil
+			return "", mcp.NewToolResultText(fmt.Sprintf("Error: %s. Please run the 'initialize_ast_grep' tool first to set up the project.", err.Error()))
 		}
-		return mcp.NewToolResultError(err.Error()), nil
+		return "", mcp.NewToolResultError(err.Error())
+	}
+	// The rule belongs to the sub-project holding the scope, or to the project itself
+	sgconfigPath, err := scopeConfig(projectRoot, spec.Scope)
+	if err != nil {
+		return "", mcp.NewToolResultError(err.Error())
 	}
 
-	ruleFile := fmt.Sprintf("%s/%s.yml", ruleDir, ruleID)
-	if err := os.WriteFile(ruleFile, []byte(ruleYAML), 0644); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error writing rule file: %v", err)), nil
+	// Never write a rule that would break every later scan
+	if err := s.validateRule(ctx, sgconfigPath, spec.YAML); err != nil {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Invalid rule '%s': %v", spec.ID, err))
+	}
+	// The rule is saved and found again by rule_id, while ast-grep and its test cases go by the
+	// id inside the YAML, so the two must agree
+	var rule AstGrepRule
+	if err := yaml.Unmarshal([]byte(spec.YAML), &rule); err != nil {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Invalid rule '%s': %v", spec.ID, err))
+	}
+	if rule.ID != spec.ID {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Invalid rule '%s': the rule YAML has id '%s'; rule_id must match it", spec.ID, rule.ID))
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' was added or updated successfully.", ruleID)), nil
+	// An existing rule is updated in place, wherever among the rule directories it lives
+	docs, _, err := loadRuleDocuments(sgconfigPath)
+	if err != nil {
+		return "", mcp.NewToolResultError(err.Error())
+	}
+	existing := findRuleDocument(docs, spec.ID)
+	if existing != nil && existing.shared {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Rule '%s' is defined in %s along with other rules; edit that file instead.", spec.ID, relativeToProjectRoot(existing.Path, projectRoot)))
+	}
+
+	var ruleFile string
+	if existing != nil && spec.RuleDir == "" {
+		ruleFile = existing.Path
+	} else {
+		ruleDir, err := ruleDirFor(sgconfigPath, spec.RuleDir)
+		if err != nil {
+			return "", mcp.NewToolResultError(err.Error())
+		}
+		ruleFile = filepath.Join(ruleDir, spec.ID+".yml")
+		if existing != nil && existing.Path != ruleFile {
+			return "", mcp.NewToolResultError(fmt.Sprintf("Rule '%s' already exists in %s; remove it before saving it to rule_dir '%s'.", spec.ID, relativeToProjectRoot(existing.Path, projectRoot), spec.RuleDir))
+		}
+		if err := os.MkdirAll(ruleDir, 0755); err != nil {
+			return "", mcp.NewToolResultError(fmt.Sprintf("Error creating rule directory: %v", err))
+		}
+	}
+
+	if err := os.WriteFile(ruleFile, []byte(spec.YAML), 0644); err != nil {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Error writing rule file: %v", err))
+	}
+
+	if len(spec.ValidExamples) == 0 && len(spec.InvalidExamples) == 0 {
+		return "", nil
+	}
+
+	testDir, err := ruleTestDir(sgconfigPath, true)
+	if err != nil {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Rule '%s' was saved, but its tests were not: %v", spec.ID, err))
+	}
+	testFile, err := writeRuleTestCase(testDir, rule.ID, spec.ValidExamples, spec.InvalidExamples)
+	if err != nil {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Rule '%s' was saved, but its tests were not: %v", spec.ID, err))
+	}
+	return testFile, nil
 }
 
 // findProjectRoot finds the project root by searching for sgconfig.yml
 // in the current and parent directories.
-func findProjectRoot() (string, error) {
+func (s *Server) findProjectRoot() (string, error) {
 	var dir string
 	var err error
 
-	if projectRootOverride != "" {
+	if s.projectRoot != "" {
 		// Use the specified project root as starting point
-		verboseLog("Using custom project root override: %s", projectRootOverride)
-		dir = projectRootOverride
+		s.logger.Debug("Using custom project root override", "projectRoot", s.projectRoot)
+		dir = s.projectRoot
 	} else {
 		// Fall back to current behavior
 		dir, err = os.Getwd()
@@ -653,11 +1254,12 @@ func findProjectRoot() (string, error) {
 	return "", fmt.Errorf("sgconfig.yml not found. Please run 'ast-grep new' to initialize an ast-grep project first")
 }
 
-func findAstGrepBinary(astGrepPath string) (string, error) {
+// findAstGrepBinary locates the ast-grep binary, preferring the configured path
+func (s *Server) findAstGrepBinary() (string, error) {
 	// 1. User explicitly specified path (highest priority)
-	if astGrepPath != "" {
+	if astGrepPath := s.astGrepPath; astGrepPath != "" {
 		if _, err := os.Stat(astGrepPath); err == nil {
-			verboseLog("Using user-specified ast-grep path: %s", astGrepPath)
+			s.logger.Debug("Using user-specified ast-grep path", "path", astGrepPath)
 			return astGrepPath, nil
 		}
 		return "", fmt.Errorf("ast-grep not found at specified path: %s", astGrepPath)
@@ -665,13 +1267,13 @@ func findAstGrepBinary(astGrepPath string) (string, error) {
 
 	// 2. System PATH (standard location)
 	if path, err := exec.LookPath("ast-grep"); err == nil {
-		verboseLog("Found ast-grep in PATH: %s", path)
+		s.logger.Debug("Found ast-grep in PATH", "path", path)
 		return path, nil
 	}
 
 	if runtime.GOOS == "windows" {
 		if path, err := exec.LookPath("ast-grep.exe"); err == nil {
-			verboseLog("Found ast-grep.exe in PATH: %s", path)
+			s.logger.Debug("Found ast-grep.exe in PATH", "path", path)
 			return path, nil
 		}
 	}
@@ -698,90 +1300,79 @@ Please ensure ast-grep is available in one of these ways:
    context-sherpa --astGrepPath="/path/to/ast-grep"`)
 }
 
-// getRuleDir determines the directory where rules should be stored by searching
-// for sgconfig.yml in the current and parent directories.
-func getRuleDir() (string, error) {
-	var dir string
-	var err error
-
-	if projectRootOverride != "" {
-		// Use the specified project root as starting point
-		verboseLog("Using custom project root override: %s", projectRootOverride)
-		dir = projectRootOverride
-	} else {
-		// Fall back to current behavior
-		dir, err = os.Getwd()
-		if err != nil {
-			return "", fmt.Errorf("could not get current directory: %v", err)
-		}
+func (s *Server) removeRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ruleID, err := req.RequireString("rule_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	for {
-		configPath := filepath.Join(dir, "sgconfig.yml")
-		if _, err := os.Stat(configPath); err == nil {
-			// Read and parse sgconfig.yml
-			data, err := os.ReadFile(configPath)
-			if err != nil {
-				return "", fmt.Errorf("error reading sgconfig.yml: %v", err)
-			}
-
-			var config SgConfig
-			if err := yaml.Unmarshal(data, &config); err != nil {
-				return "", fmt.Errorf("error parsing sgconfig.yml: %v", err)
-			}
-
-			if len(config.RuleDirs) == 0 {
-				return "", fmt.Errorf("ruleDirs not specified in sgconfig.yml")
-			}
-			// Return the first rule directory, relative to the config file's location
-			return filepath.Join(dir, strings.TrimSpace(config.RuleDirs[0])), nil
-		}
-
-		// Move to parent directory
-		parentDir := filepath.Dir(dir)
-		if parentDir == dir {
-			break // Reached root
-		}
-		dir = parentDir
+	removed, errResult := s.removeRule(ruleID, req.GetString("scope", ""))
+	if errResult != nil {
+		return errResult, nil
+	}
+	if !removed {
+		return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' not found.", ruleID)), nil
 	}
 
-	return "", fmt.Errorf("sgconfig.yml not found. Please run 'ast-grep new' to initialize an ast-grep project first")
+	return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' was removed successfully.", ruleID)), nil
 }
 
-func removeRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	ruleID, err := req.RequireString("rule_id")
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
-	}
-
-	// Get the rule directory from sgconfig.yml
-	ruleDir, err := getRuleDir()
+// removeRule deletes a rule of the project or of the sub-project holding scope, and its test
+// cases, reporting whether the rule existed. When the rule cannot be removed, the tool result
+// describing why is returned instead.
+func (s *Server) removeRule(ruleID, scope string) (bool, *mcp.CallToolResult) {
+	projectRoot, err := s.findProjectRoot()
 	if err != nil {
 		// If sgconfig.yml doesn't exist, suggest using the initialize tool
 		if strings.Contains(err.Error(), "sgconfig.yml not found") {
-			return mcp.NewToolResultText(fmt.Sprintf("Error: %s. Please run the 'initialize_ast_grep' tool first to set up the project.", err.Error())), nil
+			return false, mcp.NewToolResultText(fmt.Sprintf("Error: %s. Please run the 'initialize_ast_grep' tool first to set up the project.", err.Error()))
 		}
-		return mcp.NewToolResultError(err.Error()), nil
+		return false, mcp.NewToolResultError(err.Error())
+	}
+	sgconfigPath, err := scopeConfig(projectRoot, scope)
+	if err != nil {
+		return false, mcp.NewToolResultError(err.Error())
+	}
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		return false, mcp.NewToolResultError(err.Error())
 	}
 
-	ruleFile := fmt.Sprintf("%s/%s.yml", ruleDir, ruleID)
-	if err := os.Remove(ruleFile); err != nil {
+	// The rule may live in any of the rule directories
+	docs, _, err := loadRuleDocuments(sgconfigPath)
+	if err != nil {
+		return false, mcp.NewToolResultError(err.Error())
+	}
+	doc := findRuleDocument(docs, ruleID)
+	if doc == nil {
+		return false, nil
+	}
+	if doc.shared {
+		return false, mcp.NewToolResultError(fmt.Sprintf("Rule '%s' is defined in %s along with other rules; edit that file to remove it.", ruleID, relativeToProjectRoot(doc.Path, projectRoot)))
+	}
+	if err := os.Remove(doc.Path); err != nil {
 		if os.IsNotExist(err) {
-			return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' not found.", ruleID)), nil
+			return false, nil
 		}
-		return mcp.NewToolResultError(fmt.Sprintf("Error removing rule file: %v", err)), nil
+		return false, mcp.NewToolResultError(fmt.Sprintf("Error removing rule file: %v", err))
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' was removed successfully.", ruleID)), nil
+	// Remove the rule's test cases too, since ast-grep fails on tests for unknown rules
+	for _, testDir := range resolveConfigDirs(filepath.Dir(sgconfigPath), config.testDirs()) {
+		os.Remove(filepath.Join(testDir, ruleTestFileName(ruleID)))
+		os.Remove(filepath.Join(testDir, ruleTestFileName(doc.ID)))
+	}
+
+	return true, nil
 }
 
-func initializeAstGrepHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (s *Server) initializeAstGrepHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	// Determine the project root to use
 	var projectRoot string
 	var err error
 
-	if projectRootOverride != "" {
-		projectRoot = projectRootOverride
+	if s.projectRoot != "" {
+		projectRoot = s.projectRoot
 	} else {
 		projectRoot, err = os.Getwd()
 		if err != nil {
@@ -808,17 +1399,20 @@ func initializeAstGrepHandler(ctx context.Context, req mcp.CallToolRequest) (*mc
 }
 
 // fetchCommunityRuleIndex fetches and caches the community rule index
-func fetchCommunityRuleIndex() (*CommunityRuleIndex, error) {
+func (s *Server) fetchCommunityRuleIndex() (*CommunityRuleIndex, error) {
+	s.communityMu.Lock()
+	defer s.communityMu.Unlock()
+
 	// Check if we have a valid cached index
-	if communityRuleCache != nil && time.Since(cacheTimestamp) < cacheTTL {
-		verboseLog("Using cached community rule index")
-		return communityRuleCache, nil
+	if s.communityRuleCache != nil && time.Since(s.cacheTimestamp) < communityCacheTTL {
+		s.logger.Debug("Using cached community rule index")
+		return s.communityRuleCache, nil
 	}
 
-	verboseLog("Fetching community rule index from repository")
+	s.logger.Debug("Fetching community rule index", "url", s.communityIndexURL)
 
 	// Fetch the index.json file
-	resp, err := http.Get(getCommunityRulesRepoURL())
+	resp, err := s.httpClient.Get(s.communityIndexURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch community rule index: %v", err)
 	}
@@ -834,53 +1428,24 @@ func fetchCommunityRuleIndex() (*CommunityRuleIndex, error) {
 	}
 
 	// Update cache
-	communityRuleCache = &index
-	cacheTimestamp = time.Now()
+	s.communityRuleCache = &index
+	s.cacheTimestamp = time.Now()
 
-	verboseLog("Successfully loaded %d community rules", len(index.Rules))
+	s.logger.Debug("Loaded community rules", "rules", len(index.Rules))
 	return &index, nil
 }
 
-// initLogging initializes the logging system with support for verbose logging and log files
-func initLogging(verbose bool, logFilePath string) {
-	verboseLogging = verbose
-
-	var writers []io.Writer
-
-	// Always write to stdout/stderr
-	writers = append(writers, os.Stdout, os.Stderr)
-
-	// If log file is specified, append to it
-	if logFilePath != "" {
-		var err error
-		logFile, err = os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-		if err != nil {
-			log.Printf("Warning: Failed to open log file %s: %v", logFilePath, err)
-		} else {
-			writers = append(writers, logFile)
-		}
-	}
-
-	// Create multi-writer for logging
-	if len(writers) > 2 { // stdout + stderr + file
-		customLogger = log.New(io.MultiWriter(writers...), "", log.LstdFlags)
-	} else {
-		customLogger = log.New(io.MultiWriter(writers...), "", log.LstdFlags)
-	}
-
-	if verbose {
-		customLogger.Println("Verbose logging enabled")
-		if logFilePath != "" {
-			customLogger.Printf("Logging to file: %s", logFilePath)
-		}
+// communityRuleURL resolves the path of a community rule against the registry
+func (s *Server) communityRuleURL(rulePath string) (string, error) {
+	base, err := url.Parse(s.communityRulesURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid community rules URL: %v", err)
 	}
-}
-
-// verboseLog logs a message only if verbose logging is enabled
-func verboseLog(format string, v ...interface{}) {
-	if verboseLogging && customLogger != nil {
-		customLogger.Printf(format, v...)
+	ref, err := url.Parse(rulePath)
+	if err != nil {
+		return "", fmt.Errorf("invalid rule path '%s': %v", rulePath, err)
 	}
+	return base.ResolveReference(ref).String(), nil
 }
 
 // resolvePathRelativeToProjectRoot resolves a user-provided path relative to the project root.
@@ -899,16 +1464,11 @@ func resolvePathRelativeToProjectRoot(path, projectRoot string) string {
 	}
 
 	// Resolve relative path against project root
-	resolvedPath := filepath.Join(projectRoot, path)
-
-	// Add verbose logging for debugging
-	verboseLog("resolvePathRelativeToProjectRoot: '%s' resolved to '%s' (projectRoot: '%s')", path, resolvedPath, projectRoot)
-
-	return resolvedPath
+	return filepath.Join(projectRoot, path)
 }
 
 // searchCommunityRulesHandler handles the search_community_rules tool
-func searchCommunityRulesHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (s *Server) searchCommunityRulesHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	query, err := req.RequireString("query")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
@@ -933,7 +1493,7 @@ func searchCommunityRulesHandler(ctx context.Context, req mcp.CallToolRequest) (
 	}
 
 	// Fetch the community rule index
-	index, err := fetchCommunityRuleIndex()
+	index, err := s.fetchCommunityRuleIndex()
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to fetch community rules: %v", err)), nil
 	}
@@ -1016,14 +1576,14 @@ func searchCommunityRulesHandler(ctx context.Context, req mcp.CallToolRequest) (
 }
 
 // getCommunityRuleDetailsHandler handles the get_community_rule_details tool
-func getCommunityRuleDetailsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (s *Server) getCommunityRuleDetailsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	ruleID, err := req.RequireString("rule_id")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
 	// Fetch the community rule index
-	index, err := fetchCommunityRuleIndex()
+	index, err := s.fetchCommunityRuleIndex()
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to fetch community rules: %v", err)), nil
 	}
@@ -1042,8 +1602,11 @@ func getCommunityRuleDetailsHandler(ctx context.Context, req mcp.CallToolRequest
 	}
 
 	// Fetch the actual rule YAML content
-	ruleURL := fmt.Sprintf("https://raw.githubusercontent.com/hackafterdark/context-sherpa-community-rules/main/%s", foundRule.Path)
-	resp, err := http.Get(ruleURL)
+	ruleURL, err := s.communityRuleURL(foundRule.Path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to fetch rule content: %v", err)), nil
+	}
+	resp, err := s.httpClient.Get(ruleURL)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to fetch rule content: %v", err)), nil
 	}
@@ -1054,25 +1617,9 @@ func getCommunityRuleDetailsHandler(ctx context.Context, req mcp.CallToolRequest
 	}
 
 	// Read the YAML content
-	var buf []byte
-	if resp.ContentLength > 0 {
-		buf = make([]byte, resp.ContentLength)
-	} else {
-		// Read in chunks if ContentLength is unknown
-		chunkSize := 1024
-		buffer := make([]byte, chunkSize)
-		for {
-			n, err := resp.Body.Read(buffer)
-			if n > 0 {
-				buf = append(buf, buffer[:n]...)
-			}
-			if err != nil {
-				if err.Error() == "EOF" {
-					break
-				}
-				return mcp.NewToolResultError(fmt.Sprintf("Failed to read rule content: %v", err)), nil
-			}
-		}
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read rule content: %v", err)), nil
 	}
 
 	yamlContent := string(buf)
@@ -1095,14 +1642,14 @@ func getCommunityRuleDetailsHandler(ctx context.Context, req mcp.CallToolRequest
 }
 
 // importCommunityRuleHandler handles the import_community_rule tool
-func importCommunityRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (s *Server) importCommunityRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	ruleID, err := req.RequireString("rule_id")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
 	// Fetch the community rule index
-	index, err := fetchCommunityRuleIndex()
+	index, err := s.fetchCommunityRuleIndex()
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to fetch community rules: %v", err)), nil
 	}
@@ -1121,8 +1668,11 @@ func importCommunityRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*
 	}
 
 	// Fetch the actual rule YAML content
-	ruleURL := fmt.Sprintf("https://raw.githubusercontent.com/hackafterdark/context-sherpa-community-rules/main/%s", foundRule.Path)
-	resp, err := http.Get(ruleURL)
+	ruleURL, err := s.communityRuleURL(foundRule.Path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to fetch rule content: %v", err)), nil
+	}
+	resp, err := s.httpClient.Get(ruleURL)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to fetch rule content: %v", err)), nil
 	}
@@ -1132,72 +1682,83 @@ func importCommunityRuleHandler(ctx context.Context, req mcp.CallToolRequest) (*
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to fetch rule content: HTTP %d", resp.StatusCode)), nil
 	}
 
-	// Read the YAML content
-	var buf []byte
-	if resp.ContentLength > 0 {
-		buf = make([]byte, resp.ContentLength)
-	} else {
-		// Read in chunks if ContentLength is unknown
-		chunkSize := 1024
-		buffer := make([]byte, chunkSize)
-		for {
-			n, err := resp.Body.Read(buffer)
-			if n > 0 {
-				buf = append(buf, buffer[:n]...)
-			}
-			if err != nil {
-				if err.Error() == "EOF" {
-					break
-				}
-				return mcp.NewToolResultError(fmt.Sprintf("Failed to read rule content: %v", err)), nil
-			}
-		}
+	// Read the rule content
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read rule content: %v", err)), nil
 	}
 
-	yamlContent := string(buf)
-
-	// Validate the YAML content before writing to disk
-	if err := validateAstGrepRule(yamlContent); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Invalid rule file for '%s': %v", ruleID, err)), nil
+	// The rule's tool selects the analyzer that installs it; rules without one are ast-grep rules
+	toolName := foundRule.Tool
+	if toolName == "" {
+		toolName = AstGrepAnalyzerName
+	}
+	var importer RuleImporter
+	for _, analyzer := range s.analyzers("") {
+		if ri, ok := analyzer.(RuleImporter); ok && analyzer.Name() == toolName {
+			importer = ri
+			break
+		}
+	}
+	if importer == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Rule '%s' is for '%s', which is not an enabled analyzer that can import rules.", ruleID, toolName)), nil
 	}
 
-	// Get the rule directory and save the file
-	ruleDir, err := getRuleDir()
+	projectRoot, err := s.findProjectRoot()
 	if err != nil {
 		if strings.Contains(err.Error(), "sgconfig.yml not found") {
 			return mcp.NewToolResultText(fmt.Sprintf("Error: %s. Please run the 'initialize_ast_grep' tool first to set up the project.", err.Error())), nil
 		}
 		return mcp.NewToolResultError(err.Error()), nil
 	}
+	project := Project{Root: projectRoot, SgconfigPath: filepath.Join(projectRoot, "sgconfig.yml")}
 
 	// Extract just the filename from the path
 	pathParts := strings.Split(foundRule.Path, "/")
 	filename := pathParts[len(pathParts)-1]
-	ruleFile := filepath.Join(ruleDir, filename)
 
-	if err := os.WriteFile(ruleFile, []byte(yamlContent), 0644); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Error writing rule file: %v", err)), nil
+	ruleFile, err := importer.ImportRule(ctx, project, filename, buf)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to import rule '%s': %v", ruleID, err)), nil
 	}
 
 	return mcp.NewToolResultText(fmt.Sprintf("Rule '%s' was imported successfully from the community repository to %s.", ruleID, ruleFile)), nil
 }
 
 // validateAstGrepRule checks if the given YAML content is a valid ast-grep rule.
-// It ensures the YAML is well-formed and contains the essential fields 'id', 'language', and 'rule'.
+// It ensures the YAML is well-formed, contains the essential fields 'id', 'language', and 'rule',
+// and uses no unknown keys. Problems are reported with their line numbers.
 func validateAstGrepRule(yamlContent string) error {
+	root, err := parseRuleYAML(yamlContent)
+	if err != nil {
+		return err
+	}
+
 	var rule AstGrepRule
-	if err := yaml.Unmarshal([]byte(yamlContent), &rule); err != nil {
+	if err := root.Decode(&rule); err != nil {
 		return fmt.Errorf("could not parse YAML: %v", err)
 	}
 
 	// Check for the presence of required fields.
-	// The 'Rule' field is checked by its presence in the struct, but we ensure others are not empty.
 	if rule.ID == "" {
 		return fmt.Errorf("rule 'id' is missing or empty")
 	}
 	if rule.Language == "" {
 		return fmt.Errorf("rule 'language' is missing or empty")
 	}
+	hasRule := false
+	for i := 0; i < len(root.Content); i += 2 {
+		if root.Content[i].Value == "rule" {
+			hasRule = true
+		}
+	}
+	if !hasRule {
+		return fmt.Errorf("rule 'rule' is missing")
+	}
+
+	if problems := checkRuleKeys(root); len(problems) > 0 {
+		return &ruleValidationError{Problems: problems}
+	}
 
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -379,12 +380,7 @@ func TestSearchCommunityRulesHandler(t *testing.T) {
 			defer server.Close()
 
 			// Temporarily override the community rules repo URL for testing
-			originalRepo := communityRulesRepo
-			communityRulesRepo = server.URL
-			defer func() { communityRulesRepo = originalRepo }()
-
-			// Clear cache for consistent testing
-			communityRuleCache = nil
+			s := NewServer(Options{CommunityIndexURL: server.URL})
 
 			// Create test request
 			arguments := map[string]interface{}{
@@ -404,7 +400,7 @@ func TestSearchCommunityRulesHandler(t *testing.T) {
 			}
 
 			// Call the handler
-			result, err := searchCommunityRulesHandler(context.Background(), req)
+			result, err := s.searchCommunityRulesHandler(context.Background(), req)
 
 			// Assertions
 			if err != nil {
@@ -455,12 +451,7 @@ func TestSearchCommunityRulesHandlerErrors(t *testing.T) {
 			server := httptest.NewServer(http.HandlerFunc(tt.serverFunc))
 			defer server.Close()
 
-			originalRepo := communityRulesRepo
-			communityRulesRepo = server.URL
-			defer func() { communityRulesRepo = originalRepo }()
-
-			// Clear cache
-			communityRuleCache = nil
+			s := NewServer(Options{CommunityIndexURL: server.URL})
 
 			req := mcp.CallToolRequest{
 				Params: mcp.CallToolParams{
@@ -470,7 +461,7 @@ func TestSearchCommunityRulesHandlerErrors(t *testing.T) {
 				},
 			}
 
-			result, err := searchCommunityRulesHandler(context.Background(), req)
+			result, err := s.searchCommunityRulesHandler(context.Background(), req)
 
 			if err != nil {
 				t.Fatalf("Handler returned an unexpected error: %v", err)
@@ -513,12 +504,7 @@ func TestGetCommunityRuleDetailsHandler(t *testing.T) {
 		defer ruleServer.Close()
 
 		// Override URLs for testing
-		originalRepo := communityRulesRepo
-		communityRulesRepo = indexServer.URL
-		defer func() { communityRulesRepo = originalRepo }()
-
-		// Clear cache
-		communityRuleCache = nil
+		s := NewServer(Options{CommunityIndexURL: indexServer.URL, CommunityRulesURL: ruleServer.URL + "/"})
 
 		req := mcp.CallToolRequest{
 			Params: mcp.CallToolParams{
@@ -528,7 +514,7 @@ func TestGetCommunityRuleDetailsHandler(t *testing.T) {
 			},
 		}
 
-		result, err := getCommunityRuleDetailsHandler(context.Background(), req)
+		result, err := s.getCommunityRuleDetailsHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
@@ -556,11 +542,7 @@ func TestGetCommunityRuleDetailsHandler(t *testing.T) {
 		}))
 		defer server.Close()
 
-		originalRepo := communityRulesRepo
-		communityRulesRepo = server.URL
-		defer func() { communityRulesRepo = originalRepo }()
-
-		communityRuleCache = nil
+		s := NewServer(Options{CommunityIndexURL: server.URL})
 
 		req := mcp.CallToolRequest{
 			Params: mcp.CallToolParams{
@@ -570,7 +552,7 @@ func TestGetCommunityRuleDetailsHandler(t *testing.T) {
 			},
 		}
 
-		result, err := getCommunityRuleDetailsHandler(context.Background(), req)
+		result, err := s.getCommunityRuleDetailsHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
@@ -596,14 +578,9 @@ func TestFetchCommunityRuleIndex(t *testing.T) {
 		}))
 		defer server.Close()
 
-		originalRepo := communityRulesRepo
-		communityRulesRepo = server.URL
-		defer func() { communityRulesRepo = originalRepo }()
-
-		// Clear cache before this test
-		communityRuleCache = nil
+		s := NewServer(Options{CommunityIndexURL: server.URL})
 
-		index, err := fetchCommunityRuleIndex()
+		index, err := s.fetchCommunityRuleIndex()
 
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
@@ -626,21 +603,16 @@ func TestFetchCommunityRuleIndex(t *testing.T) {
 		}))
 		defer server.Close()
 
-		originalRepo := communityRulesRepo
-		communityRulesRepo = server.URL
-		defer func() { communityRulesRepo = originalRepo }()
-
-		// Clear cache before this test
-		communityRuleCache = nil
+		s := NewServer(Options{CommunityIndexURL: server.URL})
 
 		// First fetch
-		index1, err := fetchCommunityRuleIndex()
+		index1, err := s.fetchCommunityRuleIndex()
 		if err != nil {
 			t.Fatalf("First fetch failed: %v", err)
 		}
 
 		// Second fetch should use cache
-		index2, err := fetchCommunityRuleIndex()
+		index2, err := s.fetchCommunityRuleIndex()
 		if err != nil {
 			t.Fatalf("Second fetch failed: %v", err)
 		}
@@ -654,6 +626,7 @@ func TestFetchCommunityRuleIndex(t *testing.T) {
 // scan_path Tool Tests
 
 func TestScanPathHandler(t *testing.T) {
+	s := NewServer(Options{})
 	// Create a temporary directory for testing
 	tempDir := t.TempDir()
 
@@ -731,7 +704,7 @@ func test() {
 			},
 		}
 
-		result, err := scanPathHandler(context.Background(), req)
+		result, err := s.scanPathHandler(context.Background(), req)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -756,7 +729,7 @@ func test() {
 			},
 		}
 
-		result, err := scanPathHandler(context.Background(), req)
+		result, err := s.scanPathHandler(context.Background(), req)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -777,7 +750,7 @@ func test() {
 			},
 		}
 
-		result, err := scanPathHandler(context.Background(), req)
+		result, err := s.scanPathHandler(context.Background(), req)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -797,7 +770,7 @@ func test() {
 			},
 		}
 
-		result, err := scanPathHandler(context.Background(), req)
+		result, err := s.scanPathHandler(context.Background(), req)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -817,7 +790,7 @@ func test() {
 			},
 		}
 
-		result, err := scanPathHandler(context.Background(), req)
+		result, err := s.scanPathHandler(context.Background(), req)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -840,7 +813,7 @@ func test() {
 			},
 		}
 
-		result, err := scanPathHandler(context.Background(), req)
+		result, err := s.scanPathHandler(context.Background(), req)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -863,7 +836,7 @@ func test() {
 			},
 		}
 
-		result, err := scanPathHandler(context.Background(), req)
+		result, err := s.scanPathHandler(context.Background(), req)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -901,9 +874,9 @@ func TestMatchesLanguage(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.filePath+"_"+tt.language, func(t *testing.T) {
-			result := matchesLanguage(tt.filePath, tt.language)
+			result := defaultLanguages.matches(tt.filePath, tt.language)
 			if result != tt.expected {
-				t.Errorf("matchesLanguage(%s, %s) = %v, expected %v", tt.filePath, tt.language, result, tt.expected)
+				t.Errorf("matches(%s, %s) = %v, expected %v", tt.filePath, tt.language, result, tt.expected)
 			}
 		})
 	}
@@ -930,7 +903,7 @@ func TestDiscoverFiles(t *testing.T) {
 
 	// Test Case 1: Single file
 	t.Run("Single file", func(t *testing.T) {
-		files, err := discoverFiles("test1.go", "", "")
+		files, err := discoverFiles("test1.go", "", "", nil)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -946,7 +919,7 @@ func TestDiscoverFiles(t *testing.T) {
 
 	// Test Case 2: Directory scan
 	t.Run("Directory scan", func(t *testing.T) {
-		files, err := discoverFiles(".", "", "")
+		files, err := discoverFiles(".", "", "", nil)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -959,7 +932,7 @@ func TestDiscoverFiles(t *testing.T) {
 
 	// Test Case 3: Language filtering
 	t.Run("Language filtering", func(t *testing.T) {
-		files, err := discoverFiles(".", "go", "")
+		files, err := discoverFiles(".", "go", "", nil)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -972,7 +945,7 @@ func TestDiscoverFiles(t *testing.T) {
 
 	// Test Case 4: Non-existent file
 	t.Run("Non-existent file", func(t *testing.T) {
-		files, err := discoverFiles("nonexistent.go", "", "")
+		files, err := discoverFiles("nonexistent.go", "", "", nil)
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
@@ -987,6 +960,7 @@ func TestDiscoverFiles(t *testing.T) {
 // Benchmark tests for performance comparison
 
 func BenchmarkScanPathHandler(b *testing.B) {
+	s := NewServer(Options{})
 	// Create a temporary directory for benchmarking
 	tempDir := b.TempDir()
 
@@ -1039,7 +1013,7 @@ func main() {
 			},
 		}
 
-		_, err := scanPathHandler(context.Background(), req)
+		_, err := s.scanPathHandler(context.Background(), req)
 		if err != nil {
 			b.Fatalf("scanFileHandler failed: %v", err)
 		}
@@ -1078,7 +1052,7 @@ func main() {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		_, err := discoverFiles(".", "go", "")
+		_, err := discoverFiles(".", "go", "", nil)
 		if err != nil {
 			b.Fatalf("discoverFiles failed: %v", err)
 		}
@@ -1101,7 +1075,7 @@ func BenchmarkMatchesLanguage(b *testing.B) {
 
 	for i := 0; i < b.N; i++ {
 		for _, tc := range testCases {
-			matchesLanguage(tc.filePath, tc.language)
+			defaultLanguages.matches(tc.filePath, tc.language)
 		}
 	}
 }
@@ -1109,6 +1083,7 @@ func BenchmarkMatchesLanguage(b *testing.B) {
 // Tests for functions with 0% coverage
 
 func TestStartFunction(t *testing.T) {
+	s := NewServer(Options{})
 	t.Run("Start function initializes server", func(t *testing.T) {
 		// Test that Start function doesn't panic with valid parameters
 		// Since Start starts a server that runs indefinitely, we need to be careful
@@ -1119,7 +1094,7 @@ func TestStartFunction(t *testing.T) {
 
 		// Test that we can call extractSgBinary (simulating what Start does)
 		// Note: This will fail in test environment without actual binary
-		_, err := findAstGrepBinary("")
+		_, err := s.findAstGrepBinary()
 		if err == nil {
 			t.Log("extractSgBinary succeeded in test environment")
 		}
@@ -1127,6 +1102,7 @@ func TestStartFunction(t *testing.T) {
 }
 
 func TestScanCodeHandler(t *testing.T) {
+	s := NewServer(Options{})
 	t.Run("Valid scan request", func(t *testing.T) {
 		req := mcp.CallToolRequest{
 			Params: mcp.CallToolParams{
@@ -1141,7 +1117,7 @@ func TestScanCodeHandler(t *testing.T) {
 		// But we can at least verify the handler doesn't panic on valid input
 		// and returns appropriate error for missing config
 
-		result, err := scanCodeHandler(context.Background(), req)
+		result, err := s.scanCodeHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1166,7 +1142,7 @@ func TestScanCodeHandler(t *testing.T) {
 			},
 		}
 
-		result, err := scanCodeHandler(context.Background(), req)
+		result, err := s.scanCodeHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1186,7 +1162,7 @@ func TestScanCodeHandler(t *testing.T) {
 			},
 		}
 
-		result, err := scanCodeHandler(context.Background(), req)
+		result, err := s.scanCodeHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1199,6 +1175,7 @@ func TestScanCodeHandler(t *testing.T) {
 }
 
 func TestAddOrUpdateRuleHandler(t *testing.T) {
+	s := NewServer(Options{})
 	t.Run("Valid rule creation", func(t *testing.T) {
 		req := mcp.CallToolRequest{
 			Params: mcp.CallToolParams{
@@ -1215,7 +1192,7 @@ message: "Test rule"`,
 
 		// This will fail due to missing sgconfig.yml, but we can test
 		// that the handler processes the input correctly
-		result, err := addOrUpdateRuleHandler(context.Background(), req)
+		result, err := s.addOrUpdateRuleHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1235,7 +1212,7 @@ message: "Test rule"`,
 			},
 		}
 
-		result, err := addOrUpdateRuleHandler(context.Background(), req)
+		result, err := s.addOrUpdateRuleHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1255,7 +1232,7 @@ message: "Test rule"`,
 			},
 		}
 
-		result, err := addOrUpdateRuleHandler(context.Background(), req)
+		result, err := s.addOrUpdateRuleHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1268,6 +1245,7 @@ message: "Test rule"`,
 }
 
 func TestRemoveRuleHandler(t *testing.T) {
+	s := NewServer(Options{})
 	t.Run("Valid rule removal", func(t *testing.T) {
 		req := mcp.CallToolRequest{
 			Params: mcp.CallToolParams{
@@ -1277,7 +1255,7 @@ func TestRemoveRuleHandler(t *testing.T) {
 			},
 		}
 
-		result, err := removeRuleHandler(context.Background(), req)
+		result, err := s.removeRuleHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1295,7 +1273,7 @@ func TestRemoveRuleHandler(t *testing.T) {
 			},
 		}
 
-		result, err := removeRuleHandler(context.Background(), req)
+		result, err := s.removeRuleHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1308,6 +1286,7 @@ func TestRemoveRuleHandler(t *testing.T) {
 }
 
 func TestInitializeAstGrepHandler(t *testing.T) {
+	s := NewServer(Options{})
 	t.Run("Initialize project", func(t *testing.T) {
 		// Create a temporary directory for this test
 		tempDir := t.TempDir()
@@ -1329,7 +1308,7 @@ func TestInitializeAstGrepHandler(t *testing.T) {
 			},
 		}
 
-		result, err := initializeAstGrepHandler(context.Background(), req)
+		result, err := s.initializeAstGrepHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1421,29 +1400,15 @@ rule:
 
 func TestGetRuleDir(t *testing.T) {
 	t.Run("Get rule directory without config", func(t *testing.T) {
-		// Create a temporary directory for this test
-		tempDir := t.TempDir()
-
-		// Change to temp directory for testing
-		originalDir, err := os.Getwd()
-		if err != nil {
-			t.Fatalf("Failed to get current directory: %v", err)
-		}
-		defer os.Chdir(originalDir)
-
-		if err := os.Chdir(tempDir); err != nil {
-			t.Fatalf("Failed to change directory: %v", err)
-		}
-
 		// This should fail because there's no sgconfig.yml
-		_, err = getRuleDir()
-		if err == nil {
-			t.Error("Expected getRuleDir to fail without sgconfig.yml")
+		if _, err := ruleDirFor(filepath.Join(t.TempDir(), "sgconfig.yml"), ""); err == nil {
+			t.Error("Expected ruleDirFor to fail without sgconfig.yml")
 		}
 	})
 }
 
 func TestFindProjectRoot(t *testing.T) {
+	s := NewServer(Options{})
 	t.Run("Find project root without config", func(t *testing.T) {
 		// Create a temporary directory for this test
 		tempDir := t.TempDir()
@@ -1460,7 +1425,7 @@ func TestFindProjectRoot(t *testing.T) {
 		}
 
 		// This should fail because there's no sgconfig.yml
-		_, err = findProjectRoot()
+		_, err = s.findProjectRoot()
 		if err == nil {
 			t.Error("Expected findProjectRoot to fail without sgconfig.yml")
 		}
@@ -1468,11 +1433,12 @@ func TestFindProjectRoot(t *testing.T) {
 }
 
 func TestFindSgBinary(t *testing.T) {
+	s := NewServer(Options{})
 	t.Run("Find binary on current system", func(t *testing.T) {
 		// Test that extractSgBinary doesn't panic
 		// In test environment, this will likely fail to find the binary
 		// but should not panic
-		path, err := findAstGrepBinary("")
+		path, err := s.findAstGrepBinary()
 
 		// We expect this to fail in test environment since we don't have ast-grep installed
 		// The important thing is that it doesn't panic
@@ -1485,6 +1451,7 @@ func TestFindSgBinary(t *testing.T) {
 }
 
 func TestImportCommunityRuleHandler(t *testing.T) {
+	s := NewServer(Options{})
 	t.Run("Valid import request", func(t *testing.T) {
 		req := mcp.CallToolRequest{
 			Params: mcp.CallToolParams{
@@ -1496,7 +1463,7 @@ func TestImportCommunityRuleHandler(t *testing.T) {
 
 		// This will fail due to missing sgconfig.yml, but we can test
 		// that the handler processes the input correctly
-		result, err := importCommunityRuleHandler(context.Background(), req)
+		result, err := s.importCommunityRuleHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
@@ -1514,7 +1481,7 @@ func TestImportCommunityRuleHandler(t *testing.T) {
 			},
 		}
 
-		result, err := importCommunityRuleHandler(context.Background(), req)
+		result, err := s.importCommunityRuleHandler(context.Background(), req)
 
 		if err != nil {
 			t.Fatalf("Expected no error from handler, got: %v", err)
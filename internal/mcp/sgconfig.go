@@ -0,0 +1,304 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// SgConfig represents the structure of sgconfig.yml. Every key ast-grep reads is modeled, so
+// get_config can report the whole configuration.
+type SgConfig struct {
+	// RuleDirs are the directories holding the rules, relative to the config file
+	RuleDirs    []string     `yaml:"ruleDirs" json:"rule_dirs"`
+	TestConfigs []TestConfig `yaml:"testConfigs" json:"test_configs,omitempty"`
+	// UtilDirs are the directories holding utility rules shared by the rules, relative to the
+	// config file
+	UtilDirs []string `yaml:"utilDirs,omitempty" json:"util_dirs,omitempty"`
+	// LanguageGlobs maps a language to globs of files parsed as that language whatever their
+	// extension, e.g. html: ["*.vue"]
+	LanguageGlobs map[string][]string `yaml:"languageGlobs,omitempty" json:"language_globs,omitempty"`
+	// CustomLanguages declares tree-sitter languages loaded from dynamic libraries, by name
+	CustomLanguages map[string]CustomLanguage `yaml:"customLanguages,omitempty" json:"custom_languages,omitempty"`
+	// LanguageInjections parses parts of files in another language, such as CSS in JavaScript
+	LanguageInjections []LanguageInjection `yaml:"languageInjections,omitempty" json:"language_injections,omitempty"`
+	// GoAnalysis configures the go/analysis passes; it is read by context-sherpa only
+	GoAnalysis *GoAnalysisConfig `yaml:"goAnalysis,omitempty" json:"go_analysis,omitempty"`
+}
+
+// TestConfig is an entry of the testConfigs list in sgconfig.yml
+type TestConfig struct {
+	TestDir     string `yaml:"testDir" json:"test_dir"`
+	SnapshotDir string `yaml:"snapshotDir,omitempty" json:"snapshot_dir,omitempty"`
+}
+
+// CustomLanguage is an entry of the customLanguages map in sgconfig.yml
+type CustomLanguage struct {
+	// LibraryPath is the tree-sitter dynamic library, relative to the config file
+	LibraryPath    LibraryPath `yaml:"libraryPath" json:"library_path"`
+	Extensions     []string    `yaml:"extensions" json:"extensions"`
+	ExpandoChar    string      `yaml:"expandoChar,omitempty" json:"expando_char,omitempty"`
+	LanguageSymbol string      `yaml:"languageSymbol,omitempty" json:"language_symbol,omitempty"`
+}
+
+// LibraryPath is the libraryPath of a custom language: either a single path, or a path per
+// target triple
+type LibraryPath struct {
+	Path    string            `json:"path,omitempty"`
+	Targets map[string]string `json:"targets,omitempty"`
+}
+
+// UnmarshalYAML accepts both forms of libraryPath
+func (p *LibraryPath) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&p.Path)
+	}
+	return value.Decode(&p.Targets)
+}
+
+// LanguageInjection is an entry of the languageInjections list in sgconfig.yml. The rule and
+// injected languages are kept as written.
+type LanguageInjection struct {
+	HostLanguage string                 `yaml:"hostLanguage" json:"host_language"`
+	Rule         map[string]interface{} `yaml:"rule" json:"rule"`
+	// Injected is a language name, or a list of candidate languages
+	Injected interface{} `yaml:"injected" json:"injected"`
+}
+
+// readSgConfig parses the sgconfig.yml at the given path
+func readSgConfig(sgconfigPath string) (*SgConfig, error) {
+	data, err := os.ReadFile(sgconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", sgconfigPath, err)
+	}
+
+	var config SgConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", sgconfigPath, err)
+	}
+	return &config, nil
+}
+
+// resolveConfigDirs resolves directories listed in sgconfig.yml against configDir, the
+// directory holding it, dropping blank entries
+func resolveConfigDirs(configDir string, dirs []string) []string {
+	var resolved []string
+	for _, dir := range dirs {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			resolved = append(resolved, filepath.Join(configDir, dir))
+		}
+	}
+	return resolved
+}
+
+// ruleDirFor returns the directory a rule is saved in: the ruleDirs entry named by ruleDir, or
+// the first entry when ruleDir is empty
+func ruleDirFor(sgconfigPath, ruleDir string) (string, error) {
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		return "", err
+	}
+
+	configDir := filepath.Dir(sgconfigPath)
+	dirs := resolveConfigDirs(configDir, config.RuleDirs)
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("ruleDirs not specified in %s", filepath.Base(sgconfigPath))
+	}
+	if ruleDir == "" {
+		return dirs[0], nil
+	}
+
+	wanted := filepath.Join(configDir, strings.TrimSpace(ruleDir))
+	for _, dir := range dirs {
+		if dir == wanted {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("rule_dir '%s' is not one of the ruleDirs in %s (%s)", ruleDir, filepath.Base(sgconfigPath), strings.Join(config.RuleDirs, ", "))
+}
+
+// testDirs returns the configured test directories, in order
+func (c *SgConfig) testDirs() []string {
+	var dirs []string
+	for _, testConfig := range c.TestConfigs {
+		dirs = append(dirs, testConfig.TestDir)
+	}
+	return dirs
+}
+
+// ConfigDir is a directory listed in sgconfig.yml
+type ConfigDir struct {
+	// Path is the entry as written in sgconfig.yml
+	Path string `json:"path"`
+	// Resolved is the directory relative to the project root
+	Resolved string `json:"resolved"`
+	Exists   bool   `json:"exists"`
+	// Files counts the YAML files under the directory
+	Files int `json:"files"`
+}
+
+// ProjectConfig is the document returned by the get_config tool: the sgconfig.yml of the
+// project with its directories resolved, the languages and analyzers it enables, and the
+// problems found in it
+type ProjectConfig struct {
+	ProjectRoot string `json:"project_root"`
+	// Sgconfig is the configuration file, relative to the project root
+	Sgconfig           string                    `json:"sgconfig"`
+	RuleDirs           []ConfigDir               `json:"rule_dirs"`
+	UtilDirs           []ConfigDir               `json:"util_dirs"`
+	TestDirs           []ConfigDir               `json:"test_dirs"`
+	LanguageGlobs      map[string][]string       `json:"language_globs,omitempty"`
+	CustomLanguages    map[string]CustomLanguage `json:"custom_languages,omitempty"`
+	LanguageInjections []LanguageInjection       `json:"language_injections,omitempty"`
+	GoAnalysis         *GoAnalysisConfig         `json:"go_analysis,omitempty"`
+	// SubProjects lists the sgconfig.yml files below this one, relative to the project root.
+	// Scans apply their rules, rather than these, to the files under them.
+	SubProjects []string `json:"sub_projects"`
+	// Languages lists the languages rules may be written in
+	Languages []string `json:"languages"`
+	// Analyzers lists the analyzers a scan runs when it names none
+	Analyzers   []string     `json:"analyzers"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// describeConfigDirs resolves the directories listed under key, warning about missing ones
+func describeConfigDirs(key, configDir, projectRoot string, entries []string) ([]ConfigDir, []Diagnostic) {
+	dirs := []ConfigDir{}
+	var diagnostics []Diagnostic
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		path := filepath.Join(configDir, strings.TrimSpace(entry))
+		dir := ConfigDir{Path: entry, Resolved: relativeToProjectRoot(path, projectRoot)}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dir.Exists = true
+			filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() && isRuleFile(file) {
+					dir.Files++
+				}
+				return nil
+			})
+		} else {
+			diagnostics = append(diagnostics, Diagnostic{
+				Level:   DiagnosticWarning,
+				Source:  "context-sherpa",
+				Message: fmt.Sprintf("%s entry '%s' is not a directory", key, entry),
+			})
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, diagnostics
+}
+
+// projectConfig reads and resolves the sgconfig.yml at sgconfigPath of the project rooted at
+// projectRoot
+func (s *Server) projectConfig(projectRoot, sgconfigPath string) (*ProjectConfig, error) {
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	configDir := filepath.Dir(sgconfigPath)
+	result := &ProjectConfig{
+		ProjectRoot:        projectRoot,
+		Sgconfig:           relativeToProjectRoot(sgconfigPath, projectRoot),
+		LanguageGlobs:      config.LanguageGlobs,
+		CustomLanguages:    config.CustomLanguages,
+		LanguageInjections: config.LanguageInjections,
+		GoAnalysis:         config.GoAnalysis,
+		Languages:          newLanguageRegistry(config).names(),
+		Analyzers:          analyzerNames(defaultAnalyzers(s.analyzers(""), sgconfigPath)),
+		SubProjects:        []string{},
+		Diagnostics:        []Diagnostic{},
+	}
+
+	var diagnostics []Diagnostic
+	result.RuleDirs, diagnostics = describeConfigDirs("ruleDirs", configDir, projectRoot, config.RuleDirs)
+	result.Diagnostics = append(result.Diagnostics, diagnostics...)
+	result.UtilDirs, diagnostics = describeConfigDirs("utilDirs", configDir, projectRoot, config.UtilDirs)
+	result.Diagnostics = append(result.Diagnostics, diagnostics...)
+	result.TestDirs, diagnostics = describeConfigDirs("testConfigs", configDir, projectRoot, config.testDirs())
+	result.Diagnostics = append(result.Diagnostics, diagnostics...)
+	if len(result.RuleDirs) == 0 {
+		result.Diagnostics = append(result.Diagnostics, Diagnostic{
+			Level:   DiagnosticWarning,
+			Source:  "context-sherpa",
+			Message: "ruleDirs is empty, so no ast-grep rules run",
+		})
+	}
+
+	languages := newLanguageRegistry(config)
+	globLanguages := make([]string, 0, len(config.LanguageGlobs))
+	for language := range config.LanguageGlobs {
+		globLanguages = append(globLanguages, language)
+	}
+	sort.Strings(globLanguages)
+	for _, language := range globLanguages {
+		if _, ok := languages.lookup(language); !ok {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{
+				Level:   DiagnosticWarning,
+				Source:  "context-sherpa",
+				Message: fmt.Sprintf("languageGlobs names unknown language '%s'", language),
+			})
+		}
+	}
+
+	customLanguages := make([]string, 0, len(config.CustomLanguages))
+	for name := range config.CustomLanguages {
+		customLanguages = append(customLanguages, name)
+	}
+	sort.Strings(customLanguages)
+	for _, name := range customLanguages {
+		library := config.CustomLanguages[name].LibraryPath.Path
+		if library == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(configDir, library)); err != nil {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{
+				Level:   DiagnosticWarning,
+				Source:  "context-sherpa",
+				Message: fmt.Sprintf("library '%s' of custom language '%s' was not found", library, name),
+			})
+		}
+	}
+
+	if filter, err := newFileFilter(projectRoot, languages, ScanPathOptions{}); err == nil {
+		configs, _ := findSubProjectConfigs(configDir, filter)
+		for _, config := range configs {
+			result.SubProjects = append(result.SubProjects, relativeToProjectRoot(config, projectRoot))
+		}
+	}
+
+	// Rules that cannot be read are reported too, since ast-grep fails on them
+	if _, problems, err := loadRuleDocuments(sgconfigPath); err == nil {
+		result.Diagnostics = append(result.Diagnostics, problems...)
+	}
+	return result, nil
+}
+
+// getConfigHandler handles the get_config tool
+func (s *Server) getConfigHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	projectRoot, sgconfigPath, errResult := s.ruleSetFromRequest(req)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	config, err := s.projectConfig(projectRoot, sgconfigPath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error reading configuration: %v", err)), nil
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error encoding configuration: %v", err)), nil
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
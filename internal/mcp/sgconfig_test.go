@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const fullSgConfig = `ruleDirs:
+  - rules
+  - rules/security
+utilDirs:
+  - utils
+testConfigs:
+  - testDir: rule-tests
+    snapshotDir: __snapshots__
+languageGlobs:
+  html: ["*.vue"]
+  cobol: ["*.cbl"]
+customLanguages:
+  mojo:
+    libraryPath: mojo.so
+    extensions: [mojo]
+  pony:
+    libraryPath:
+      x86_64-unknown-linux-gnu: pony.so
+    extensions: [pony]
+    expandoChar: _
+languageInjections:
+  - hostLanguage: js
+    rule:
+      pattern: styled.$TAG` + "`$CONTENT`" + `
+    injected: css
+`
+
+func TestReadSgConfig(t *testing.T) {
+	projectRoot := t.TempDir()
+	sgconfigPath := filepath.Join(projectRoot, "sgconfig.yml")
+	if err := os.WriteFile(sgconfigPath, []byte(fullSgConfig), 0644); err != nil {
+		t.Fatalf("Failed to write sgconfig.yml: %v", err)
+	}
+
+	config, err := readSgConfig(sgconfigPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(config.RuleDirs, []string{"rules", "rules/security"}) || !reflect.DeepEqual(config.UtilDirs, []string{"utils"}) {
+		t.Errorf("Expected the rule and util directories, got %q and %q", config.RuleDirs, config.UtilDirs)
+	}
+	if len(config.TestConfigs) != 1 || config.TestConfigs[0].SnapshotDir != "__snapshots__" {
+		t.Errorf("Expected the test config, got %+v", config.TestConfigs)
+	}
+	if config.CustomLanguages["mojo"].LibraryPath.Path != "mojo.so" {
+		t.Errorf("Expected a single library path, got %+v", config.CustomLanguages["mojo"].LibraryPath)
+	}
+	if pony := config.CustomLanguages["pony"]; pony.LibraryPath.Targets["x86_64-unknown-linux-gnu"] != "pony.so" || pony.ExpandoChar != "_" {
+		t.Errorf("Expected a library path per target, got %+v", pony)
+	}
+	if len(config.LanguageInjections) != 1 || config.LanguageInjections[0].HostLanguage != "js" || config.LanguageInjections[0].Injected != "css" {
+		t.Errorf("Expected the language injection, got %+v", config.LanguageInjections)
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	projectRoot := t.TempDir()
+	writeTree(t, projectRoot, map[string]string{
+		"sgconfig.yml":            fullSgConfig,
+		"mojo.so":                 "",
+		"rules/no-panic.yml":      "id: no-panic\nlanguage: go\nrule:\n  pattern: panic($$$)\n",
+		"rules/security/sql.yml":  "id: sql\nlanguage: go\nrule:\n  pattern: db.Exec($$$)\n",
+		"rules/security/bad.yml":  "id: [\n",
+		"rule-tests/sql-test.yml": "id: sql\nvalid: []\ninvalid: []\n",
+	})
+	s := NewServer(Options{ProjectRoot: projectRoot})
+
+	result, err := s.RunTool(context.Background(), "get_config", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var config ProjectConfig
+	if err := json.Unmarshal([]byte(toolResultText(t, result)), &config); err != nil {
+		t.Fatalf("Expected a JSON configuration, got: %v", err)
+	}
+
+	if config.Sgconfig != "sgconfig.yml" || len(config.RuleDirs) != 2 {
+		t.Fatalf("Expected two rule directories, got %+v", config)
+	}
+	if dir := config.RuleDirs[1]; dir.Resolved != "rules/security" || !dir.Exists || dir.Files != 2 {
+		t.Errorf("Expected rules/security to hold two files, got %+v", dir)
+	}
+	if len(config.UtilDirs) != 1 || config.UtilDirs[0].Exists {
+		t.Errorf("Expected the missing util directory, got %+v", config.UtilDirs)
+	}
+	if len(config.TestDirs) != 1 || config.TestDirs[0].Files != 1 {
+		t.Errorf("Expected the test directory, got %+v", config.TestDirs)
+	}
+	if !strings.Contains(strings.Join(config.Languages, " "), "mojo") {
+		t.Errorf("Expected the custom languages to be listed, got %q", config.Languages)
+	}
+
+	var messages []string
+	for _, diagnostic := range config.Diagnostics {
+		messages = append(messages, diagnostic.Message)
+	}
+	joined := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"utilDirs entry 'utils' is not a directory",
+		"languageGlobs names unknown language 'cobol'",
+		"error parsing",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected a diagnostic containing %q, got:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "mojo.so") {
+		t.Errorf("Expected the existing library not to be reported, got:\n%s", joined)
+	}
+}
+
+func TestAddRuleToRuleDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot := t.TempDir()
+	writeTree(t, projectRoot, map[string]string{
+		"sgconfig.yml":           "ruleDirs:\n  - rules\n  - rules/security\ntestConfigs:\n  - testDir: rule-tests\n",
+		"rules/security/sql.yml": "id: sql\nlanguage: go\nrule:\n  pattern: db.Exec($$$)\n",
+		"rules/shared.yml":       "id: first\nlanguage: go\nrule:\n  pattern: a\n---\nid: second\nlanguage: go\nrule:\n  pattern: b\n",
+	})
+	s := NewServer(Options{
+		ProjectRoot: projectRoot,
+		AstGrepPath: writeFakeAstGrep(t, t.TempDir(), "#!/bin/sh\necho '[]'\n"),
+	})
+	ctx := context.Background()
+
+	// An existing rule is updated in the directory holding it
+	sql := RuleSpec{ID: "sql", YAML: "id: sql\nlanguage: go\nrule:\n  pattern: db.Query($$$)\n", InvalidExamples: []string{"db.Query(q)"}}
+	if err := s.AddRule(ctx, sql); err != nil {
+		t.Fatalf("Expected the rule to be updated, got: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(projectRoot, "rules", "security", "sql.yml")); !strings.Contains(string(data), "db.Query") {
+		t.Errorf("Expected the rule to be updated in place, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, "rules", "sql.yml")); !os.IsNotExist(err) {
+		t.Error("Expected no copy of the rule in the first rule directory")
+	}
+
+	// A new rule goes to the requested rule directory
+	xss := RuleSpec{ID: "xss", YAML: "id: xss\nlanguage: go\nrule:\n  pattern: template.HTML($$$)\n", RuleDir: "rules/security"}
+	if err := s.AddRule(ctx, xss); err != nil {
+		t.Fatalf("Expected the rule to be added, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, "rules", "security", "xss.yml")); err != nil {
+		t.Errorf("Expected the rule in rules/security: %v", err)
+	}
+
+	sql.RuleDir = "rules"
+	if err := s.AddRule(ctx, sql); err == nil || !strings.Contains(err.Error(), "already exists in rules/security/sql.yml") {
+		t.Errorf("Expected the rule not to be duplicated, got: %v", err)
+	}
+	xss.RuleDir = "lints"
+	xss.ID = "xss2"
+	xss.YAML = strings.Replace(xss.YAML, "id: xss", "id: xss2", 1)
+	if err := s.AddRule(ctx, xss); err == nil || !strings.Contains(err.Error(), "rule_dir 'lints' is not one of the ruleDirs") {
+		t.Errorf("Expected the unknown rule directory to be rejected, got: %v", err)
+	}
+	if err := s.AddRule(ctx, RuleSpec{ID: "second", YAML: "id: second\nlanguage: go\nrule:\n  pattern: c\n"}); err == nil || !strings.Contains(err.Error(), "along with other rules") {
+		t.Errorf("Expected a rule sharing its file to be refused, got: %v", err)
+	}
+
+	// Rules are removed from any rule directory, with their test cases
+	if err := s.RemoveRule(ctx, "sql"); err != nil {
+		t.Fatalf("Expected the rule to be removed, got: %v", err)
+	}
+	for _, path := range []string{"rules/security/sql.yml", "rule-tests/sql-test.yml"} {
+		if _, err := os.Stat(filepath.Join(projectRoot, path)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// configResolver finds the sgconfig.yml governing the files of a project: the one in the
+// innermost directory holding the file, up to the project root. In a monorepo this is the
+// config of the sub-project (service, package...) the file belongs to.
+type configResolver struct {
+	projectRoot string
+	// rootConfig governs the files outside every sub-project
+	rootConfig string
+	// dirs caches the config of each directory looked at
+	dirs map[string]string
+}
+
+// newConfigResolver returns a resolver for the project rooted at projectRoot, whose own
+// configuration is rootConfig
+func newConfigResolver(projectRoot, rootConfig string) *configResolver {
+	return &configResolver{
+		projectRoot: filepath.Clean(projectRoot),
+		rootConfig:  rootConfig,
+		dirs:        make(map[string]string),
+	}
+}
+
+// configForDir returns the sgconfig.yml governing the files of dir
+func (r *configResolver) configForDir(dir string) string {
+	dir = filepath.Clean(dir)
+	if rel, err := filepath.Rel(r.projectRoot, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return r.rootConfig
+	}
+
+	var visited []string
+	config := r.rootConfig
+	for {
+		if cached, ok := r.dirs[dir]; ok {
+			config = cached
+			break
+		}
+		if dir == r.projectRoot {
+			break
+		}
+		visited = append(visited, dir)
+		candidate := filepath.Join(dir, "sgconfig.yml")
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			config = candidate
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	for _, visitedDir := range visited {
+		r.dirs[visitedDir] = config
+	}
+	return config
+}
+
+// configFor returns the sgconfig.yml governing the file at path
+func (r *configResolver) configFor(path string) string {
+	return r.configForDir(filepath.Dir(path))
+}
+
+// configGroup is the files of a scan governed by the same sgconfig.yml
+type configGroup struct {
+	SgconfigPath string
+	Files        []string
+}
+
+// groupFilesByConfig splits files by the sgconfig.yml governing each, in the order the configs
+// are first met. Files keep their order within a group.
+func groupFilesByConfig(files []string, projectRoot, rootConfig string) []configGroup {
+	resolver := newConfigResolver(projectRoot, rootConfig)
+	var groups []configGroup
+	index := make(map[string]int)
+	for _, file := range files {
+		config := resolver.configFor(file)
+		i, ok := index[config]
+		if !ok {
+			i = len(groups)
+			index[config] = i
+			groups = append(groups, configGroup{SgconfigPath: config})
+		}
+		groups[i].Files = append(groups[i].Files, file)
+	}
+	return groups
+}
+
+// findSubProjectConfigs lists the sgconfig.yml files of the sub-projects below dir, leaving out
+// the directories filter skips
+func findSubProjectConfigs(dir string, filter *fileFilter) ([]string, error) {
+	dir = filepath.Clean(dir)
+	var configs []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && filter.skipDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == "sgconfig.yml" && filepath.Dir(path) != dir {
+			configs = append(configs, path)
+		}
+		return nil
+	})
+	return configs, err
+}
+
+// scanConfigGroups scans files with the rules of the sgconfig.yml governing each. Files are only
+// grouped when setup holds the project's own sgconfig.yml: a config named explicitly applies to
+// every file. Each group runs the analyzers named by analyzerNames or, when there are none,
+// those its config runs by default. The outcomes are merged, findings in the order of files.
+func (s *Server) scanConfigGroups(ctx context.Context, setup *scanSetup, files []string, analyzerNames []string) (*scanPathOutcome, *mcp.CallToolResult) {
+	if setup.SgconfigPath != filepath.Join(setup.ProjectRoot, "sgconfig.yml") {
+		return s.scanFiles(ctx, setup, files)
+	}
+	groups := groupFilesByConfig(files, setup.ProjectRoot, setup.SgconfigPath)
+	// Files all governed by the project's own config need no grouping; files all in one
+	// sub-project still need its setup
+	if len(groups) == 0 || (len(groups) == 1 && groups[0].SgconfigPath == setup.SgconfigPath) {
+		return s.scanFiles(ctx, setup, files)
+	}
+
+	merged := &scanPathOutcome{ProjectRoot: setup.ProjectRoot}
+	var findings []Finding
+	var diagnostics []Diagnostic
+	var unscanned []string
+	for _, group := range groups {
+		groupSetup := setup
+		if group.SgconfigPath != setup.SgconfigPath {
+			s.logger.Debug("Scanning sub-project", "sgconfig", group.SgconfigPath, "files", len(group.Files))
+			groupSetup = s.newScanSetup(setup.ProjectRoot, group.SgconfigPath, setup.SgPath)
+			if len(analyzerNames) > 0 {
+				analyzers, err := selectAnalyzers(s.analyzers(setup.SgPath), analyzerNames)
+				if err != nil {
+					return nil, mcp.NewToolResultError(err.Error())
+				}
+				groupSetup.Analyzers = analyzers
+			}
+		}
+
+		outcome, errResult := s.scanFiles(ctx, groupSetup, group.Files)
+		if errResult != nil {
+			return nil, errResult
+		}
+		findings = append(findings, outcome.Result.Findings...)
+		diagnostics = append(diagnostics, outcome.Result.Diagnostics...)
+		unscanned = append(unscanned, outcome.Result.Unscanned...)
+		merged.Files = append(merged.Files, outcome.Files...)
+		merged.SgconfigPaths = append(merged.SgconfigPaths, group.SgconfigPath)
+	}
+
+	// Report findings in the order of the files, as a scan of a single project would
+	order := make(map[string]int, len(files))
+	for i, file := range files {
+		order[relativeToProjectRoot(file, setup.ProjectRoot)] = i
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return order[findings[i].File] < order[findings[j].File]
+	})
+	sort.SliceStable(merged.Files, func(i, j int) bool {
+		return order[merged.Files[i]] < order[merged.Files[j]]
+	})
+
+	merged.Result = newScanResult(findings, diagnostics)
+	merged.Result.Unscanned = unscanned
+	return merged, nil
+}
+
+// scopeConfig returns the sgconfig.yml governing scope, a file or directory relative to the
+// project root. An empty scope stands for the project itself.
+func scopeConfig(projectRoot, scope string) (string, error) {
+	rootConfig := filepath.Join(projectRoot, "sgconfig.yml")
+	if scope = strings.TrimSpace(scope); scope == "" {
+		return rootConfig, nil
+	}
+
+	path := resolvePathRelativeToProjectRoot(scope, projectRoot)
+	if rel, err := filepath.Rel(projectRoot, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("scope '%s' is outside the project root", scope)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("scope '%s' does not exist", scope)
+	}
+
+	resolver := newConfigResolver(projectRoot, rootConfig)
+	if info.IsDir() {
+		return resolver.configForDir(path), nil
+	}
+	return resolver.configFor(path), nil
+}
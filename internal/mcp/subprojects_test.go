@@ -0,0 +1,124 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeMonorepo writes a project named repo with an api service configured on its own
+func writeMonorepo(t *testing.T) string {
+	t.Helper()
+	projectRoot := filepath.Join(t.TempDir(), "repo")
+	writeTree(t, projectRoot, map[string]string{
+		"sgconfig.yml":                     "ruleDirs:\n  - rules\n",
+		"rules/no-panic.yml":               "id: no-panic\nlanguage: go\nrule:\n  pattern: panic($$$)\n",
+		"main.go":                          "package main\n",
+		"services/api/sgconfig.yml":        "ruleDirs:\n  - rules\n",
+		"services/api/rules/no-print.yml":  "id: no-print\nlanguage: go\nrule:\n  pattern: print($$$)\n",
+		"services/api/handler.go":          "package api\n",
+		"services/api/internal/db/db.go":   "package db\n",
+		"services/web/web.go":              "package web\n",
+		"services/web/templates/index.txt": "",
+	})
+	return projectRoot
+}
+
+func TestScanPathSubProjects(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot := writeMonorepo(t)
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: writeScanningFakeAstGrep(t, t.TempDir(), fakeAstGrepOptions{EchoConfig: true})})
+
+	scan := func(t *testing.T, path, sgconfig string) string {
+		t.Helper()
+		result, err := s.ScanPath(context.Background(), ScanPathOptions{Path: path, Sgconfig: sgconfig, Analyzers: []string{AstGrepAnalyzerName}})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var got []string
+		for _, finding := range result.Findings {
+			got = append(got, finding.File+"="+finding.RuleID)
+		}
+		return strings.Join(got, " ")
+	}
+
+	want := "main.go=repo services/api/handler.go=api services/api/internal/db/db.go=api services/web/web.go=repo"
+	if got := scan(t, ".", ""); got != want {
+		t.Errorf("Expected each file scanned with its nearest sgconfig.yml:\n%s\ngot:\n%s", want, got)
+	}
+	// Sub-projects do not share a cache file, so neither invalidates the other's
+	caches, _ := filepath.Glob(filepath.Join(projectRoot, stateDirName, "scan-cache*.json"))
+	if len(caches) != 2 {
+		t.Errorf("Expected a cache file per sgconfig.yml, got %q", caches)
+	}
+
+	want = "main.go=api services/api/handler.go=api services/api/internal/db/db.go=api services/web/web.go=api"
+	if got := scan(t, ".", "services/api/sgconfig.yml"); got != want {
+		t.Errorf("Expected an explicit sgconfig to apply to every file:\n%s\ngot:\n%s", want, got)
+	}
+
+	// A scan of a single sub-project uses its rules too
+	want = "services/api/handler.go=api services/api/internal/db/db.go=api"
+	for _, path := range []string{"services/api", "services/api/**/*.go", filepath.Join(projectRoot, "services", "api")} {
+		if got := scan(t, path, ""); got != want {
+			t.Errorf("%s: expected the api service's rules:\n%s\ngot:\n%s", path, want, got)
+		}
+	}
+}
+
+func TestRuleScope(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot := writeMonorepo(t)
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: writeFakeAstGrep(t, t.TempDir(), "#!/bin/sh\necho '[]'\n")})
+	ctx := context.Background()
+
+	spec := RuleSpec{ID: "no-sleep", YAML: "id: no-sleep\nlanguage: go\nrule:\n  pattern: time.Sleep($$$)\n", Scope: "services/api/internal/db/db.go"}
+	if err := s.AddRule(ctx, spec); err != nil {
+		t.Fatalf("Expected the rule to be added, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, "services", "api", "rules", "no-sleep.yml")); err != nil {
+		t.Errorf("Expected the rule in the api service's rules: %v", err)
+	}
+
+	// A directory without a sgconfig.yml of its own belongs to the project
+	spec.Scope = "services/web"
+	if err := s.AddRule(ctx, spec); err != nil {
+		t.Fatalf("Expected the rule to be added, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, "rules", "no-sleep.yml")); err != nil {
+		t.Errorf("Expected the rule in the project's rules: %v", err)
+	}
+
+	for scope, message := range map[string]string{"services/mobile": "does not exist", "../elsewhere": "outside the project root"} {
+		spec.Scope = scope
+		if err := s.AddRule(ctx, spec); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: expected an error containing %q, got: %v", scope, message, err)
+		}
+	}
+
+	result, err := s.RunTool(ctx, "remove_rule", map[string]interface{}{"rule_id": "no-sleep", "scope": "services/api"})
+	if err != nil || result.IsError {
+		t.Fatalf("Expected the rule to be removed, got: %v %+v", err, result)
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, "services", "api", "rules", "no-sleep.yml")); !os.IsNotExist(err) {
+		t.Error("Expected the api service's rule to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(projectRoot, "rules", "no-sleep.yml")); err != nil {
+		t.Errorf("Expected the project's rule to be kept: %v", err)
+	}
+
+	config, err := s.GetConfig(ctx, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if strings.Join(config.SubProjects, " ") != "services/api/sgconfig.yml" {
+		t.Errorf("Expected the api service to be listed, got %q", config.SubProjects)
+	}
+}
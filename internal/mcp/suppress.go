@@ -0,0 +1,216 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// suppressionMarker is the keyword that introduces an inline suppression comment, e.g.
+//
+//	// sherpa-ignore: unchecked-error reason="cleanup failures are irrelevant here"
+//	# sherpa-ignore: no-print, no-eval reason="debug script"
+const suppressionMarker = "sherpa-ignore"
+
+// suppressionReasonPattern matches the reason="..." part of a suppression comment
+var suppressionReasonPattern = regexp.MustCompile(`\breason\s*=\s*"([^"]*)"`)
+
+// suppressionRuleIDPattern matches a single rule id in a suppression comment
+var suppressionRuleIDPattern = regexp.MustCompile(`^[\w.\-]+$`)
+
+// suppression is a single sherpa-ignore comment found in a source file
+type suppression struct {
+	Line       int // 1-based line of the comment
+	TargetLine int // 1-based line whose findings are suppressed
+	RuleIDs    []string
+	Reason     string
+	used       map[string]bool
+}
+
+// sourceFile is a scanned file whose content is checked for suppression comments.
+// Name must match the File of the findings reported for it.
+type sourceFile struct {
+	Name          string
+	Content       []byte
+	CommentPrefix string
+}
+
+// loadSourceFiles reads the scanned files so their suppression comments can be applied, in the
+// comment syntax languages gives their language.
+// Files that cannot be read are skipped; they cannot carry suppressions we know about.
+func (s *Server) loadSourceFiles(files []string, projectRoot string, languages *languageRegistry) []sourceFile {
+	sources := make([]sourceFile, 0, len(files))
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			s.logger.Debug("Could not read source file", "file", file, "error", err)
+			continue
+		}
+		name := relativeToProjectRoot(file, projectRoot)
+		sources = append(sources, sourceFile{
+			Name:          name,
+			Content:       content,
+			CommentPrefix: languages.commentPrefix(name),
+		})
+	}
+	return sources
+}
+
+// parseSuppressions extracts all sherpa-ignore comments from content.
+// A comment that shares its line with code suppresses findings on that line; a comment on a line
+// of its own suppresses findings on the next non-blank line.
+func parseSuppressions(content []byte, commentPrefix string) []*suppression {
+	var suppressions []*suppression
+	var pending []*suppression
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+
+		// Comment-only lines (including stacked suppressions) do not consume pending suppressions
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, commentPrefix) {
+			for _, s := range pending {
+				s.TargetLine = lineNumber
+			}
+			pending = nil
+		}
+
+		idx := strings.Index(line, commentPrefix)
+		for idx >= 0 {
+			comment := line[idx+len(commentPrefix):]
+			if strings.HasPrefix(strings.TrimSpace(comment), suppressionMarker) {
+				break
+			}
+			next := strings.Index(comment, commentPrefix)
+			if next < 0 {
+				idx = -1
+				break
+			}
+			idx += len(commentPrefix) + next
+		}
+		if idx < 0 {
+			continue
+		}
+
+		comment := strings.TrimSpace(line[idx+len(commentPrefix):])
+		comment = strings.TrimPrefix(comment, suppressionMarker)
+		comment = strings.TrimPrefix(strings.TrimSpace(comment), ":")
+
+		s := &suppression{
+			Line: lineNumber,
+			used: make(map[string]bool),
+		}
+
+		ids := comment
+		if loc := suppressionReasonPattern.FindStringSubmatchIndex(comment); loc != nil {
+			ids = comment[:loc[0]]
+			s.Reason = strings.TrimSpace(comment[loc[2]:loc[3]])
+		}
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); suppressionRuleIDPattern.MatchString(id) {
+				s.RuleIDs = append(s.RuleIDs, id)
+			}
+		}
+
+		if strings.TrimSpace(line[:idx]) == "" {
+			pending = append(pending, s)
+		} else {
+			s.TargetLine = lineNumber
+		}
+		suppressions = append(suppressions, s)
+	}
+
+	return suppressions
+}
+
+// applySuppressions drops findings silenced by sherpa-ignore comments in the given files.
+// Suppressions without a reason, without rule ids, or that silence nothing are returned as diagnostics.
+func applySuppressions(findings []Finding, files []sourceFile) ([]Finding, []Diagnostic) {
+	var diagnostics []Diagnostic
+	byFile := make(map[string][]*suppression)
+
+	for _, file := range files {
+		if file.CommentPrefix == "" || !bytes.Contains(file.Content, []byte(suppressionMarker)) {
+			continue
+		}
+		byFile[file.Name] = parseSuppressions(file.Content, file.CommentPrefix)
+	}
+
+	if len(byFile) == 0 {
+		return findings, nil
+	}
+
+	kept := make([]Finding, 0, len(findings))
+	for _, finding := range findings {
+		if !suppressFinding(finding, byFile[finding.File]) {
+			kept = append(kept, finding)
+		}
+	}
+
+	for _, file := range files {
+		for _, s := range byFile[file.Name] {
+			diagnostics = append(diagnostics, suppressionDiagnostics(file.Name, s)...)
+		}
+	}
+
+	return kept, diagnostics
+}
+
+// suppressFinding reports whether one of the suppressions silences the finding, marking it used
+func suppressFinding(finding Finding, suppressions []*suppression) bool {
+	for _, s := range suppressions {
+		if s.TargetLine != finding.StartLine {
+			continue
+		}
+		for _, id := range s.RuleIDs {
+			if id == finding.RuleID {
+				s.used[id] = true
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// suppressionDiagnostics reports problems with a single suppression comment
+func suppressionDiagnostics(file string, s *suppression) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	if len(s.RuleIDs) == 0 {
+		return append(diagnostics, Diagnostic{
+			Level:   DiagnosticWarning,
+			Source:  suppressionMarker,
+			Message: fmt.Sprintf("line %d: suppression does not name any rule id", s.Line),
+			File:    file,
+		})
+	}
+
+	if s.Reason == "" {
+		diagnostics = append(diagnostics, Diagnostic{
+			Level:   DiagnosticWarning,
+			Source:  suppressionMarker,
+			Message: fmt.Sprintf("line %d: suppression of '%s' has no reason=\"...\"", s.Line, strings.Join(s.RuleIDs, ", ")),
+			File:    file,
+		})
+	}
+
+	for _, id := range s.RuleIDs {
+		if !s.used[id] {
+			diagnostics = append(diagnostics, Diagnostic{
+				Level:   DiagnosticWarning,
+				Source:  suppressionMarker,
+				Message: fmt.Sprintf("line %d: suppression of '%s' does not match any finding", s.Line, id),
+				File:    file,
+			})
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSuppressions(t *testing.T) {
+	content := `package main
+
+func main() {
+	// sherpa-ignore: unchecked-error reason="best effort cleanup"
+	os.Remove("tmp")
+	doThing() // sherpa-ignore: unchecked-error, no-fmt-println
+	// sherpa-ignore: first reason="a"
+	// sherpa-ignore: second reason="b"
+
+	target()
+}
+`
+	suppressions := parseSuppressions([]byte(content), "//")
+
+	if len(suppressions) != 4 {
+		t.Fatalf("Expected 4 suppressions, got %d", len(suppressions))
+	}
+
+	tests := []struct {
+		line    int
+		target  int
+		ruleIDs string
+		reason  string
+	}{
+		{4, 5, "unchecked-error", "best effort cleanup"},
+		{6, 6, "unchecked-error,no-fmt-println", ""},
+		{7, 10, "first", "a"},
+		{8, 10, "second", "b"},
+	}
+
+	for i, tt := range tests {
+		s := suppressions[i]
+		if s.Line != tt.line || s.TargetLine != tt.target {
+			t.Errorf("suppression %d: expected line %d targeting %d, got line %d targeting %d", i, tt.line, tt.target, s.Line, s.TargetLine)
+		}
+		if strings.Join(s.RuleIDs, ",") != tt.ruleIDs {
+			t.Errorf("suppression %d: expected rule ids %s, got %v", i, tt.ruleIDs, s.RuleIDs)
+		}
+		if s.Reason != tt.reason {
+			t.Errorf("suppression %d: expected reason %q, got %q", i, tt.reason, s.Reason)
+		}
+	}
+}
+
+func TestParseSuppressionsPython(t *testing.T) {
+	content := "x = 1\nprint(x)  # sherpa-ignore: no-print reason=\"debug script\"\n"
+	suppressions := parseSuppressions([]byte(content), "#")
+
+	if len(suppressions) != 1 {
+		t.Fatalf("Expected 1 suppression, got %d", len(suppressions))
+	}
+	if suppressions[0].TargetLine != 2 || suppressions[0].RuleIDs[0] != "no-print" {
+		t.Errorf("Unexpected suppression: %+v", suppressions[0])
+	}
+}
+
+func TestApplySuppressions(t *testing.T) {
+	content := `package main
+
+func main() {
+	// sherpa-ignore: unchecked-error reason="best effort cleanup"
+	os.Remove("tmp")
+	// sherpa-ignore: unchecked-error
+	doThing()
+	// sherpa-ignore: no-such-rule reason="stale"
+	fmt.Println("x")
+	// sherpa-ignore reason="no ids"
+	other()
+}
+`
+	findings := []Finding{
+		{RuleID: "unchecked-error", File: "main.go", StartLine: 5},
+		{RuleID: "unchecked-error", File: "main.go", StartLine: 7},
+		{RuleID: "no-fmt-println", File: "main.go", StartLine: 9},
+		{RuleID: "unchecked-error", File: "other.go", StartLine: 5},
+	}
+	files := []sourceFile{{Name: "main.go", Content: []byte(content), CommentPrefix: "//"}}
+
+	kept, diagnostics := applySuppressions(findings, files)
+
+	if len(kept) != 2 {
+		t.Fatalf("Expected 2 findings to be kept, got %d: %+v", len(kept), kept)
+	}
+	if kept[0].RuleID != "no-fmt-println" || kept[1].File != "other.go" {
+		t.Errorf("Unexpected findings kept: %+v", kept)
+	}
+
+	var missingReason, unused, noIDs int
+	for _, d := range diagnostics {
+		switch {
+		case strings.Contains(d.Message, "has no reason"):
+			missingReason++
+		case strings.Contains(d.Message, "does not match any finding"):
+			unused++
+		case strings.Contains(d.Message, "does not name any rule id"):
+			noIDs++
+		}
+		if d.File != "main.go" || d.Source != suppressionMarker {
+			t.Errorf("Unexpected diagnostic location: %+v", d)
+		}
+	}
+
+	if missingReason != 1 || unused != 1 || noIDs != 1 {
+		t.Errorf("Expected 1 missing reason, 1 unused and 1 empty suppression diagnostic, got %+v", diagnostics)
+	}
+}
+
+func TestApplySuppressionsWithoutComments(t *testing.T) {
+	findings := []Finding{{RuleID: "r", File: "a.go", StartLine: 1}}
+	kept, diagnostics := applySuppressions(findings, []sourceFile{{Name: "a.go", Content: []byte("package a\n"), CommentPrefix: "//"}})
+
+	if len(kept) != 1 || len(diagnostics) != 0 {
+		t.Errorf("Expected findings to pass through untouched, got %d findings and %d diagnostics", len(kept), len(diagnostics))
+	}
+}
@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// DefaultToolTimeout bounds every tool call unless Options.ToolTimeout says otherwise, so a
+// pathological rule cannot hang the server
+const DefaultToolTimeout = 5 * time.Minute
+
+// subprocessWaitDelay bounds how long the output of a subprocess killed by a cancelled call is
+// waited for, in case children it started still hold its pipes open
+const subprocessWaitDelay = 2 * time.Second
+
+// ErrScanIncomplete is returned, wrapped, by ScanPath together with the partial result of a scan
+// that was cancelled or timed out. ScanResult.Unscanned lists the files that were not scanned.
+var ErrScanIncomplete = errors.New("scan incomplete")
+
+// ParseToolTimeouts parses per-tool timeouts written as "scan_path=10m,run_rule_tests=1m", the
+// format of the --toolTimeouts flag. Tool names must be those of the tools the server registers,
+// so a misspelt name is reported rather than left to the default timeout.
+func ParseToolTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	tools := NewServer(Options{}).newMCPServer().ListTools()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid tool timeout '%s': expected <tool>=<duration>", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for tool '%s': %v", strings.TrimSpace(name), err)
+		}
+		name = strings.TrimSpace(name)
+		if _, ok := tools[name]; !ok {
+			known := make([]string, 0, len(tools))
+			for toolName := range tools {
+				known = append(known, toolName)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown tool '%s' (tools are %s)", name, strings.Join(known, ", "))
+		}
+		timeouts[name] = timeout
+	}
+	return timeouts, nil
+}
+
+// toolTimeout returns how long a call of the named tool may run; zero means no limit
+func (s *Server) toolTimeout(name string) time.Duration {
+	timeout, ok := s.toolTimeouts[name]
+	if !ok {
+		timeout = s.defaultToolTimeout
+	}
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// withTimeout wraps the handler of the named tool so that its context, and with it every
+// subprocess the call starts, is cancelled once the tool's timeout has passed
+func (s *Server) withTimeout(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if timeout := s.toolTimeout(name); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// cancelReason says how a scan stopped by err ended, for messages
+func cancelReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timed out"
+	}
+	return "was cancelled"
+}
+
+// scanIncompleteMessage explains why unscanned of total files were not scanned
+func scanIncompleteMessage(err error, unscanned, total int) string {
+	return fmt.Sprintf("scan %s: %d of %d file(s) were not scanned and are listed in unscanned_files", cancelReason(err), unscanned, total)
+}
+
+// incompleteScanError returns the error result of a tool that needs every file scanned when
+// result is partial, naming the files that were not scanned, and nil otherwise
+func incompleteScanError(ctx context.Context, result *ScanResult) *mcp.CallToolResult {
+	if len(result.Unscanned) == 0 {
+		return nil
+	}
+	return mcp.NewToolResultError(fmt.Sprintf("Error: the scan %s before every file was scanned. Not scanned: %s", cancelReason(ctx.Err()), strings.Join(result.Unscanned, ", ")))
+}
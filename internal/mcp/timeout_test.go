@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseToolTimeouts(t *testing.T) {
+	timeouts, err := ParseToolTimeouts(" scan_path=10m, run_rule_tests=30s ,")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(timeouts) != 2 || timeouts["scan_path"] != 10*time.Minute || timeouts["run_rule_tests"] != 30*time.Second {
+		t.Errorf("Expected both timeouts, got %v", timeouts)
+	}
+
+	for _, spec := range []string{"scan_path", "=1m", "scan_path=soon"} {
+		if _, err := ParseToolTimeouts(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+	if _, err := ParseToolTimeouts("scan_pth=10m"); err == nil || !strings.Contains(err.Error(), "unknown tool 'scan_pth'") {
+		t.Errorf("Expected the misspelt tool to be rejected, got: %v", err)
+	}
+}
+
+func TestToolTimeout(t *testing.T) {
+	s := NewServer(Options{ToolTimeouts: map[string]time.Duration{"scan_path": time.Minute, "run_rule_tests": -1}})
+	if timeout := s.toolTimeout("scan_code"); timeout != DefaultToolTimeout {
+		t.Errorf("Expected the default timeout, got %v", timeout)
+	}
+	if timeout := s.toolTimeout("scan_path"); timeout != time.Minute {
+		t.Errorf("Expected the per-tool timeout, got %v", timeout)
+	}
+	if timeout := s.toolTimeout("run_rule_tests"); timeout != 0 {
+		t.Errorf("Expected no limit, got %v", timeout)
+	}
+	if timeout := NewServer(Options{ToolTimeout: -1}).toolTimeout("scan_path"); timeout != 0 {
+		t.Errorf("Expected no limit, got %v", timeout)
+	}
+}
+
+func TestScanTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+
+	projectRoot := writeRuleProject(t, "no-panic")
+	os.MkdirAll(filepath.Join(projectRoot, "src"), 0755)
+	os.WriteFile(filepath.Join(projectRoot, "src", "a.go"), []byte("package main\n\nfunc a() { panic() }\n"), 0644)
+	os.WriteFile(filepath.Join(projectRoot, "src", "b.go"), []byte("package main\n\n// SLOW\n"), 0644)
+	sgPath := writeScanningFakeAstGrep(t, t.TempDir(), fakeAstGrepOptions{DelayOn: "SLOW"})
+	s := NewServer(Options{
+		ProjectRoot:      projectRoot,
+		AstGrepPath:      sgPath,
+		DisableScanCache: true,
+		ScanBatchSize:    1,
+		ScanWorkers:      1,
+		ToolTimeouts:     map[string]time.Duration{"scan_path": 500 * time.Millisecond, "create_baseline": 500 * time.Millisecond},
+	})
+
+	t.Run("scan_path returns a partial result naming the unscanned files", func(t *testing.T) {
+		start := time.Now()
+		result, err := s.RunTool(context.Background(), "scan_path", map[string]interface{}{"path": ".", "language": "go"})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("Expected ast-grep to be killed at the timeout, took %v", elapsed)
+		}
+		if !result.IsError {
+			t.Error("Expected a partial scan to be an error result")
+		}
+
+		var scan ScanResult
+		if err := json.Unmarshal([]byte(toolResultText(t, result)), &scan); err != nil {
+			t.Fatalf("Expected the findings document, got: %v", err)
+		}
+		if len(scan.Findings) != 1 || scan.Findings[0].File != "src/a.go" {
+			t.Errorf("Expected the finding of the scanned file, got %+v", scan.Findings)
+		}
+		if len(scan.Unscanned) != 1 || scan.Unscanned[0] != "src/b.go" {
+			t.Errorf("Expected src/b.go to be reported as not scanned, got %v", scan.Unscanned)
+		}
+		if len(scan.Diagnostics) != 1 || !strings.Contains(scan.Diagnostics[0].Message, "scan timed out: 1 of 2 file(s) were not scanned") {
+			t.Errorf("Expected a timeout diagnostic, got %+v", scan.Diagnostics)
+		}
+	})
+
+	t.Run("create_baseline refuses a partial scan", func(t *testing.T) {
+		result, err := s.RunTool(context.Background(), "create_baseline", map[string]interface{}{"path": ".", "language": "go"})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if text := toolResultText(t, result); !result.IsError || !strings.Contains(text, "timed out") || !strings.Contains(text, "Not scanned: src/b.go") {
+			t.Errorf("Expected an error naming src/b.go, got %q", text)
+		}
+		if _, err := os.Stat(filepath.Join(projectRoot, defaultBaselineFile)); !os.IsNotExist(err) {
+			t.Errorf("Expected no baseline to be written, got %v", err)
+		}
+	})
+
+	t.Run("ScanPath reports cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		result, err := s.ScanPath(ctx, ScanPathOptions{Path: ".", LanguageFilter: "go"})
+		if !errors.Is(err, ErrScanIncomplete) || !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected ErrScanIncomplete, got: %v", err)
+		}
+		if len(result.Unscanned) != 2 {
+			t.Errorf("Expected both files to be reported as not scanned, got %v", result.Unscanned)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package mcp
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Supported values of the --transport flag
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+	TransportSSE   = "sse"
+)
+
+// DefaultHTTPAddr is the address the HTTP and SSE transports listen on by default.
+// It is loopback only; bind to 0.0.0.0 explicitly to share one instance across a dev container.
+const DefaultHTTPAddr = "127.0.0.1:8080"
+
+// httpEndpointPath is the path of the streamable HTTP endpoint
+const httpEndpointPath = "/mcp"
+
+// TransportOptions selects how the MCP server is served
+type TransportOptions struct {
+	// Transport is one of TransportStdio (default), TransportHTTP or TransportSSE
+	Transport string
+	// Addr is the bind address of the HTTP and SSE transports
+	Addr string
+	// AuthToken, when set, must be sent by HTTP and SSE clients as "Authorization: Bearer <token>"
+	AuthToken string
+}
+
+// validate checks the options and fills in defaults
+func (o *TransportOptions) validate() error {
+	o.Transport = strings.ToLower(strings.TrimSpace(o.Transport))
+	switch o.Transport {
+	case "":
+		o.Transport = TransportStdio
+	case TransportStdio, TransportHTTP, TransportSSE:
+	default:
+		return fmt.Errorf("unsupported transport '%s' (supported: '%s', '%s', '%s')", o.Transport, TransportStdio, TransportHTTP, TransportSSE)
+	}
+
+	if o.Transport != TransportStdio && o.Addr == "" {
+		o.Addr = DefaultHTTPAddr
+	}
+	return nil
+}
+
+// newHTTPHandler returns the handler serving s over the HTTP or SSE transport, with the bearer
+// token check in front of it when a token is configured
+func newHTTPHandler(s *server.MCPServer, opts TransportOptions) (http.Handler, error) {
+	var handler http.Handler
+	switch opts.Transport {
+	case TransportHTTP:
+		mux := http.NewServeMux()
+		mux.Handle(httpEndpointPath, server.NewStreamableHTTPServer(s, server.WithEndpointPath(httpEndpointPath)))
+		handler = mux
+	case TransportSSE:
+		handler = server.NewSSEServer(s)
+	default:
+		return nil, fmt.Errorf("transport '%s' is not served over HTTP", opts.Transport)
+	}
+
+	if opts.AuthToken != "" {
+		handler = requireBearerToken(handler, opts.AuthToken)
+	}
+	return handler, nil
+}
+
+// requireBearerToken rejects requests that do not carry the expected bearer token
+func requireBearerToken(next http.Handler, token string) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="context-sherpa"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackAddr reports whether addr only accepts connections from the local machine
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Serve runs the tools of s on the selected transport until it stops
+func (s *Server) Serve(opts TransportOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	m := s.newMCPServer()
+	if opts.Transport == TransportStdio {
+		return server.ServeStdio(m)
+	}
+
+	handler, err := newHTTPHandler(m, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.AuthToken == "" && !isLoopbackAddr(opts.Addr) {
+		s.logger.Warn("Serving without an auth token; any client that can reach it can run tools", "addr", opts.Addr)
+	}
+
+	endpoint := httpEndpointPath
+	if opts.Transport == TransportSSE {
+		endpoint = "/sse"
+	}
+	s.logger.Info("Listening for clients", "transport", opts.Transport, "url", "http://"+opts.Addr+endpoint)
+
+	return http.ListenAndServe(opts.Addr, handler)
+}
@@ -0,0 +1,152 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// listToolNames initializes an MCP session with c and returns the sorted names of the tools it offers
+func listToolNames(t *testing.T, c *client.Client) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Failed to start client: %v", err)
+	}
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initReq.Params.ClientInfo = mcp.Implementation{Name: "test-client", Version: "1.0.0"}
+	if _, err := c.Initialize(ctx, initReq); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+
+	result, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatalf("Failed to list tools: %v", err)
+	}
+	var names []string
+	for _, tool := range result.Tools {
+		names = append(names, tool.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registeredToolNames returns the sorted names of the tools registered on a fresh server
+func registeredToolNames() []string {
+	var names []string
+	for name := range NewServer(Options{}).newMCPServer().ListTools() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTransportOptionsValidate(t *testing.T) {
+	opts := TransportOptions{}
+	if err := opts.validate(); err != nil || opts.Transport != TransportStdio {
+		t.Errorf("Expected stdio by default, got %+v (%v)", opts, err)
+	}
+
+	opts = TransportOptions{Transport: "HTTP"}
+	if err := opts.validate(); err != nil || opts.Transport != TransportHTTP || opts.Addr != DefaultHTTPAddr {
+		t.Errorf("Expected http on the default address, got %+v (%v)", opts, err)
+	}
+
+	opts = TransportOptions{Transport: "websocket"}
+	if err := opts.validate(); err == nil {
+		t.Error("Expected an unsupported transport to be rejected")
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8080": true,
+		"localhost:8080": true,
+		"[::1]:8080":     true,
+		"0.0.0.0:8080":   false,
+		":8080":          false,
+		"10.0.0.5:8080":  false,
+	}
+	for addr, expected := range tests {
+		if got := isLoopbackAddr(addr); got != expected {
+			t.Errorf("isLoopbackAddr(%q) = %v, expected %v", addr, got, expected)
+		}
+	}
+}
+
+func TestStreamableHTTPTransport(t *testing.T) {
+	handler, err := newHTTPHandler(NewServer(Options{}).newMCPServer(), TransportOptions{Transport: TransportHTTP, AuthToken: "secret"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	t.Run("Rejects requests without the token", func(t *testing.T) {
+		for _, header := range []string{"", "Bearer wrong"} {
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+httpEndpointPath, strings.NewReader("{}"))
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected 401 for Authorization %q, got %d", header, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("Serves the same tools as stdio", func(t *testing.T) {
+		c, err := client.NewStreamableHttpClient(ts.URL+httpEndpointPath,
+			transport.WithHTTPHeaders(map[string]string{"Authorization": "Bearer secret"}))
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer c.Close()
+
+		names := listToolNames(t, c)
+		if strings.Join(names, ",") != strings.Join(registeredToolNames(), ",") {
+			t.Errorf("Expected tools %v, got %v", registeredToolNames(), names)
+		}
+	})
+}
+
+func TestSSETransport(t *testing.T) {
+	handler, err := newHTTPHandler(NewServer(Options{}).newMCPServer(), TransportOptions{Transport: TransportSSE})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	c, err := client.NewSSEMCPClient(ts.URL + "/sse")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer c.Close()
+
+	names := listToolNames(t, c)
+	if strings.Join(names, ",") != strings.Join(registeredToolNames(), ",") {
+		t.Errorf("Expected tools %v, got %v", registeredToolNames(), names)
+	}
+}
+
+func TestNewHTTPHandlerRejectsStdio(t *testing.T) {
+	if _, err := newHTTPHandler(NewServer(Options{}).newMCPServer(), TransportOptions{Transport: TransportStdio}); err == nil {
+		t.Error("Expected stdio to be rejected")
+	}
+}
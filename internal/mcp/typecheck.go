@@ -0,0 +1,416 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+	"gopkg.in/yaml.v3"
+)
+
+// semanticConstraint is one entry of a rule's semantic: block. ast-grep ignores the block; it is
+// evaluated with Go type information once ast-grep has matched, and matches failing any
+// constraint are dropped. Each entry makes exactly one check.
+type semanticConstraint struct {
+	// Metavar names the metavariable whose node is checked, such as A or $A; empty checks the
+	// whole match
+	Metavar string `yaml:"metavar"`
+	// Returns requires a call, or the function it calls, to have a result of this type
+	Returns string `yaml:"returns"`
+	// Implements requires the node's type, or a pointer to it, to implement this interface
+	Implements string `yaml:"implements"`
+	// Type requires the node's type to be this type
+	Type string `yaml:"type"`
+}
+
+// semanticConstraintKeys are the keys of a semantic constraint, with whether each is a check
+var semanticConstraintKeys = map[string]bool{"metavar": false, "returns": true, "implements": true, "type": true}
+
+// checkSemanticBlock reports problems in the semantic: block of a rule written in language
+func checkSemanticBlock(value *yaml.Node, language string) []ruleProblem {
+	if language != "" && strings.ToLower(language) != "go" {
+		return []ruleProblem{{Line: value.Line, Message: fmt.Sprintf("semantic constraints are only supported for Go rules, not '%s'", language)}}
+	}
+	if value.Kind != yaml.SequenceNode {
+		return []ruleProblem{{Line: value.Line, Message: "'semantic' must be a list of constraints"}}
+	}
+
+	var problems []ruleProblem
+	for _, item := range value.Content {
+		if item.Kind != yaml.MappingNode {
+			problems = append(problems, ruleProblem{Line: item.Line, Message: "semantic constraint must be a mapping"})
+			continue
+		}
+		checks := 0
+		for i := 0; i+1 < len(item.Content); i += 2 {
+			key, value := item.Content[i], item.Content[i+1]
+			isCheck, known := semanticConstraintKeys[key.Value]
+			switch {
+			case !known:
+				problems = append(problems, ruleProblem{Line: key.Line, Message: fmt.Sprintf("unknown semantic constraint key '%s'", key.Value)})
+			case value.Kind != yaml.ScalarNode || strings.TrimSpace(value.Value) == "":
+				problems = append(problems, ruleProblem{Line: value.Line, Message: fmt.Sprintf("semantic constraint key '%s' must be a non-empty string", key.Value)})
+			case isCheck:
+				checks++
+			}
+		}
+		if checks != 1 {
+			problems = append(problems, ruleProblem{Line: item.Line, Message: "semantic constraint must have exactly one of 'returns', 'implements' or 'type'"})
+		}
+	}
+	return problems
+}
+
+// semanticConstraints decodes the semantic: block of a rule, returning nil when it has none
+func semanticConstraints(root *yaml.Node) ([]semanticConstraint, error) {
+	semantic := mappingEntry(root, "semantic")
+	if semantic == nil {
+		return nil, nil
+	}
+	if problems := checkSemanticBlock(semantic, mappingValue(root, "language")); len(problems) > 0 {
+		return nil, &ruleValidationError{Problems: problems}
+	}
+
+	var constraints []semanticConstraint
+	if err := semantic.Decode(&constraints); err != nil {
+		return nil, err
+	}
+	return constraints, nil
+}
+
+// ruleConstraints collects the semantic constraints of the rules, by rule id. Rules whose
+// semantic: block is malformed are reported and run without constraints.
+func ruleConstraints(docs []ruleDocument, projectRoot string) (map[string][]semanticConstraint, []Diagnostic) {
+	constraints := make(map[string][]semanticConstraint)
+	var diagnostics []Diagnostic
+	for _, doc := range docs {
+		if doc.node == nil {
+			continue
+		}
+		root := doc.node
+		if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+			root = root.Content[0]
+		}
+		ruleConstraints, err := semanticConstraints(root)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Level:   DiagnosticWarning,
+				Source:  "context-sherpa",
+				Message: fmt.Sprintf("semantic constraints of rule '%s' ignored: %v", doc.ID, err),
+				File:    relativeToProjectRoot(doc.Path, projectRoot),
+			})
+			continue
+		}
+		if len(ruleConstraints) > 0 {
+			constraints[doc.ID] = ruleConstraints
+		}
+	}
+	return constraints, diagnostics
+}
+
+// typedFile is a parsed Go file together with the type information of its package
+type typedFile struct {
+	file *ast.File
+	info *types.Info
+	pkg  *types.Package
+}
+
+// newTypesInfo allocates the type information the constraints need
+func newTypesInfo() *types.Info {
+	return &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+}
+
+// loadTypedFiles type-checks the packages containing paths with go/packages. Files that belong
+// to no package, such as files excluded by build constraints, are checked on their own.
+func loadTypedFiles(ctx context.Context, fset *token.FileSet, dir string, paths []string) map[string]*typedFile {
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[path] = true
+	}
+	patterns := packageDirPatterns(paths)
+
+	typed := make(map[string]*typedFile)
+	// Dependencies are type-checked from source rather than read from export data, whose format
+	// follows the installed Go toolchain and may be newer than go/packages understands
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Dir:     dir,
+		Fset:    fset,
+		Tests:   true,
+	}
+	if pkgs, err := packages.Load(cfg, patterns...); err == nil {
+		for _, pkg := range pkgs {
+			if pkg.Types == nil || pkg.TypesInfo == nil {
+				continue
+			}
+			for _, file := range pkg.Syntax {
+				path := filepath.Clean(fset.File(file.Pos()).Name())
+				// A file of a package with tests is loaded twice; either copy will do
+				if wanted[path] && typed[path] == nil {
+					typed[path] = &typedFile{file: file, info: pkg.TypesInfo, pkg: pkg.Types}
+				}
+			}
+		}
+	}
+
+	for _, path := range paths {
+		if typed[path] != nil {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if file, err := typeCheckStandalone(fset, path, src); err == nil {
+			typed[path] = file
+		}
+	}
+	return typed
+}
+
+// packageDirPatterns returns the go/packages patterns loading the packages of files: the
+// directory of each file, once. A file= pattern per file would pass the whole list of files to
+// go list on its command line, which a large scan can make too long.
+func packageDirPatterns(files []string) []string {
+	seen := make(map[string]bool)
+	var patterns []string
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		// A relative directory must start with ./ not to be read as an import path
+		pattern := dir
+		if !filepath.IsAbs(dir) && dir != "." {
+			pattern = "." + string(filepath.Separator) + dir
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// typeCheckStandalone type-checks one file as a package of its own, importing packages from
+// source. Type errors are ignored; the information gathered around them is still used.
+func typeCheckStandalone(fset *token.FileSet, path string, src []byte) (*typedFile, error) {
+	file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	info := newTypesInfo()
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check(file.Name.Name, fset, []*ast.File{file}, info)
+	return &typedFile{file: file, info: info, pkg: pkg}, nil
+}
+
+// applySemanticConstraints drops the ast-grep findings whose rule has semantic constraints that
+// do not hold. Findings are resolved against typed, keyed by absolute path. A constraint that
+// cannot be evaluated keeps its finding and is reported as a diagnostic.
+func applySemanticConstraints(findings []Finding, constraints map[string][]semanticConstraint, typed map[string]*typedFile, fset *token.FileSet, pathOf func(Finding) string) ([]Finding, []Diagnostic) {
+	var kept []Finding
+	var diagnostics []Diagnostic
+	reported := make(map[string]bool)
+	for _, finding := range findings {
+		ruleConstraints := constraints[finding.RuleID]
+		if len(ruleConstraints) == 0 || finding.Analyzer != AstGrepAnalyzerName {
+			kept = append(kept, finding)
+			continue
+		}
+
+		holds, err := findingSatisfies(finding, ruleConstraints, typed[pathOf(finding)], fset)
+		if err != nil {
+			message := fmt.Sprintf("semantic constraints of rule '%s' not evaluated: %v", finding.RuleID, err)
+			if key := finding.File + "\x00" + message; !reported[key] {
+				reported[key] = true
+				diagnostics = append(diagnostics, Diagnostic{Level: DiagnosticWarning, Source: "context-sherpa", Message: message, File: finding.File})
+			}
+			kept = append(kept, finding)
+			continue
+		}
+		if holds {
+			kept = append(kept, finding)
+		}
+	}
+	return kept, diagnostics
+}
+
+// needsSemanticCheck reports whether any finding comes from an ast-grep rule with constraints
+func needsSemanticCheck(findings []Finding, constraints map[string][]semanticConstraint) bool {
+	for _, finding := range findings {
+		if finding.Analyzer == AstGrepAnalyzerName && len(constraints[finding.RuleID]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// findingSatisfies reports whether every constraint holds for the finding
+func findingSatisfies(finding Finding, constraints []semanticConstraint, typed *typedFile, fset *token.FileSet) (bool, error) {
+	if typed == nil {
+		return false, fmt.Errorf("no type information for %s", finding.File)
+	}
+	for _, constraint := range constraints {
+		start, end := finding.matchStart, finding.matchEnd
+		if name := strings.TrimPrefix(constraint.Metavar, "$"); name != "" {
+			r, ok := finding.metaVariables[name]
+			if !ok {
+				return false, fmt.Errorf("metavariable $%s is not captured by the match", name)
+			}
+			start, end = r.Start, r.End
+		}
+
+		expr, err := exprAt(typed.file, fset, start, end)
+		if err != nil {
+			return false, err
+		}
+		holds, err := constraint.holds(expr, typed)
+		if err != nil || !holds {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// exprAt finds the expression spanning the byte offsets start to end of file
+func exprAt(file *ast.File, fset *token.FileSet, start, end int) (ast.Expr, error) {
+	tokenFile := fset.File(file.Pos())
+	if start < 0 || end < start || end > tokenFile.Size() {
+		return nil, fmt.Errorf("match at bytes %d-%d is outside the file", start, end)
+	}
+	path, _ := astutil.PathEnclosingInterval(file, tokenFile.Pos(start), tokenFile.Pos(end))
+	for _, node := range path {
+		if expr, ok := node.(ast.Expr); ok {
+			return expr, nil
+		}
+	}
+	return nil, fmt.Errorf("no expression at bytes %d-%d", start, end)
+}
+
+// holds evaluates the constraint against expr
+func (c semanticConstraint) holds(expr ast.Expr, typed *typedFile) (bool, error) {
+	switch {
+	case c.Returns != "":
+		target := ast.Unparen(expr)
+		if call, ok := target.(*ast.CallExpr); ok {
+			target = call.Fun
+		}
+		tv, ok := typed.info.Types[target]
+		if !ok || tv.Type == nil || tv.Type == types.Typ[types.Invalid] {
+			return false, fmt.Errorf("no type information for '%s'", types.ExprString(target))
+		}
+		if tv.IsType() {
+			return false, nil // a conversion returns nothing
+		}
+		sig, ok := tv.Type.Underlying().(*types.Signature)
+		if !ok {
+			return false, nil
+		}
+		for i := 0; i < sig.Results().Len(); i++ {
+			if typeMatches(sig.Results().At(i).Type(), c.Returns) {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case c.Type != "":
+		t, err := exprType(expr, typed)
+		if err != nil {
+			return false, err
+		}
+		return typeMatches(t, c.Type), nil
+
+	case c.Implements != "":
+		t, err := exprType(expr, typed)
+		if err != nil {
+			return false, err
+		}
+		iface, err := lookupInterface(c.Implements, typed.pkg)
+		if err != nil {
+			return false, err
+		}
+		if types.Implements(t, iface) {
+			return true, nil
+		}
+		// An addressable value of a named type also has the methods of its pointer
+		if _, isPointer := t.Underlying().(*types.Pointer); !isPointer && !types.IsInterface(t) {
+			return types.Implements(types.NewPointer(t), iface), nil
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("constraint has no check")
+}
+
+// exprType returns the type of expr, failing when the type checker could not determine it
+func exprType(expr ast.Expr, typed *typedFile) (types.Type, error) {
+	t := typed.info.TypeOf(expr)
+	if t == nil || t == types.Typ[types.Invalid] {
+		return nil, fmt.Errorf("no type information for '%s'", types.ExprString(expr))
+	}
+	return t, nil
+}
+
+// typeMatches reports whether t is the type written as name, either with full import paths
+// (net/http.Handler) or with package names (http.Handler)
+func typeMatches(t types.Type, name string) bool {
+	name = strings.TrimSpace(name)
+	if types.TypeString(t, nil) == name {
+		return true
+	}
+	return types.TypeString(t, func(p *types.Package) string { return p.Name() }) == name
+}
+
+// lookupInterface resolves an interface written as error, io.Closer or net/http.Handler among
+// the universe and the packages pkg imports, directly or not
+func lookupInterface(name string, pkg *types.Package) (*types.Interface, error) {
+	var obj types.Object
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		obj = types.Universe.Lookup(name)
+		if obj == nil && pkg != nil {
+			obj = pkg.Scope().Lookup(name)
+		}
+	} else if pkg != nil {
+		pkgRef, typeName := name[:dot], name[dot+1:]
+		seen := make(map[*types.Package]bool)
+		queue := []*types.Package{pkg}
+		for len(queue) > 0 && obj == nil {
+			p := queue[0]
+			queue = queue[1:]
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			if p.Path() == pkgRef || p.Name() == pkgRef {
+				obj = p.Scope().Lookup(typeName)
+			}
+			queue = append(queue, p.Imports()...)
+		}
+	}
+
+	typeName, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("interface '%s' is not found among the imported packages", name)
+	}
+	iface, ok := typeName.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not an interface", name)
+	}
+	return iface, nil
+}
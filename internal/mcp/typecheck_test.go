@@ -0,0 +1,213 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const semanticConstraintSample = `package main
+
+import "os"
+
+func mightFail() error { return nil }
+
+func say(msg string) {}
+
+type counter struct{}
+
+func main() {
+	mightFail()
+	say("hi")
+	f, _ := os.Open("x")
+	f.Close()
+	var c counter
+	c.Close()
+}
+
+func (counter) Close() {}
+`
+
+const semanticRules = `id: unchecked-error
+language: go
+rule:
+  pattern: $A($$$)
+message: unchecked
+semantic:
+  - metavar: A
+    returns: error
+---
+id: closer
+language: go
+rule:
+  pattern: $X.Close()
+message: close
+semantic:
+  - metavar: $X
+    implements: io.Closer
+`
+
+// sampleMatch builds the ast-grep JSON match of the statement text in the body of main,
+// capturing the given metavariable text within it
+func sampleMatch(file, ruleID, text, metavar, metavarText string) map[string]interface{} {
+	start := strings.Index(semanticConstraintSample, "\t"+text) + 1
+	mvStart := start + strings.Index(text, metavarText)
+	line := strings.Count(semanticConstraintSample[:start], "\n")
+	return map[string]interface{}{
+		"text":     text,
+		"file":     file,
+		"ruleId":   ruleID,
+		"severity": "error",
+		"message":  ruleID,
+		"range": map[string]interface{}{
+			"byteOffset": map[string]int{"start": start, "end": start + len(text)},
+			"start":      map[string]int{"line": line, "column": 1},
+			"end":        map[string]int{"line": line, "column": 1 + len(text)},
+		},
+		"metaVariables": map[string]interface{}{
+			"single": map[string]interface{}{
+				metavar: map[string]interface{}{
+					"range": map[string]interface{}{"byteOffset": map[string]int{"start": mvStart, "end": mvStart + len(metavarText)}},
+				},
+			},
+		},
+	}
+}
+
+// writeSemanticProject creates a Go module with the sample and the semantic rules, and a fake
+// ast-grep reporting the candidate matches in file
+func writeSemanticProject(t *testing.T, file string) (projectRoot, sgPath string) {
+	t.Helper()
+	projectRoot = t.TempDir()
+	os.WriteFile(filepath.Join(projectRoot, "go.mod"), []byte("module example.com/sample\n\ngo 1.24\n"), 0644)
+	os.WriteFile(filepath.Join(projectRoot, "main.go"), []byte(semanticConstraintSample), 0644)
+	os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n"), 0644)
+	os.MkdirAll(filepath.Join(projectRoot, "rules"), 0755)
+	os.WriteFile(filepath.Join(projectRoot, "rules", "semantic.yml"), []byte(semanticRules), 0644)
+
+	if file == "" {
+		file = filepath.Join(projectRoot, "main.go")
+	}
+	matches := []map[string]interface{}{
+		sampleMatch(file, "unchecked-error", "mightFail()", "A", "mightFail"),
+		sampleMatch(file, "unchecked-error", `say("hi")`, "A", "say"),
+		sampleMatch(file, "closer", "f.Close()", "X", "f"),
+		sampleMatch(file, "closer", "c.Close()", "X", "c"),
+	}
+	data, _ := json.Marshal(matches)
+	binDir := t.TempDir()
+	matchesPath := filepath.Join(binDir, "matches.json")
+	os.WriteFile(matchesPath, data, 0644)
+	return projectRoot, writeFakeAstGrep(t, binDir, "#!/bin/sh\ncat '"+matchesPath+"'\n")
+}
+
+// matchedTexts lists the text of each finding
+func matchedTexts(findings []Finding) string {
+	var texts []string
+	for _, finding := range findings {
+		texts = append(texts, finding.Text)
+	}
+	return strings.Join(texts, ", ")
+}
+
+func TestSemanticConstraints(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is needed to load packages")
+	}
+
+	t.Run("Scan path", func(t *testing.T) {
+		projectRoot, sgPath := writeSemanticProject(t, "")
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath})
+		result, err := s.ScanPath(context.Background(), ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if got := matchedTexts(result.Findings); got != "mightFail(), f.Close()" || len(result.Diagnostics) != 0 {
+			t.Errorf("Expected only the matches satisfying their constraints, got %s (diagnostics %+v)", got, result.Diagnostics)
+		}
+	})
+
+	t.Run("Scan code", func(t *testing.T) {
+		projectRoot, sgPath := writeSemanticProject(t, snippetFileName)
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath})
+		result, err := s.ScanCode(context.Background(), semanticConstraintSample, "go")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if got := matchedTexts(result.Findings); got != "mightFail(), f.Close()" || len(result.Diagnostics) != 0 {
+			t.Errorf("Expected the snippet to be type-checked on its own, got %s (diagnostics %+v)", got, result.Diagnostics)
+		}
+	})
+
+	t.Run("Unknown interface", func(t *testing.T) {
+		projectRoot, sgPath := writeSemanticProject(t, "")
+		rules := strings.Replace(semanticRules, "io.Closer", "sql.Scanner", 1)
+		os.WriteFile(filepath.Join(projectRoot, "rules", "semantic.yml"), []byte(rules), 0644)
+		s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: sgPath})
+
+		result, err := s.ScanPath(context.Background(), ScanPathOptions{Path: "."})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if got := matchedTexts(result.Findings); got != "mightFail(), f.Close(), c.Close()" {
+			t.Errorf("Expected the unevaluated matches to be kept, got %s", got)
+		}
+		if len(result.Diagnostics) != 1 || result.Diagnostics[0].Level != DiagnosticWarning || !strings.Contains(result.Diagnostics[0].Message, "interface 'sql.Scanner' is not found") {
+			t.Errorf("Expected one warning about the interface, got %+v", result.Diagnostics)
+		}
+	})
+}
+
+func TestValidateSemanticBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		semantic string
+		language string
+		expected string
+	}{
+		{"Valid", "  - metavar: A\n    returns: error\n", "go", ""},
+		{"Not a list", "  returns: error\n", "go", "'semantic' must be a list of constraints"},
+		{"Unknown key", "  - metavar: A\n    returns: error\n    calls: x\n", "go", "line 8: unknown semantic constraint key 'calls'"},
+		{"Two checks", "  - returns: error\n    type: int\n", "go", "line 6: semantic constraint must have exactly one of"},
+		{"No check", "  - metavar: A\n", "go", "exactly one of 'returns', 'implements' or 'type'"},
+		{"Other language", "  - returns: error\n", "python", "only supported for Go rules, not 'python'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := "id: r\nlanguage: " + tt.language + "\nrule:\n  pattern: $A()\nsemantic:\n" + tt.semantic
+			err := validateAstGrepRule(rule)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("Expected the rule to be valid, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestPackageDirPatterns(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		filepath.Join(root, "a", "a.go"),
+		filepath.Join(root, "a", "a_test.go"),
+		filepath.Join(root, "b", "b.go"),
+		"main.go",
+		filepath.Join("cmd", "tool", "main.go"),
+	}
+	want := []string{filepath.Join(root, "a"), filepath.Join(root, "b"), ".", "." + string(filepath.Separator) + filepath.Join("cmd", "tool")}
+	if got := packageDirPatterns(files); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected a pattern per directory %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,342 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleConfigKeys are the top-level keys of an ast-grep rule file
+var ruleConfigKeys = map[string]bool{
+	"id": true, "language": true, "rule": true, "constraints": true, "utils": true,
+	"transform": true, "fix": true, "message": true, "note": true, "severity": true,
+	"files": true, "ignores": true, "url": true, "metadata": true, "labels": true,
+	"rewriters": true,
+	// semantic is evaluated by context-sherpa; ast-grep ignores it
+	"semantic": true,
+}
+
+// ruleObjectKeys are the keys of an ast-grep rule object, with or without a relational stopBy/field
+var ruleObjectKeys = map[string]bool{
+	"pattern": true, "kind": true, "regex": true, "nthChild": true, "range": true,
+	"inside": true, "has": true, "precedes": true, "follows": true,
+	"all": true, "any": true, "not": true, "matches": true,
+}
+
+// relationalRuleKeys are the extra keys allowed in inside/has/precedes/follows rules
+var relationalRuleKeys = map[string]bool{"stopBy": true, "field": true}
+
+// patternObjectKeys are the keys of a pattern given as an object
+var patternObjectKeys = map[string]bool{"context": true, "selector": true, "strictness": true}
+
+var (
+	// astGrepErrorLinePattern matches the position serde reports for YAML errors
+	astGrepErrorLinePattern = regexp.MustCompile(`at line (\d+) column \d+`)
+	// astGrepQuotedPattern matches the values ast-grep quotes in its error messages
+	astGrepQuotedPattern = regexp.MustCompile("`([^`]+)`")
+	// ansiEscapePattern matches terminal color codes
+	ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// ruleProblem is a single problem found in a rule, with the 1-based line it refers to (0 when unknown)
+type ruleProblem struct {
+	Line    int
+	Message string
+}
+
+func (p ruleProblem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+	}
+	return p.Message
+}
+
+// ruleValidationError lists every problem found in a rule
+type ruleValidationError struct {
+	Problems []ruleProblem
+}
+
+func (e *ruleValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = problem.String()
+	}
+	return strings.Join(lines, "; ")
+}
+
+// parseRuleYAML parses a rule into a YAML node tree, rejecting files with more than one document
+func parseRuleYAML(yamlContent string) (*yaml.Node, error) {
+	var doc yaml.Node
+	decoder := yaml.NewDecoder(strings.NewReader(yamlContent))
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("could not parse YAML: %v", err)
+	}
+	var extra yaml.Node
+	if err := decoder.Decode(&extra); err == nil {
+		return nil, fmt.Errorf("expected a single rule, found several YAML documents")
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("rule must be a YAML mapping")
+	}
+	return doc.Content[0], nil
+}
+
+// checkRuleKeys reports unknown keys in a rule file, recursing into every rule object
+func checkRuleKeys(root *yaml.Node) []ruleProblem {
+	var problems []ruleProblem
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch {
+		case !ruleConfigKeys[key.Value]:
+			problems = append(problems, ruleProblem{Line: key.Line, Message: fmt.Sprintf("unknown key '%s'", key.Value)})
+		case key.Value == "rule":
+			problems = append(problems, checkRuleObject(value, nil)...)
+		case key.Value == "semantic":
+			problems = append(problems, checkSemanticBlock(value, mappingValue(root, "language"))...)
+		case key.Value == "utils" || key.Value == "constraints":
+			if value.Kind == yaml.MappingNode {
+				for j := 1; j < len(value.Content); j += 2 {
+					problems = append(problems, checkRuleObject(value.Content[j], nil)...)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// mappingEntry returns the value of key in a YAML mapping, or nil when it is missing
+func mappingEntry(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the scalar value of key in a YAML mapping, or "" when it is missing
+func mappingValue(node *yaml.Node, key string) string {
+	if value := mappingEntry(node, key); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+// checkRuleObject reports unknown keys in a rule object. extraKeys lists keys allowed on top of
+// the common rule keys, such as stopBy on relational rules.
+func checkRuleObject(node *yaml.Node, extraKeys map[string]bool) []ruleProblem {
+	if node.Kind != yaml.MappingNode {
+		return []ruleProblem{{Line: node.Line, Message: "rule must be a mapping"}}
+	}
+
+	var problems []ruleProblem
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if !ruleObjectKeys[key.Value] && !extraKeys[key.Value] {
+			problems = append(problems, ruleProblem{Line: key.Line, Message: fmt.Sprintf("unknown rule key '%s'", key.Value)})
+			continue
+		}
+
+		switch key.Value {
+		case "inside", "has", "precedes", "follows":
+			problems = append(problems, checkRuleObject(value, relationalRuleKeys)...)
+		case "not":
+			problems = append(problems, checkRuleObject(value, nil)...)
+		case "all", "any":
+			if value.Kind != yaml.SequenceNode {
+				problems = append(problems, ruleProblem{Line: value.Line, Message: fmt.Sprintf("'%s' must be a list of rules", key.Value)})
+				continue
+			}
+			for _, item := range value.Content {
+				problems = append(problems, checkRuleObject(item, nil)...)
+			}
+		case "pattern":
+			if value.Kind == yaml.MappingNode {
+				for j := 0; j+1 < len(value.Content); j += 2 {
+					if !patternObjectKeys[value.Content[j].Value] {
+						problems = append(problems, ruleProblem{Line: value.Content[j].Line, Message: fmt.Sprintf("unknown pattern key '%s'", value.Content[j].Value)})
+					}
+				}
+			}
+		case "stopBy":
+			// stopBy is either neighbor, end or a rule object
+			if value.Kind == yaml.MappingNode {
+				problems = append(problems, checkRuleObject(value, nil)...)
+			}
+		}
+	}
+	return problems
+}
+
+// validateRuleWithAstGrep compiles a rule with the ast-grep binary at sgPath, which reports
+// pattern syntax errors, unknown languages and invalid kinds. The rule is scanned against an
+// empty directory, so nothing in the project is read.
+func (s *Server) validateRuleWithAstGrep(ctx context.Context, sgPath, sgconfigPath, yamlContent string) error {
+	tempDir, err := os.MkdirTemp("", "sherpa-rule-")
+	if err != nil {
+		return fmt.Errorf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ruleFile := filepath.Join(tempDir, "rule.yml")
+	if err := os.WriteFile(ruleFile, []byte(yamlContent), 0644); err != nil {
+		return fmt.Errorf("could not write temporary rule file: %v", err)
+	}
+	target := filepath.Join(tempDir, "empty")
+	if err := os.Mkdir(target, 0755); err != nil {
+		return fmt.Errorf("could not create temporary directory: %v", err)
+	}
+
+	args := append([]string{"scan", "--rule", ruleFile}, configArgs(sgconfigPath)...)
+	args = append(args, "--json=compact", "--color", "never")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, sgPath, append(args, target)...)
+	cmd.WaitDelay = subprocessWaitDelay
+	cmd.Dir = tempDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	s.logger.Debug("Validating rule", "command", cmd.String())
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("validation %s: %v", cancelReason(ctxErr), ctxErr)
+		}
+		// Name the rule file without the temporary directory
+		message := strings.ReplaceAll(cleanAstGrepError(stderr.String()), ruleFile, filepath.Base(ruleFile))
+		if message == "" {
+			message = err.Error()
+		}
+		var root *yaml.Node
+		if node, parseErr := parseRuleYAML(yamlContent); parseErr == nil {
+			root = node
+		}
+		return &ruleValidationError{Problems: []ruleProblem{{
+			Line:    locateAstGrepError(root, message),
+			Message: "ast-grep rejected the rule: " + message,
+		}}}
+	}
+	return nil
+}
+
+// cleanAstGrepError turns ast-grep's decorated error report into a single line
+func cleanAstGrepError(stderr string) string {
+	var parts []string
+	for _, line := range strings.Split(ansiEscapePattern.ReplaceAllString(stderr, ""), "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "✖╰▻→"))
+		if line == "" || strings.HasPrefix(line, "Help:") || strings.HasPrefix(line, "See also:") || line == "Caused by" {
+			continue
+		}
+		parts = append(parts, strings.TrimPrefix(line, "Error: "))
+	}
+	return strings.Join(parts, ": ")
+}
+
+// locateAstGrepError guesses the line of the rule an ast-grep error refers to: the position
+// reported by the YAML parser, the line of a value quoted in the message, or the line of the
+// first rule key named in it
+func locateAstGrepError(root *yaml.Node, message string) int {
+	if match := astGrepErrorLinePattern.FindStringSubmatch(message); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return line
+	}
+	if root == nil {
+		return 0
+	}
+
+	type keyValue struct{ key, value *yaml.Node }
+	var pairs []keyValue
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				pairs = append(pairs, keyValue{node.Content[i], node.Content[i+1]})
+			}
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	for _, quoted := range astGrepQuotedPattern.FindAllStringSubmatch(message, -1) {
+		for _, pair := range pairs {
+			if pair.value.Kind == yaml.ScalarNode && strings.TrimSpace(pair.value.Value) == strings.TrimSpace(quoted[1]) {
+				return pair.value.Line
+			}
+		}
+	}
+
+	lower := strings.ToLower(message)
+	keys := make([]string, 0, len(ruleObjectKeys)+len(ruleConfigKeys))
+	for key := range ruleConfigKeys {
+		keys = append(keys, key)
+	}
+	for key := range ruleObjectKeys {
+		keys = append(keys, key)
+	}
+	// Prefer the most specific key, so "pattern" wins over "rule" in "rule pattern is invalid"
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		if !regexp.MustCompile(`\b` + regexp.QuoteMeta(strings.ToLower(key)) + `\b`).MatchString(lower) {
+			continue
+		}
+		for _, pair := range pairs {
+			if pair.key.Value == key {
+				return pair.key.Line
+			}
+		}
+	}
+	return 0
+}
+
+// validateRule runs the structural checks of validateAstGrepRule, checks the rule's language
+// against the languages of the sgconfig.yml at sgconfigPath, the one the rule is saved for, and
+// then compiles the rule with ast-grep. A rule is only accepted when ast-grep is available to
+// check it.
+func (s *Server) validateRule(ctx context.Context, sgconfigPath, yamlContent string) error {
+	if err := validateAstGrepRule(yamlContent); err != nil {
+		return err
+	}
+
+	if err := checkRuleLanguage(yamlContent, loadLanguages(sgconfigPath)); err != nil {
+		return err
+	}
+
+	sgPath, err := s.findAstGrepBinary()
+	if err != nil {
+		return fmt.Errorf("cannot validate the rule without ast-grep: %v", err)
+	}
+	return s.validateRuleWithAstGrep(ctx, sgPath, sgconfigPath, yamlContent)
+}
+
+// checkRuleLanguage reports a rule whose language is neither built into ast-grep nor declared
+// in the customLanguages known to languages
+func checkRuleLanguage(yamlContent string, languages *languageRegistry) error {
+	root, err := parseRuleYAML(yamlContent)
+	if err != nil {
+		return err
+	}
+	value := mappingEntry(root, "language")
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return nil
+	}
+	if _, err := languages.resolve(value.Value); err != nil {
+		return &ruleValidationError{Problems: []ruleProblem{{Line: value.Line, Message: err.Error()}}}
+	}
+	return nil
+}
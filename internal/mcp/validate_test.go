@@ -0,0 +1,240 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeAstGrepRejectingKind fails like ast-grep does when a rule uses the kind 'not_a_kind'
+const fakeAstGrepRejectingKind = `#!/bin/sh
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--rule" ]; then rule="$2"; fi
+  shift
+done
+if grep -q "not_a_kind" "$rule"; then
+  echo "Error: Cannot parse rule $rule" >&2
+  echo "Help: The file is not a valid ast-grep rule. Please refer to doc and fix the error." >&2
+  echo "" >&2
+  echo "✖ Caused by" >&2
+  echo "╰▻ Rule contains invalid kind matcher." >&2
+  echo '╰▻ Kind ` + "`not_a_kind`" + ` is invalid.' >&2
+  exit 1
+fi
+echo "[]"
+`
+
+func TestCheckRuleKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected []string
+	}{
+		{
+			name: "Valid nested rule",
+			yaml: `id: r
+language: go
+rule:
+  all:
+    - pattern: fmt.Println($A)
+    - inside:
+        kind: function_declaration
+        stopBy: end
+    - not:
+        has:
+          pattern:
+            context: x
+            selector: y
+          field: body
+constraints:
+  A:
+    regex: ^a
+`,
+		},
+		{
+			name:     "Unknown top-level key",
+			yaml:     "id: r\nlanguage: go\nrule:\n  pattern: x\nmesage: typo\n",
+			expected: []string{"line 5: unknown key 'mesage'"},
+		},
+		{
+			name:     "Unknown nested rule key",
+			yaml:     "id: r\nlanguage: go\nrule:\n  any:\n    - pattern: x\n    - patern: y\n",
+			expected: []string{"line 6: unknown rule key 'patern'"},
+		},
+		{
+			name:     "stopBy outside a relational rule",
+			yaml:     "id: r\nlanguage: go\nrule:\n  pattern: x\n  stopBy: end\n",
+			expected: []string{"line 5: unknown rule key 'stopBy'"},
+		},
+		{
+			name:     "any that is not a list",
+			yaml:     "id: r\nlanguage: go\nrule:\n  any:\n    pattern: x\n",
+			expected: []string{"line 5: 'any' must be a list of rules"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseRuleYAML(tt.yaml)
+			if err != nil {
+				t.Fatalf("Expected YAML to parse, got: %v", err)
+			}
+			var got []string
+			for _, problem := range checkRuleKeys(root) {
+				got = append(got, problem.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateAstGrepRuleReportsLines(t *testing.T) {
+	err := validateAstGrepRule("id: r\nlanguage: go\nrule:\n  pattern: x\nfix: y\nseverty: error\n")
+	if err == nil || err.Error() != "line 6: unknown key 'severty'" {
+		t.Errorf("Expected unknown key with its line, got: %v", err)
+	}
+
+	if err := validateAstGrepRule("id: r\nlanguage: go\n"); err == nil {
+		t.Error("Expected a rule without 'rule' to fail validation")
+	}
+
+	if err := validateAstGrepRule("id: a\nlanguage: go\nrule:\n  pattern: x\n---\nid: b\nlanguage: go\nrule:\n  pattern: y\n"); err == nil {
+		t.Error("Expected several YAML documents to fail validation")
+	}
+}
+
+func TestLocateAstGrepError(t *testing.T) {
+	root, _ := parseRuleYAML("id: r\nlanguage: go\nrule:\n  any:\n    - pattern: a\n    - kind: not_a_kind\n")
+
+	tests := []struct {
+		name     string
+		message  string
+		expected int
+	}{
+		{"YAML position", "unknown field `foo` at line 3 column 5", 3},
+		{"Quoted value", "Rule contains invalid kind matcher.: Kind `not_a_kind` is invalid.", 6},
+		{"Key name", "Cannot parse pattern", 5},
+		{"Key inside a word does not count", "something is invalid", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := locateAstGrepError(root, tt.message); got != tt.expected {
+				t.Errorf("locateAstGrepError(%q) = %d, expected %d", tt.message, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateRuleWithAstGrep(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	sgPath := writeFakeAstGrep(t, t.TempDir(), fakeAstGrepRejectingKind)
+
+	if err := NewServer(Options{}).validateRuleWithAstGrep(context.Background(), sgPath, "", "id: r\nlanguage: go\nrule:\n  kind: call_expression\n"); err != nil {
+		t.Errorf("Expected rule to be accepted, got: %v", err)
+	}
+
+	err := NewServer(Options{}).validateRuleWithAstGrep(context.Background(), sgPath, "", "id: r\nlanguage: go\nrule:\n  kind: not_a_kind\n")
+	if err == nil {
+		t.Fatal("Expected rule to be rejected")
+	}
+	if !strings.HasPrefix(err.Error(), "line 4: ast-grep rejected the rule:") || !strings.Contains(err.Error(), "Kind `not_a_kind` is invalid.") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if strings.Contains(err.Error(), "Help:") || strings.Contains(err.Error(), "╰▻") {
+		t.Errorf("Expected decorations to be removed, got: %v", err)
+	}
+}
+
+func TestValidateRuleWithAstGrepUsesConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	// Like ast-grep, the fake only knows the utility rules of utilDirs through --config
+	script := "#!/bin/sh\ncase \"$*\" in\n  *--config*) echo '[]' ;;\n  *) echo 'Error: Rule `is-logger` is not found.' >&2; exit 1 ;;\nesac\n"
+	sgPath := writeFakeAstGrep(t, t.TempDir(), script)
+	projectRoot := t.TempDir()
+	sgconfigPath := filepath.Join(projectRoot, "sgconfig.yml")
+	os.WriteFile(sgconfigPath, []byte("ruleDirs:\n  - rules\nutilDirs:\n  - utils\n"), 0644)
+
+	ruleYAML := "id: r\nlanguage: go\nrule:\n  matches: is-logger\n"
+	if err := NewServer(Options{}).validateRuleWithAstGrep(context.Background(), sgPath, sgconfigPath, ruleYAML); err != nil {
+		t.Errorf("Expected the rule to be validated with the project's config, got: %v", err)
+	}
+	// A missing config is not passed on
+	if err := NewServer(Options{}).validateRuleWithAstGrep(context.Background(), sgPath, filepath.Join(projectRoot, "missing.yml"), ruleYAML); err == nil {
+		t.Error("Expected the rule to be rejected without a config")
+	}
+}
+
+func TestAddOrUpdateRuleHandlerValidates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ast-grep is a shell script")
+	}
+	projectRoot := t.TempDir()
+	os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n"), 0644)
+	os.MkdirAll(filepath.Join(projectRoot, "rules"), 0755)
+
+	s := NewServer(Options{ProjectRoot: projectRoot, AstGrepPath: writeFakeAstGrep(t, t.TempDir(), fakeAstGrepRejectingKind)})
+
+	addRule := func(id, ruleYAML string) *mcp.CallToolResult {
+		req := mcp.CallToolRequest{
+			Params: mcp.CallToolParams{
+				Arguments: map[string]interface{}{"rule_id": id, "rule_yaml": ruleYAML},
+			},
+		}
+		result, err := s.addOrUpdateRuleHandler(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error from handler, got: %v", err)
+		}
+		return result
+	}
+
+	t.Run("Invalid kind is rejected", func(t *testing.T) {
+		result := addRule("bad-kind", "id: bad-kind\nlanguage: go\nrule:\n  kind: not_a_kind\n")
+		if !result.IsError || !strings.Contains(toolResultText(t, result), "line 4") {
+			t.Errorf("Expected an error with a line number, got: %s", toolResultText(t, result))
+		}
+		if _, err := os.Stat(filepath.Join(projectRoot, "rules", "bad-kind.yml")); !os.IsNotExist(err) {
+			t.Error("Expected the invalid rule not to be written")
+		}
+	})
+
+	t.Run("Unknown key is rejected", func(t *testing.T) {
+		result := addRule("typo", "id: typo\nlanguage: go\nrule:\n  patern: x\n")
+		if !result.IsError || !strings.Contains(toolResultText(t, result), "line 4: unknown rule key 'patern'") {
+			t.Errorf("Expected the unknown key to be reported, got: %s", toolResultText(t, result))
+		}
+	})
+
+	t.Run("Rule id other than rule_id is rejected", func(t *testing.T) {
+		result := addRule("foo", "id: bar\nlanguage: go\nrule:\n  kind: call_expression\n")
+		if !result.IsError || !strings.Contains(toolResultText(t, result), "the rule YAML has id 'bar'; rule_id must match it") {
+			t.Errorf("Expected the id mismatch to be reported, got: %s", toolResultText(t, result))
+		}
+		for _, name := range []string{"foo.yml", "bar.yml"} {
+			if _, err := os.Stat(filepath.Join(projectRoot, "rules", name)); !os.IsNotExist(err) {
+				t.Errorf("Expected %s not to be written", name)
+			}
+		}
+	})
+
+	t.Run("Valid rule is written", func(t *testing.T) {
+		result := addRule("good", "id: good\nlanguage: go\nrule:\n  kind: call_expression\n")
+		if result.IsError {
+			t.Fatalf("Expected the rule to be accepted, got: %s", toolResultText(t, result))
+		}
+		if _, err := os.Stat(filepath.Join(projectRoot, "rules", "good.yml")); err != nil {
+			t.Errorf("Expected the rule to be written: %v", err)
+		}
+	})
+}
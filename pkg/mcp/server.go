@@ -0,0 +1,73 @@
+// Package mcp is the Go API for embedding context-sherpa in other tools. A Server is bound to
+// one project, so a program can serve several projects, register the tools next to its own on
+// an existing MCP server, or call scans and rule management directly from Go.
+package mcp
+
+import (
+	"context"
+
+	sherpa "github.com/hackafterdark/context-sherpa/internal/mcp"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Types shared with the server implementation
+type (
+	Options          = sherpa.Options
+	TransportOptions = sherpa.TransportOptions
+	ScanPathOptions  = sherpa.ScanPathOptions
+	ScanResult       = sherpa.ScanResult
+	Finding          = sherpa.Finding
+	Diagnostic       = sherpa.Diagnostic
+	RuleSpec         = sherpa.RuleSpec
+	RuleList         = sherpa.RuleList
+	RuleInfo         = sherpa.RuleInfo
+	ProjectConfig    = sherpa.ProjectConfig
+	ConfigDir        = sherpa.ConfigDir
+
+	Analyzer             = sherpa.Analyzer
+	AnalyzerCapabilities = sherpa.AnalyzerCapabilities
+	Project              = sherpa.Project
+	RuleImporter         = sherpa.RuleImporter
+)
+
+// Names of the built-in analyzers
+const (
+	AstGrepAnalyzerName    = sherpa.AstGrepAnalyzerName
+	GoAnalysisAnalyzerName = sherpa.GoAnalysisAnalyzerName
+)
+
+// DefaultToolTimeout bounds every tool call unless Options.ToolTimeout says otherwise
+const DefaultToolTimeout = sherpa.DefaultToolTimeout
+
+// ErrScanIncomplete is wrapped by the error ScanPath returns with the partial result of a scan
+// that was cancelled or timed out
+var ErrScanIncomplete = sherpa.ErrScanIncomplete
+
+// Server is a context-sherpa instance bound to one project. Besides CallTool it offers
+// RegisterTools, Serve, ScanPath, ScanCode, AddRule, RemoveRule, ListRules, GetConfig and
+// RunTool.
+type Server struct {
+	*sherpa.Server
+}
+
+// NewServer creates a Server from opts; the zero Options serve the project containing the
+// current directory with ast-grep from PATH
+func NewServer(opts Options) *Server {
+	return &Server{Server: sherpa.NewServer(opts)}
+}
+
+// CallTool runs one of the MCP tools by name with req.Params as its arguments
+func (s *Server) CallTool(ctx context.Context, name string, req ToolRequest) (*ToolResponse, error) {
+	result, err := s.RunTool(ctx, name, req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ToolResponse{Content: []ToolContent{}, IsError: result.IsError}
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			resp.Content = append(resp.Content, ToolContent{Text: text.Text})
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,57 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestServerCallTool(t *testing.T) {
+	projectRoot := t.TempDir()
+	os.WriteFile(filepath.Join(projectRoot, "sgconfig.yml"), []byte("ruleDirs:\n  - rules\n"), 0644)
+	os.MkdirAll(filepath.Join(projectRoot, "rules"), 0755)
+	os.WriteFile(filepath.Join(projectRoot, "rules", "no-panic.yml"), []byte("id: no-panic\nlanguage: go\nrule:\n  pattern: panic($$$)\n"), 0644)
+
+	s := NewServer(Options{ProjectRoot: projectRoot})
+
+	t.Run("Tool result", func(t *testing.T) {
+		resp, err := s.CallTool(context.Background(), "list_rules", ToolRequest{})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if resp.IsError || len(resp.Content) != 1 || !strings.Contains(resp.Content[0].Text, `"id": "no-panic"`) {
+			t.Errorf("Unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("Tool error", func(t *testing.T) {
+		resp, err := s.CallTool(context.Background(), "get_rule", ToolRequest{Params: map[string]interface{}{}})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !resp.IsError {
+			t.Errorf("Expected the missing rule_id to be reported, got: %+v", resp)
+		}
+	})
+
+	t.Run("Unknown tool", func(t *testing.T) {
+		if _, err := s.CallTool(context.Background(), "no_such_tool", ToolRequest{}); err == nil {
+			t.Error("Expected an unknown tool to be rejected")
+		}
+	})
+}
+
+func TestServerRegisterTools(t *testing.T) {
+	m := server.NewMCPServer("host", "1.0.0", server.WithToolCapabilities(false))
+	NewServer(Options{ProjectRoot: t.TempDir()}).RegisterTools(m)
+
+	for _, name := range []string{"scan_path", "add_or_update_rule", "list_rules"} {
+		if m.GetTool(name) == nil {
+			t.Errorf("Expected %s to be registered", name)
+		}
+	}
+}
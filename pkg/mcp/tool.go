@@ -1,13 +1,18 @@
 package mcp
 
+// ToolRequest holds the arguments of a tool call made with Server.CallTool
 type ToolRequest struct {
 	Params map[string]interface{}
 }
 
+// ToolResponse is the result of a tool call made with Server.CallTool
 type ToolResponse struct {
 	Content []ToolContent
+	// IsError is set when the tool reports that the call failed
+	IsError bool
 }
 
+// ToolContent is one text block of a ToolResponse
 type ToolContent struct {
 	Text string
 }